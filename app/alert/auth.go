@@ -0,0 +1,236 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/pkg/errors"
+)
+
+// tokenExpiryMargin renews OAuth2 tokens this long before they expire, so they do not expire on the way
+const tokenExpiryMargin = 30 * time.Second
+
+var (
+	// authProviders caches the auth provider of each destination, so OAuth2 tokens are reused until they expire
+	authProviders      = make(map[string]cachedAuthProvider)
+	authProvidersMutex sync.Mutex
+)
+
+// AuthProvider gives the credentials requests to a destination are authorized with
+type AuthProvider interface {
+	// Authorization returns the value of the Authorization header
+	Authorization() (string, error)
+	// Invalidate forgets credentials the destination rejected, so the next Authorization gets new ones
+	Invalidate()
+}
+
+type cachedAuthProvider struct {
+	settings string
+	provider AuthProvider
+}
+
+// BasicAuth authorizes requests with a client id and secret
+type BasicAuth struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// Authorization returns the client id and secret as basic auth
+func (auth *BasicAuth) Authorization() (string, error) {
+	credentials := auth.ClientID + ":" + auth.ClientSecret
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)), nil
+}
+
+// Invalidate does nothing, the client id and secret do not change
+func (auth *BasicAuth) Invalidate() {}
+
+// BearerAuth authorizes requests with a static token
+type BearerAuth struct {
+	Token string
+}
+
+// Authorization returns the token as a bearer token
+func (auth *BearerAuth) Authorization() (string, error) {
+	return "Bearer " + auth.Token, nil
+}
+
+// Invalidate does nothing, the token does not change
+func (auth *BearerAuth) Invalidate() {}
+
+// OAuth2ClientCredentials authorizes requests with an access token requested from the token endpoint
+// with the client credentials grant. The token is cached until it expires or is invalidated.
+type OAuth2ClientCredentials struct {
+	Client       *http.Client
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Authorization returns the cached access token as a bearer token, requesting a new one when there is none
+// or it has expired
+func (auth *OAuth2ClientCredentials) Authorization() (string, error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.token == "" || (!auth.expiry.IsZero() && !time.Now().Before(auth.expiry)) {
+		token, expiry, err := auth.requestToken()
+		if err != nil {
+			return "", err
+		}
+		auth.token, auth.expiry = token, expiry
+	}
+	return "Bearer " + auth.token, nil
+}
+
+// Invalidate forgets the cached access token
+func (auth *OAuth2ClientCredentials) Invalidate() {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	auth.token = ""
+}
+
+// requestToken requests an access token with the client credentials, returning when it expires,
+// or a zero time when the token endpoint does not say
+func (auth *OAuth2ClientCredentials) requestToken() (string, time.Time, error) {
+	request, err := http.NewRequest(http.MethodPost, auth.Endpoint, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to create token request")
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(auth.ClientID, auth.ClientSecret)
+
+	requested := time.Now()
+	response, err := auth.Client.Do(request)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to request token")
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return "", time.Time{}, errors.Wrap(&delivery.StatusError{StatusCode: response.StatusCode}, "unable to get token")
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "unable to read token")
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("no access token returned")
+	}
+
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		if lifetime > 2*tokenExpiryMargin {
+			lifetime -= tokenExpiryMargin
+		}
+		expiry = requested.Add(lifetime)
+	}
+	return token.AccessToken, expiry, nil
+}
+
+// authProvider returns the auth provider for the authType of the destination, or nil when it has none.
+// Providers are cached per destination and replaced when its auth settings change.
+func authProvider(destination routing.Destination) (AuthProvider, error) {
+	authType := strings.ToLower(destination.AuthType)
+	if authType == "" {
+		return nil, nil
+	}
+	settings := strings.Join([]string{authType, destination.AuthEndpoint, destination.ClientID,
+		destination.ClientSecret, destination.Token}, "\x00")
+
+	authProvidersMutex.Lock()
+	defer authProvidersMutex.Unlock()
+	if cached, found := authProviders[destination.Name]; found && cached.settings == settings {
+		return cached.provider, nil
+	}
+
+	var provider AuthProvider
+	switch authType {
+	case routing.AuthBasic:
+		provider = &BasicAuth{ClientID: destination.ClientID, ClientSecret: destination.ClientSecret}
+	case routing.AuthBearer:
+		provider = &BearerAuth{Token: destination.Token}
+	case routing.AuthOAuth2:
+		client, err := webhookClient(destination)
+		if err != nil {
+			return nil, err
+		}
+		provider = &OAuth2ClientCredentials{
+			Client:       client,
+			Endpoint:     destination.AuthEndpoint,
+			ClientID:     destination.ClientID,
+			ClientSecret: destination.ClientSecret,
+		}
+	default:
+		return nil, errors.Errorf("destination %s has unsupported authType %s", destination.Name, destination.AuthType)
+	}
+	authProviders[destination.Name] = cachedAuthProvider{settings: settings, provider: provider}
+	return provider, nil
+}
+
+// authorization returns the value of the Authorization header for the destination, empty without auth
+func authorization(provider AuthProvider, destination routing.Destination) (string, error) {
+	if provider == nil {
+		return "", nil
+	}
+	value, err := provider.Authorization()
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to authorize requests to %s", destination.Name)
+	}
+	return value, nil
+}
+
+// cloudConnectorAuth returns the auth of the destination for the cloud connector, which requests tokens and
+// authorizes the request itself, empty without auth
+func cloudConnectorAuth(destination routing.Destination) models.Auth {
+	authType := strings.ToLower(destination.AuthType)
+	if authType == "" {
+		return models.Auth{}
+	}
+
+	// Encode the endpoint credentials as base64
+	authData := "basic " + base64.StdEncoding.EncodeToString([]byte(destination.ClientID+":"+destination.ClientSecret))
+	if authType == routing.AuthBearer {
+		authData = "bearer " + destination.Token
+	}
+	return models.Auth{
+		AuthType: destination.AuthType,
+		Endpoint: destination.AuthEndpoint,
+		Data:     authData,
+	}
+}
+
+// unauthorized reports whether the destination rejected the credentials of a webhook or chat delivery.
+// In cloudConnector mode a 401 is the cloud connector's own answer, so those deliveries are not retried.
+func unauthorized(err error) bool {
+	return delivery.StatusCode(err) == http.StatusUnauthorized
+}
+
+// resetAuthProviders forgets the auth providers of the destinations and their cached tokens
+func resetAuthProviders() {
+	authProvidersMutex.Lock()
+	defer authProvidersMutex.Unlock()
+	authProviders = make(map[string]cachedAuthProvider)
+}
@@ -0,0 +1,133 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+)
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	tokens := 0
+	expiresIn := 3600
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if err := request.ParseForm(); err != nil || request.Form.Get("grant_type") != "client_credentials" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tokens++
+		_, _ = fmt.Fprintf(writer, `{"access_token":"token-%d","expires_in":%d}`, tokens, expiresIn)
+	}))
+	defer server.Close()
+
+	auth := &OAuth2ClientCredentials{Client: server.Client(), Endpoint: server.URL, ClientID: "client", ClientSecret: "secret"}
+	for i := 0; i < 2; i++ {
+		authorization, err := auth.Authorization()
+		if err != nil {
+			t.Fatalf("Unable to authorize %s", err)
+		}
+		if authorization != "Bearer token-1" {
+			t.Errorf("Expected the cached token, got %s", authorization)
+		}
+	}
+
+	auth.Invalidate()
+	if authorization, _ := auth.Authorization(); authorization != "Bearer token-2" {
+		t.Errorf("Expected a new token once invalidated, got %s", authorization)
+	}
+
+	// a token that has expired is requested again
+	auth.expiry = time.Now().Add(-time.Second)
+	if authorization, _ := auth.Authorization(); authorization != "Bearer token-3" {
+		t.Errorf("Expected a new token once expired, got %s", authorization)
+	}
+	if !auth.expiry.After(time.Now().Add(time.Hour - 2*tokenExpiryMargin)) {
+		t.Errorf("Expected the token to expire in about an hour, got %s", auth.expiry)
+	}
+}
+
+func TestAuthProvider(t *testing.T) {
+	ResetWebhookClients()
+	defer ResetWebhookClients()
+
+	tests := []struct {
+		destination   routing.Destination
+		authorization string
+	}{
+		{routing.Destination{Name: "basic", AuthType: "basic", ClientID: "client", ClientSecret: "secret"}, "Basic Y2xpZW50OnNlY3JldA=="},
+		{routing.Destination{Name: "bearer", AuthType: "Bearer", Token: "static"}, "Bearer static"},
+	}
+	for _, test := range tests {
+		provider, err := authProvider(test.destination)
+		if err != nil {
+			t.Fatalf("Unable to get auth provider of %s %s", test.destination.Name, err)
+		}
+		if authorization, _ := provider.Authorization(); authorization != test.authorization {
+			t.Errorf("Expected authorization %q, got %q", test.authorization, authorization)
+		}
+	}
+
+	if provider, err := authProvider(routing.Destination{Name: "none"}); provider != nil || err != nil {
+		t.Errorf("Expected no auth provider without authType, got %v %v", provider, err)
+	}
+	if _, err := authProvider(routing.Destination{Name: "unknown", AuthType: "kerberos"}); err == nil {
+		t.Error("Expected error for unsupported authType")
+	}
+
+	destination := routing.Destination{Name: "rotated", AuthType: "bearer", Token: "old"}
+	cached, _ := authProvider(destination)
+	if same, _ := authProvider(destination); same != cached {
+		t.Error("Expected the auth provider to be cached")
+	}
+	destination.Token = "new"
+	provider, _ := authProvider(destination)
+	if authorization, _ := provider.Authorization(); authorization != "Bearer new" {
+		t.Errorf("Expected the auth provider to be replaced when its settings change, got %s", authorization)
+	}
+}
+
+func TestDeliverWebhook_RefreshOn401(t *testing.T) {
+	tokens := 0
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/token" {
+			tokens++
+			_, _ = fmt.Fprintf(writer, `{"access_token":"token-%d"}`, tokens)
+			return
+		}
+		authorizations = append(authorizations, request.Header.Get("Authorization"))
+		// the first token has been revoked
+		if request.Header.Get("Authorization") == "Bearer token-1" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+	defer ResetWebhookClients()
+
+	destination := routing.Destination{Name: "revoked", URL: server.URL + "/hook", AuthType: "oauth2",
+		AuthEndpoint: server.URL + "/token", ClientID: "client", ClientSecret: "secret"}
+	message := delivery.Message{Data: []byte(`{"alert_number":22}`)}
+	if _, err := DeliverWebhook(message, destination); err != nil {
+		t.Fatalf("Expected the delivery to succeed with a new token, got %s", err)
+	}
+	if _, err := DeliverWebhook(message, destination); err != nil {
+		t.Fatalf("Error delivering webhook %s", err)
+	}
+	expected := []string{"Bearer token-1", "Bearer token-2", "Bearer token-2"}
+	if fmt.Sprint(authorizations) != fmt.Sprint(expected) || tokens != 2 {
+		t.Errorf("Expected authorizations %v with 2 tokens, got %v with %d", expected, authorizations, tokens)
+	}
+}
@@ -0,0 +1,337 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxTableRows keeps tables of optional details, such as long not whitelisted product lists,
+	// within the message size limits of the chat services
+	maxTableRows = 50
+
+	defaultSeverityColor = "#9E9E9E"
+)
+
+// severityColors are the colours chat messages are marked with for each alert severity
+var severityColors = map[string]string{
+	"critical": "#D32F2F",
+	"urgent":   "#F57C00",
+	"warning":  "#FBC02D",
+	"info":     "#1976D2",
+}
+
+// slackMessage is a Slack incoming webhook message, its blocks held in an attachment for the severity colour
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// teamsCard is a Microsoft Teams incoming webhook MessageCard
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	Summary    string         `json:"summary"`
+	ThemeColor string         `json:"themeColor"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Title string      `json:"title,omitempty"`
+	Text  string      `json:"text,omitempty"`
+	Facts []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DeliverChat formats the alert of the message as a Slack or Teams message, according to the destination mode,
+// and posts it to the incoming webhook at the destination url
+func DeliverChat(message delivery.Message, destination routing.Destination) (delivery.Response, error) {
+	var alert models.Alert
+	if err := json.Unmarshal(message.Data, &alert); err != nil {
+		return delivery.Response{}, errors.Wrapf(err, "unable to read notification for %s", destination.Name)
+	}
+
+	var formatted interface{}
+	if destination.Mode == routing.ModeTeams {
+		formatted = teamsMessage(message.NotificationType, alert)
+	} else {
+		formatted = slackPayload(message.NotificationType, alert)
+	}
+	data, err := json.Marshal(formatted)
+	if err != nil {
+		return delivery.Response{}, errors.Wrapf(err, "unable to format notification for %s", destination.Name)
+	}
+
+	message.Data = data
+	return DeliverWebhook(message, destination)
+}
+
+func slackPayload(notificationType string, alert models.Alert) slackMessage {
+	blocks := []slackBlock{
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*" + slackEscape(chatTitle(notificationType, alert)) + "*"}},
+	}
+	var fields []slackText
+	for _, fact := range chatFacts(alert) {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*" + fact.Name + "*\n" + slackEscape(fact.Value)})
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields})
+	}
+	if table := textTable(optionalTable(alert.Optional)); table != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "*" + optionalTitle(alert) + "*\n```\n" + slackEscape(table) + "```"},
+		})
+	}
+	if alert.SentOn != 0 {
+		blocks = append(blocks, slackBlock{
+			Type:     "context",
+			Elements: []slackText{{Type: "mrkdwn", Text: "Sent on " + formatMillis(alert.SentOn)}},
+		})
+	}
+
+	return slackMessage{
+		Text:        chatSummary(notificationType, alert),
+		Attachments: []slackAttachment{{Color: severityColor(alert.Severity), Blocks: blocks}},
+	}
+}
+
+func teamsMessage(notificationType string, alert models.Alert) teamsCard {
+	facts := chatFacts(alert)
+	if alert.SentOn != 0 {
+		facts = append(facts, teamsFact{Name: "Sent on", Value: formatMillis(alert.SentOn)})
+	}
+	for i := range facts {
+		facts[i].Value = html.EscapeString(facts[i].Value)
+	}
+	sections := []teamsSection{{Facts: facts}}
+	if table := textTable(optionalTable(alert.Optional)); table != "" {
+		sections = append(sections, teamsSection{Title: optionalTitle(alert), Text: "<pre>" + html.EscapeString(table) + "</pre>"})
+	}
+
+	return teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    chatSummary(notificationType, alert),
+		ThemeColor: strings.TrimPrefix(severityColor(alert.Severity), "#"),
+		Title:      html.EscapeString(chatTitle(notificationType, alert)),
+		Sections:   sections,
+	}
+}
+
+// chatTitle is the alert description, or what the notification is when it has none such as for heartbeats
+func chatTitle(notificationType string, alert models.Alert) string {
+	if alert.AlertDescription != "" {
+		return alert.AlertDescription
+	}
+	if alert.DeviceID != "" {
+		return notificationType + " from " + alert.DeviceID
+	}
+	return notificationType
+}
+
+// chatSummary is the plain text shown in notifications and clients that cannot show the formatted message
+func chatSummary(notificationType string, alert models.Alert) string {
+	if alert.Severity == "" {
+		return chatTitle(notificationType, alert)
+	}
+	return "[" + alert.Severity + "] " + chatTitle(notificationType, alert)
+}
+
+// chatFacts are the severity, alert number, device and facilities of the alert, leaving out the ones it has not
+func chatFacts(alert models.Alert) []teamsFact {
+	var facts []teamsFact
+	if alert.Severity != "" {
+		facts = append(facts, teamsFact{Name: "Severity", Value: alert.Severity})
+	}
+	if alert.AlertNumber != 0 {
+		facts = append(facts, teamsFact{Name: "Alert number", Value: strconv.Itoa(alert.AlertNumber)})
+	}
+	if alert.DeviceID != "" {
+		facts = append(facts, teamsFact{Name: "Device", Value: alert.DeviceID})
+	}
+	if len(alert.Facilities) > 0 {
+		facts = append(facts, teamsFact{Name: "Facilities", Value: strings.Join(alert.Facilities, ", ")})
+	}
+	return facts
+}
+
+func optionalTitle(alert models.Alert) string {
+	if alert.AlertNumber == NotWhitelisted {
+		return "Not whitelisted products"
+	}
+	return "Details"
+}
+
+func severityColor(severity string) string {
+	if color, found := severityColors[strings.ToLower(severity)]; found {
+		return color
+	}
+	return defaultSeverityColor
+}
+
+// slackEscape escapes the characters Slack uses for its own formatting
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// optionalTable turns the optional details of an alert, such as the list of not whitelisted products,
+// into a header row followed by a row for each item, or nil when there are none
+func optionalTable(optional interface{}) [][]string {
+	switch value := optional.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		if len(value) == 0 {
+			return nil
+		}
+		columns := tableColumns(value)
+		if columns == nil {
+			rows := [][]string{{"value"}}
+			for _, item := range value {
+				rows = append(rows, []string{tableValue(item)})
+			}
+			return rows
+		}
+		rows := [][]string{columns}
+		for _, item := range value {
+			object, _ := item.(map[string]interface{})
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				if field, found := object[column]; found {
+					row[i] = tableValue(field)
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	case map[string]interface{}:
+		if len(value) == 0 {
+			return nil
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		rows := [][]string{{"name", "value"}}
+		for _, name := range names {
+			rows = append(rows, []string{name, tableValue(value[name])})
+		}
+		return rows
+	}
+	return [][]string{{"value"}, {tableValue(optional)}}
+}
+
+// tableColumns returns the sorted field names of the items when they are all objects, otherwise nil
+func tableColumns(items []interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for name := range object {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func tableValue(value interface{}) string {
+	switch value.(type) {
+	case string, float64, bool, nil:
+		return fmt.Sprint(value)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+// textTable lays out the rows as aligned columns under the header row for a monospace font,
+// showing at most maxTableRows rows
+func textTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	omitted := 0
+	if len(rows)-1 > maxTableRows {
+		omitted = len(rows) - 1 - maxTableRows
+		rows = rows[:maxTableRows+1]
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	var table strings.Builder
+	writeRow := func(row []string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell + strings.Repeat(" ", widths[i]-len(cell))
+		}
+		table.WriteString(strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+	}
+	writeRow(rows[0])
+	separator := make([]string, len(widths))
+	for i, width := range widths {
+		separator[i] = strings.Repeat("-", width)
+	}
+	writeRow(separator)
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	if omitted > 0 {
+		table.WriteString("... and " + strconv.Itoa(omitted) + " more\n")
+	}
+	return table.String()
+}
@@ -0,0 +1,121 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+)
+
+const productsTable = "productId\n-------------\n00111111\n2222222222222\n"
+
+func TestDeliverChat(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received, _ = ioutil.ReadAll(request.Body)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+
+	notWhitelisted := models.Alert{
+		AlertNumber:      NotWhitelisted,
+		AlertDescription: "Received a list of ASNs that are not whitelisted!",
+		Severity:         "critical",
+		Facilities:       []string{"front", "back"},
+		DeviceID:         "rrs-gateway",
+		Optional:         []models.ProductID{{ProductID: "00111111"}, {ProductID: "2222222222222"}},
+	}
+	data, err := json.Marshal(notWhitelisted)
+	if err != nil {
+		t.Fatalf("Unable to marshal alert %s", err)
+	}
+	message := delivery.Message{NotificationType: AlertType, Data: data}
+
+	if _, err := DeliverChat(message, routing.Destination{Name: "slack", URL: server.URL, Mode: routing.ModeSlack}); err != nil {
+		t.Fatalf("Error delivering to slack %s", err)
+	}
+	var slack slackMessage
+	if err := json.Unmarshal(received, &slack); err != nil {
+		t.Fatalf("Unable to read slack message %s", err)
+	}
+	if slack.Text != "[critical] Received a list of ASNs that are not whitelisted!" || len(slack.Attachments) != 1 {
+		t.Fatalf("Unexpected slack message %s", received)
+	}
+	attachment := slack.Attachments[0]
+	if attachment.Color != "#D32F2F" {
+		t.Errorf("Expected critical colour, got %s", attachment.Color)
+	}
+	expectedFields := []slackText{
+		{Type: "mrkdwn", Text: "*Severity*\ncritical"},
+		{Type: "mrkdwn", Text: "*Alert number*\n401"},
+		{Type: "mrkdwn", Text: "*Device*\nrrs-gateway"},
+		{Type: "mrkdwn", Text: "*Facilities*\nfront, back"},
+	}
+	if len(attachment.Blocks) != 3 || !reflect.DeepEqual(attachment.Blocks[1].Fields, expectedFields) {
+		t.Fatalf("Unexpected slack blocks %s", received)
+	}
+	if table := attachment.Blocks[2].Text.Text; table != "*Not whitelisted products*\n```\n"+productsTable+"```" {
+		t.Errorf("Unexpected product table %q", table)
+	}
+
+	if _, err := DeliverChat(message, routing.Destination{Name: "teams", URL: server.URL, Mode: routing.ModeTeams}); err != nil {
+		t.Fatalf("Error delivering to teams %s", err)
+	}
+	var teams teamsCard
+	if err := json.Unmarshal(received, &teams); err != nil {
+		t.Fatalf("Unable to read teams card %s", err)
+	}
+	if teams.Type != "MessageCard" || teams.ThemeColor != "D32F2F" || teams.Title != notWhitelisted.AlertDescription || len(teams.Sections) != 2 {
+		t.Fatalf("Unexpected teams card %s", received)
+	}
+	if len(teams.Sections[0].Facts) != 4 || teams.Sections[0].Facts[3] != (teamsFact{Name: "Facilities", Value: "front, back"}) {
+		t.Errorf("Unexpected teams facts %v", teams.Sections[0].Facts)
+	}
+	if teams.Sections[1].Title != "Not whitelisted products" || teams.Sections[1].Text != "<pre>"+productsTable+"</pre>" {
+		t.Errorf("Unexpected teams product table %v", teams.Sections[1])
+	}
+}
+
+func TestOptionalTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		optional string
+		expected string
+	}{
+		{"none", `null`, ""},
+		{"objects", `[{"productId":"1","sku":"A"},{"productId":"22"}]`, "productId  sku\n---------  ---\n1          A\n22\n"},
+		{"values", `["1",2]`, "value\n-----\n1\n2\n"},
+		{"object", `{"reason":"<unknown>","count":3}`, "name    value\n------  ---------\ncount   3\nreason  <unknown>\n"},
+	}
+	for _, test := range tests {
+		var optional interface{}
+		if err := json.Unmarshal([]byte(test.optional), &optional); err != nil {
+			t.Fatalf("Unable to unmarshal %s", test.optional)
+		}
+		if table := textTable(optionalTable(optional)); table != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, table)
+		}
+	}
+
+	items := make([]interface{}, maxTableRows+5)
+	for i := range items {
+		items[i] = "item"
+	}
+	if table := textTable(optionalTable(items)); !strings.HasSuffix(table, "item\n... and 5 more\n") {
+		t.Errorf("Expected long tables to be cut short, got %q", table)
+	}
+}
@@ -0,0 +1,253 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	defaultDeduplicator *Deduplicator
+	deduplicatorMutex   sync.RWMutex
+)
+
+// occurrence tracks the duplicates of an alert seen inside its suppression window
+type occurrence struct {
+	alert       models.Alert
+	gatewayID   string
+	count       int
+	forwarded   int
+	firstSeen   time.Time
+	lastSeen    time.Time
+	windowStart time.Time
+	// previousWindowStart is the start of the window before the latest forwarded alert started a new one
+	previousWindowStart time.Time
+}
+
+// Deduplicator suppresses repeats of the same alert inside a window, counting them instead of forwarding them
+type Deduplicator struct {
+	window  time.Duration
+	mutex   sync.Mutex
+	entries map[string]*occurrence
+}
+
+// NewDeduplicator creates a deduplicator with the given suppression window
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window:  window,
+		entries: make(map[string]*occurrence),
+	}
+}
+
+// SetDefaultDeduplicator sets the deduplicator used by ProcessAlert
+func SetDefaultDeduplicator(deduplicator *Deduplicator) {
+	deduplicatorMutex.Lock()
+	defer deduplicatorMutex.Unlock()
+	defaultDeduplicator = deduplicator
+}
+
+// DefaultDeduplicator returns the deduplicator used by ProcessAlert, or nil if deduplication is not enabled
+func DefaultDeduplicator() *Deduplicator {
+	deduplicatorMutex.RLock()
+	defer deduplicatorMutex.RUnlock()
+	return defaultDeduplicator
+}
+
+// deduplicate observes the alert with the default deduplicator, if deduplication is enabled, returning false
+// for duplicates that are suppressed
+func deduplicate(alert models.Alert, gatewayID string) (models.Alert, bool) {
+	deduplicator := DefaultDeduplicator()
+	if deduplicator == nil {
+		return alert, true
+	}
+	alert, forward := deduplicator.Observe(alert, gatewayID, time.Now())
+	if !forward {
+		log.Debugf("Suppressed duplicate alert %s", Fingerprint(alert))
+	}
+	return alert, forward
+}
+
+// forget undoes the observation of an alert by the default deduplicator, if deduplication is enabled
+func forget(alert models.Alert) {
+	if deduplicator := DefaultDeduplicator(); deduplicator != nil {
+		deduplicator.Forget(alert)
+	}
+}
+
+// Fingerprint identifies alerts that are duplicates of each other: the same device, alert number and severity
+// with the same details, whenever they were sent. Alerts carrying different details, such as the products of
+// not whitelisted ASNs, have different fingerprints so that none of them are lost.
+func Fingerprint(alert models.Alert) string {
+	alert.ID, alert.SentOn = "", 0
+	alert.Occurrences, alert.FirstSeen, alert.LastSeen = 0, 0, 0
+	details, err := json.Marshal(alert)
+	if err != nil {
+		details = []byte(fmt.Sprintf("%+v", alert))
+	}
+	sum := sha256.Sum256(details)
+	return fmt.Sprintf("%s|%d|%s|%x", alert.DeviceID, alert.AlertNumber, alert.Severity, sum[:8])
+}
+
+// Observe records an alert seen at now. It returns the alert to forward with its occurrence count and
+// first/last seen timestamps, and false if the alert is a duplicate inside the suppression window.
+func (deduplicator *Deduplicator) Observe(alert models.Alert, gatewayID string, now time.Time) (models.Alert, bool) {
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	key := Fingerprint(alert)
+	entry, found := deduplicator.entries[key]
+	if found && now.Sub(entry.windowStart) < deduplicator.window {
+		entry.count++
+		entry.lastSeen = now
+		entry.alert = alert
+		entry.gatewayID = gatewayID
+		metrics.GetOrRegisterMeter("Alert.Dedup.Suppressed", nil).Mark(1)
+		return alert, false
+	}
+
+	if !found {
+		entry = &occurrence{firstSeen: now}
+		deduplicator.entries[key] = entry
+	}
+	entry.alert = alert
+	entry.gatewayID = gatewayID
+	entry.count++
+	entry.forwarded = entry.count
+	entry.lastSeen = now
+	entry.previousWindowStart = entry.windowStart
+	entry.windowStart = now
+	return withOccurrences(alert, entry), true
+}
+
+// Forget undoes the observation of an alert Observe returned to forward that was not forwarded after all,
+// so the next one is not suppressed as its duplicate
+func (deduplicator *Deduplicator) Forget(alert models.Alert) {
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	key := Fingerprint(alert)
+	entry, found := deduplicator.entries[key]
+	if !found {
+		return
+	}
+	entry.count--
+	entry.forwarded--
+	entry.windowStart = entry.previousWindowStart
+	if entry.count <= 0 {
+		delete(deduplicator.entries, key)
+	}
+}
+
+// Flush returns the alerts whose suppression window has ended at now with duplicates that were not
+// forwarded yet, and forgets the alerts that have not been seen for a whole window
+func (deduplicator *Deduplicator) Flush(now time.Time) []Notification {
+	return deduplicator.flush(now, false)
+}
+
+// FlushPending returns every alert with duplicates that were not forwarded yet, whether its window has ended or not
+func (deduplicator *Deduplicator) FlushPending(now time.Time) []Notification {
+	return deduplicator.flush(now, true)
+}
+
+func (deduplicator *Deduplicator) flush(now time.Time, pending bool) []Notification {
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	var notifications []Notification
+	for key, entry := range deduplicator.entries {
+		if now.Sub(entry.windowStart) < deduplicator.window && (!pending || entry.count == entry.forwarded) {
+			continue
+		}
+		if entry.count > entry.forwarded {
+			entry.forwarded = entry.count
+			entry.windowStart = now
+			notifications = append(notifications, alertNotification(withOccurrences(entry.alert, entry), entry.gatewayID))
+			continue
+		}
+		delete(deduplicator.entries, key)
+	}
+	return notifications
+}
+
+// Run sends the alerts with suppressed duplicates to the notification channel as their windows end, until stop is closed
+func (deduplicator *Deduplicator) Run(notificationChan chan Notification, stop <-chan struct{}) {
+	interval := deduplicator.window / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, notification := range deduplicator.Flush(now) {
+				alert := notification.Data.(models.Alert)
+				log.WithFields(log.Fields{
+					"Method":      "Run",
+					"DeviceID":    alert.DeviceID,
+					"AlertNumber": alert.AlertNumber,
+					"Occurrences": alert.Occurrences,
+				}).Debug("Forwarding suppressed alert duplicates")
+				select {
+				case notificationChan <- notification:
+				default:
+					// the notifier is behind, try again on the next tick rather than hold up the ticker
+					deduplicator.retry(alert, now)
+				}
+			}
+		}
+	}
+}
+
+// retry marks the duplicates of a flushed alert as not forwarded, to be flushed again once the next tick comes
+func (deduplicator *Deduplicator) retry(alert models.Alert, now time.Time) {
+	deduplicator.mutex.Lock()
+	defer deduplicator.mutex.Unlock()
+
+	if entry, found := deduplicator.entries[Fingerprint(alert)]; found {
+		entry.forwarded--
+		entry.windowStart = now.Add(-deduplicator.window)
+	}
+}
+
+// pendingDuplicates returns the alerts with duplicates the default deduplicator has not forwarded yet
+func pendingDuplicates() []Notification {
+	deduplicator := DefaultDeduplicator()
+	if deduplicator == nil {
+		return nil
+	}
+	return deduplicator.FlushPending(time.Now())
+}
+
+func withOccurrences(alert models.Alert, entry *occurrence) models.Alert {
+	alert.Occurrences = entry.count
+	alert.FirstSeen = entry.firstSeen.UnixNano() / int64(time.Millisecond)
+	alert.LastSeen = entry.lastSeen.UnixNano() / int64(time.Millisecond)
+	return alert
+}
+
+func alertNotification(alert models.Alert, gatewayID string) Notification {
+	return Notification{
+		NotificationMessage: "Process Alert",
+		NotificationType:    AlertType,
+		Data:                alert,
+		GatewayID:           gatewayID,
+		Endpoint:            config.Current().AlertDestination,
+	}
+}
@@ -0,0 +1,91 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+)
+
+// routeNotification returns the destinations a notification is sent to. Notifications no route matches
+// go to the endpoint they were created with, alertDestination or heartbeatDestination.
+func routeNotification(notification Notification) []routing.Destination {
+	if table := routing.DefaultTable(); table != nil {
+		if destinations := table.Resolve(notificationAttributes(notification)); len(destinations) > 0 {
+			return destinations
+		}
+	}
+
+	if notification.Endpoint == "" {
+		return nil
+	}
+	return []routing.Destination{defaultDestination(notification.Endpoint)}
+}
+
+// notificationAttributes returns the properties of the notification routes are matched against
+func notificationAttributes(notification Notification) routing.Attributes {
+	attributes := routing.Attributes{NotificationType: notification.NotificationType, DeviceID: notification.GatewayID}
+	switch data := notification.Data.(type) {
+	case models.Alert:
+		attributes.Severity = data.Severity
+		attributes.AlertNumber = data.AlertNumber
+		attributes.Facilities = data.Facilities
+		if data.DeviceID != "" {
+			attributes.DeviceID = data.DeviceID
+		}
+	case models.Heartbeat:
+		attributes.Facilities = data.Facilities
+		attributes.DeviceID = data.DeviceID
+	}
+	return attributes
+}
+
+// defaultDestination is the destination at the given url, with the alertDestination auth settings
+func defaultDestination(url string) routing.Destination {
+	settings := config.Current()
+	return routing.Destination{
+		Name:         routing.DefaultDestinationName,
+		URL:          url,
+		AuthType:     settings.AlertDestinationAuthType,
+		AuthEndpoint: settings.AlertDestinationAuthEndpoint,
+		ClientID:     settings.AlertDestinationClientID,
+		ClientSecret: settings.AlertDestinationClientSecret,
+	}
+}
+
+// destinationFor returns the current settings of the destination a queued message is sent to
+func destinationFor(message delivery.Message) routing.Destination {
+	if table := routing.DefaultTable(); table != nil && message.Destination != "" {
+		if destination, found := table.Destination(message.Destination); found {
+			return destination
+		}
+	}
+	return defaultDestination(message.Endpoint)
+}
+
+// forDestination addresses a message to one of the destinations of its notification
+func forDestination(message delivery.Message, destination routing.Destination) delivery.Message {
+	message.Destination = destination.Name
+	message.Endpoint = destination.URL
+	return message
+}
+
+// newDelivery is the outcome of sending a notification to a destination, with the response of the destination
+func newDelivery(destination routing.Destination, response delivery.Response, sendErr error) history.Delivery {
+	delivered := history.Delivery{Destination: destination.Name, URL: destination.URL, Outcome: history.Delivered}
+	if sendErr != nil {
+		delivered.Outcome = history.Failed
+		delivered.Error = sendErr.Error()
+		response = delivery.ResponseOf(sendErr)
+	}
+	delivered.StatusCode = response.StatusCode
+	delivered.Response = response.Body
+	return delivered
+}
@@ -0,0 +1,254 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEmailSubject = `[{{.Severity}}] Alert {{.AlertNumber}} from {{.DeviceID}}`
+
+	defaultEmailText = `{{.AlertDescription}}
+
+Alert number: {{.AlertNumber}}
+Severity: {{.Severity}}
+Device: {{.DeviceID}}
+Facilities: {{join .Facilities ", "}}
+Sent on: {{time .SentOn}}
+`
+
+	defaultSMTPPort = "25"
+)
+
+// emailFuncs are the functions the email templates can use besides the builtin ones
+var emailFuncs = map[string]interface{}{
+	"join": strings.Join,
+	// time formats the milliseconds since epoch of the alert timestamps
+	"time": formatMillis,
+}
+
+// formatMillis formats milliseconds since epoch, such as the sent_on of alerts, as a UTC time
+func formatMillis(millis int64) string {
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC1123)
+}
+
+// SendEmail renders the alert of the message with the templates of the destination and emails it
+// through the SMTP server at the destination url to the recipients of its facilities and severity
+func SendEmail(message delivery.Message, destination routing.Destination) error {
+	// Metrics
+	metrics.GetOrRegisterGauge("Alert.SendEmail.Attempt", nil).Update(1)
+	startTime := time.Now()
+	defer metrics.GetOrRegisterTimer("Alert.SendEmail.Latency", nil).UpdateSince(startTime)
+	mSuccess := metrics.GetOrRegisterGauge("Alert.SendEmail.Success", nil)
+	mSendErr := metrics.GetOrRegisterGauge("Alert.SendEmail.Send-Error", nil)
+
+	var alert models.Alert
+	if err := json.Unmarshal(message.Data, &alert); err != nil {
+		mSendErr.Update(1)
+		return errors.Wrapf(err, "unable to read notification for %s", destination.Name)
+	}
+
+	settings := destination.Email
+	recipients := settings.Addresses(routing.Attributes{
+		NotificationType: message.NotificationType,
+		Severity:         alert.Severity,
+		AlertNumber:      alert.AlertNumber,
+		Facilities:       alert.Facilities,
+		DeviceID:         alert.DeviceID,
+	})
+	if len(recipients) == 0 {
+		mSendErr.Update(1)
+		return errors.Errorf("no email recipients for %s", destination.Name)
+	}
+
+	body, err := renderEmail(settings, recipients, alert)
+	if err != nil {
+		mSendErr.Update(1)
+		return errors.Wrapf(err, "unable to render email for %s", destination.Name)
+	}
+	if err := sendSMTP(destination, recipients, body); err != nil {
+		mSendErr.Update(1)
+		return err
+	}
+
+	log.Debugf("Notification emailed to %d recipients of %s", len(recipients), destination.Name)
+	mSuccess.Update(1)
+	return nil
+}
+
+// renderEmail builds the email of the alert, with a text part and an html part when there is an html template
+func renderEmail(settings routing.Email, recipients []string, alert models.Alert) ([]byte, error) {
+	subject, err := renderText("subject", settings.Subject, defaultEmailSubject, alert)
+	if err != nil {
+		return nil, err
+	}
+	text, err := renderText("text", settings.TextTemplate, defaultEmailText, alert)
+	if err != nil {
+		return nil, err
+	}
+
+	var html bytes.Buffer
+	if settings.HTMLTemplate != "" {
+		htmlTemplate, err := htmltemplate.New("html").Funcs(emailFuncs).Parse(settings.HTMLTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if err := htmlTemplate.Execute(&html, alert); err != nil {
+			return nil, err
+		}
+	}
+
+	var email bytes.Buffer
+	parts := multipart.NewWriter(&email)
+	email.WriteString("From: " + settings.From + "\r\n")
+	email.WriteString("To: " + strings.Join(recipients, ", ") + "\r\n")
+	email.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)) + "\r\n")
+	email.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	email.WriteString("MIME-Version: 1.0\r\n")
+	email.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+
+	if err := writeEmailPart(parts, "text/plain; charset=utf-8", text); err != nil {
+		return nil, err
+	}
+	if html.Len() > 0 {
+		if err := writeEmailPart(parts, "text/html; charset=utf-8", html.String()); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return email.Bytes(), nil
+}
+
+func renderText(name string, text string, defaultText string, alert models.Alert) (string, error) {
+	if text == "" {
+		text = defaultText
+	}
+	textTemplate, err := template.New(name).Funcs(emailFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := textTemplate.Execute(&rendered, alert); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+func writeEmailPart(parts *multipart.Writer, contentType string, content string) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// sendSMTP sends the email to the recipients through the SMTP server at the destination url,
+// upgrading the connection with STARTTLS whenever the server supports it
+func sendSMTP(destination routing.Destination, recipients []string, body []byte) error {
+	server, err := url.Parse(destination.URL)
+	if err != nil || server.Scheme != "smtp" || server.Hostname() == "" {
+		return errors.Errorf("destination %s url must be smtp://host:port", destination.Name)
+	}
+	host := server.Hostname()
+	port := server.Port()
+	if port == "" {
+		port = defaultSMTPPort
+	}
+
+	timeout := time.Duration(connectionTimeout) * time.Second
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return errors.Wrapf(err, "unable to connect to %s", destination.Name)
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return errors.Wrapf(err, "unable to start smtp session with %s", destination.Name)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if supported, _ := client.Extension("STARTTLS"); supported {
+		tlsConfig, err := newTLSConfig(destination.TLS)
+		if err != nil {
+			return errors.Wrapf(err, "unable to load tls settings of %s", destination.Name)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return errors.Wrapf(err, "unable to start tls with %s", destination.Name)
+		}
+	} else if destination.Email.StartTLS {
+		return errors.Errorf("destination %s does not support STARTTLS", destination.Name)
+	}
+
+	if destination.Email.Username != "" {
+		auth := smtp.PlainAuth("", destination.Email.Username, destination.Email.Password, host)
+		if err := client.Auth(auth); err != nil {
+			return errors.Wrapf(err, "unable to authenticate with %s", destination.Name)
+		}
+	}
+
+	if err := client.Mail(destination.Email.From); err != nil {
+		return errors.Wrapf(err, "sender rejected by %s", destination.Name)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return errors.Wrapf(err, "recipient %s rejected by %s", recipient, destination.Name)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return errors.Wrapf(err, "unable to send email to %s", destination.Name)
+	}
+	if _, err := writer.Write(body); err != nil {
+		return errors.Wrapf(err, "unable to send email to %s", destination.Name)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrapf(err, "email rejected by %s", destination.Name)
+	}
+	return client.Quit()
+}
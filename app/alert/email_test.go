@@ -0,0 +1,201 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+)
+
+// sentEmail is an email received by the test SMTP server
+type sentEmail struct {
+	from       string
+	recipients []string
+	data       []byte
+}
+
+// testSMTPServer is a local stand-in for an SMTP server, accepting PLAIN auth with the expected credentials
+// and keeping the emails sent to it
+type testSMTPServer struct {
+	listener net.Listener
+	username string
+	password string
+	mutex    sync.Mutex
+	sent     []sentEmail
+}
+
+func newTestSMTPServer(t *testing.T, username string, password string) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen %s", err)
+	}
+	server := &testSMTPServer{listener: listener, username: username, password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *testSMTPServer) url() string {
+	return "smtp://" + server.listener.Addr().String()
+}
+
+func (server *testSMTPServer) close() {
+	_ = server.listener.Close()
+}
+
+func (server *testSMTPServer) emails() []sentEmail {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]sentEmail(nil), server.sent...)
+}
+
+func (server *testSMTPServer) serve(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	var email sentEmail
+	_ = text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case command == "EHLO":
+			_ = text.PrintfLine("250-localhost")
+			_ = text.PrintfLine("250 AUTH PLAIN")
+		case strings.HasPrefix(strings.ToUpper(line), "AUTH PLAIN "):
+			credentials, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			if string(credentials) != "\x00"+server.username+"\x00"+server.password {
+				_ = text.PrintfLine("535 authentication failed")
+				continue
+			}
+			_ = text.PrintfLine("235 authenticated")
+		case command == "MAIL":
+			email = sentEmail{from: strings.Trim(line[strings.Index(line, ":")+1:], "<>")}
+			_ = text.PrintfLine("250 ok")
+		case command == "RCPT":
+			email.recipients = append(email.recipients, strings.Trim(line[strings.Index(line, ":")+1:], "<>"))
+			_ = text.PrintfLine("250 ok")
+		case command == "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			email.data, err = text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			server.mutex.Lock()
+			server.sent = append(server.sent, email)
+			server.mutex.Unlock()
+			_ = text.PrintfLine("250 ok")
+		case command == "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	server := newTestSMTPServer(t, "alerts", "secret")
+	defer server.close()
+
+	destination := routing.Destination{
+		Name: "managers",
+		URL:  server.url(),
+		Mode: routing.ModeEmail,
+		Email: routing.Email{
+			From: "alerts@example.com",
+			To:   []string{"ops@example.com"},
+			Recipients: []routing.Recipients{
+				{Match: routing.Match{Facilities: []string{"front"}, Severities: []string{"urgent"}}, To: []string{"front@example.com"}},
+			},
+			HTMLTemplate: `<p>{{.AlertDescription}} in {{join .Facilities ", "}}</p>`,
+			Username:     "alerts",
+			Password:     "secret",
+		},
+	}
+	message := delivery.Message{
+		NotificationType: AlertType,
+		Data:             []byte(`{"alert_number":322,"severity":"urgent","device_id":"rrs-gateway","alert_description":"Gateway <rrs-gateway> deregistered","facilities":["front"]}`),
+	}
+	if err := SendEmail(message, destination); err != nil {
+		t.Fatalf("Error sending email %s", err)
+	}
+
+	emails := server.emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	if emails[0].from != "alerts@example.com" || !reflect.DeepEqual(emails[0].recipients, []string{"front@example.com"}) {
+		t.Errorf("Expected email from alerts@example.com to front@example.com, got %s to %v", emails[0].from, emails[0].recipients)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(emails[0].data))
+	if err != nil {
+		t.Fatalf("Unable to read email %s", err)
+	}
+	if subject := parsed.Header.Get("Subject"); subject != "[urgent] Alert 322 from rrs-gateway" {
+		t.Errorf("Unexpected subject %s", subject)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Unable to read content type %s", err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	expected := map[string]string{
+		"text/plain; charset=utf-8": "Gateway <rrs-gateway> deregistered\n\nAlert number: 322",
+		"text/html; charset=utf-8":  "<p>Gateway &lt;rrs-gateway&gt; deregistered in front</p>",
+	}
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(part)
+		contentType := part.Header.Get("Content-Type")
+		if !strings.HasPrefix(strings.Replace(string(content), "\r\n", "\n", -1), expected[contentType]) {
+			t.Errorf("Unexpected %s part %q", contentType, content)
+		}
+		delete(expected, contentType)
+	}
+	if len(expected) > 0 {
+		t.Errorf("Missing parts %v", expected)
+	}
+
+	rejected := destination
+	rejected.Email.Password = "wrong"
+	if err := SendEmail(message, rejected); err == nil {
+		t.Error("Expected error authenticating with the wrong password")
+	}
+	requireTLS := destination
+	requireTLS.Email.StartTLS = true
+	if err := SendEmail(message, requireTLS); err == nil {
+		t.Error("Expected error when the server does not support STARTTLS")
+	}
+}
@@ -8,15 +8,22 @@ package alert
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
@@ -29,9 +36,14 @@ const (
 	//
 	connectionTimeout = 15
 	// Not Whitelisted Alert Type
-	NotWhitelisted = 401
+	NotWhitelisted = catalog.NotWhitelisted
+	// drainPoll is how long Drain waits at a time for the notifications Send has not put in the channel yet
+	drainPoll = 10 * time.Millisecond
 )
 
+// waitingSends counts the notifications Send is waiting to put in the full channel
+var waitingSends int64
+
 // ProcessAlert takes alert json bytes and post to notification channel
 func ProcessAlert(jsonBytes *[]byte, notificationChan chan Notification) error {
 	// Metrics
@@ -44,14 +56,53 @@ func ProcessAlert(jsonBytes *[]byte, notificationChan chan Notification) error {
 	jsoned := string(*jsonBytes)
 	log.Debugf("Received alert:\n%s", jsoned)
 
-	var data map[string]interface{}
-
-	var gatewayID string
-	if err := json.Unmarshal(*jsonBytes, &data); err != nil {
+	alertEvent, gatewayID, err := parseAlert(*jsonBytes)
+	if err != nil {
 		log.Errorf("error parsing Alert %s", err)
 		mUnmarshalErr.Update(1)
 		return err
 	}
+	alertEvent, forward := deduplicate(alertEvent, gatewayID)
+	if !forward {
+		mSuccess.Update(1)
+		return nil
+	}
+
+	Send(notificationChan, alertNotification(alertEvent, gatewayID))
+
+	log.Debug("Processed alert")
+	mSuccess.Update(1)
+	return nil
+}
+
+// Send puts the notification in the channel without holding up the caller. When the channel is full the
+// notification waits for room in the background, and Drain waits for it like it does for the notifications
+// in the channel, counting it as dropped if it is still waiting at the deadline.
+func Send(notificationChan chan Notification, notification Notification) {
+	select {
+	case notificationChan <- notification:
+		return
+	default:
+	}
+
+	atomic.AddInt64(&waitingSends, 1)
+	go func() {
+		defer atomic.AddInt64(&waitingSends, -1)
+		notificationChan <- notification
+	}()
+}
+
+// WaitingSends returns the number of notifications sent while the channel was full that are still waiting for room
+func WaitingSends() int {
+	return int(atomic.LoadInt64(&waitingSends))
+}
+
+// parseAlert reads an alert and the id of the gateway that raised it
+func parseAlert(jsonBytes []byte) (models.Alert, string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &data); err != nil {
+		return models.Alert{}, "", err
+	}
 
 	gatewayID, ok := data["gateway_id"].(string)
 	if !ok {
@@ -60,69 +111,416 @@ func ProcessAlert(jsonBytes *[]byte, notificationChan chan Notification) error {
 	}
 
 	var alertEvent models.Alert
-	err := json.Unmarshal(*jsonBytes, &alertEvent)
-	if err != nil {
-		log.Errorf("error parsing Alert %s", err)
-		mUnmarshalErr.Update(1)
-		return err
+	if err := json.Unmarshal(jsonBytes, &alertEvent); err != nil {
+		return models.Alert{}, "", err
 	}
-	go func() {
-		notificationChan <- Notification{
-			NotificationMessage: "Process Alert",
-			NotificationType:    AlertType,
-			Data:                alertEvent,
-			GatewayID:           gatewayID,
-			Endpoint:            config.AppConfig.AlertDestination,
-		}
-	}()
-
-	log.Debug("Processed alert")
-	mSuccess.Update(1)
-	return nil
+	return alertEvent, gatewayID, nil
 }
 
-// NotifyChannel iterates through messages in the notification channel and post to cloud connector
+// NotifyChannel iterates through messages in the notification channel and queues them for delivery to the cloud connector
 func NotifyChannel(notificationChan chan Notification) {
-	// CloudConnector URL to send alerts
-	cloudConnectorEndpoint := config.AppConfig.CloudConnectorURL + config.AppConfig.CloudConnectorEndpoint
-	notificationChanSize := config.AppConfig.NotificationChanSize
+	NotifyChannelUntil(notificationChan, nil)
+}
 
-	for notification := range notificationChan {
-		if len(notificationChan) >= notificationChanSize-10 {
-			log.WithFields(log.Fields{
-				"notificationChanSize": len(notificationChan),
-				"maxChannelSize":       notificationChanSize,
-			}).Warn("Channel size getting full!")
+// NotifyChannelUntil is NotifyChannel returning once stop is closed, leaving the notifications still in the channel to Drain
+func NotifyChannelUntil(notificationChan chan Notification, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case notification, ok := <-notificationChan:
+			if !ok {
+				return
+			}
+			notify(notificationChan, notification)
 		}
-		generateErr := notification.GeneratePayload()
-		if generateErr != nil {
-			log.Errorf("Problem generating payload for %s, %s", notification.NotificationType, generateErr)
-		} else {
-
-			dataBytes, err := json.MarshalIndent(notification.Data, "", "    ")
-			if err != nil {
-				log.Errorf("unable to marshal. %s", err)
+	}
+}
+
+// Drain queues, or sends when there is no delivery queue, the notifications left in the channel once it is no longer read,
+// along with the ones Send is still waiting to put in it, then the alerts with duplicates the deduplicator has not
+// forwarded yet, until they are all flushed or the deadline passes. It returns how many notifications were flushed
+// and how many were left at the deadline.
+func Drain(notificationChan chan Notification, deadline time.Time) (flushed int, dropped int) {
+	pending := pendingDuplicates()
+
+	drained := false
+	for !drained && time.Now().Before(deadline) {
+		select {
+		case notification, ok := <-notificationChan:
+			if !ok {
+				drained = true
+				break
+			}
+			notify(notificationChan, notification)
+			flushed++
+		default:
+			// a send is only done waiting once its notification is in the channel
+			if WaitingSends() == 0 {
+				drained = len(notificationChan) == 0
+				break
+			}
+			select {
+			case notification := <-notificationChan:
+				notify(notificationChan, notification)
+				flushed++
+			case <-time.After(drainPoll):
 			}
+		}
+	}
+	if !drained {
+		return flushed, len(notificationChan) + WaitingSends() + len(pending)
+	}
+
+	for i, notification := range pending {
+		if !time.Now().Before(deadline) {
+			return flushed, len(pending) - i
+		}
+		notify(notificationChan, notification)
+		flushed++
+	}
+	return flushed, 0
+}
 
-			cloudConnectorPayload := getCloudConnectorPayload(dataBytes)
-			if cloudConnectorPayload.URL != "" {
-				cloudConnectorPayloadBytes, err := json.MarshalIndent(cloudConnectorPayload, "", "    ")
-				if err != nil {
-					log.Errorf("unable to marshal. %s", err)
-				}
-				_, err = PostNotification(cloudConnectorPayloadBytes, cloudConnectorEndpoint)
-				if err != nil {
-					log.Errorf("Problem sending notification for %s, %s", notification.NotificationMessage, err)
-				}
-			} else {
-				log.Warn("Payload for Cloud Connector doesn't include a destination URL.  Not sending POST message to Cloud Connector.")
+// notify records the notification and queues it for, or without a delivery queue sends it to, each of its destinations
+func notify(notificationChan chan Notification, notification Notification) {
+	notificationChanSize := config.Current().NotificationChanSize
+	if len(notificationChan) >= notificationChanSize-10 {
+		log.WithFields(log.Fields{
+			"notificationChanSize": len(notificationChan),
+			"maxChannelSize":       notificationChanSize,
+		}).Warn("Channel size getting full!")
+	}
+
+	notification = withAlertID(notification)
+	notification = withAlertType(notification)
+	if alertData, ok := notification.Data.(models.Alert); ok {
+		// submitted alerts are no longer waiting once recorded in the alert history
+		defer setSubmitted(alertData.ID, false)
+	}
+	message, err := newMessage(notification)
+	if err != nil {
+		log.Errorf("Problem generating payload for %s, %s", notification.NotificationType, err)
+		recordAlert(notification, history.Failed, err, nil)
+		return
+	}
+	destinations := routeNotification(notification)
+	if len(destinations) == 0 {
+		log.Warn("Payload for Cloud Connector doesn't include a destination URL.  Not sending POST message to Cloud Connector.")
+		recordAlert(notification, history.NotSent, nil, nil)
+		return
+	}
+
+	queue := delivery.DefaultQueue()
+	if queue == nil {
+		// without a delivery queue notifications are sent once, as they are received
+		deliveries := make([]history.Delivery, 0, len(destinations))
+		for _, destination := range destinations {
+			response, sendErr := DeliverMessage(forDestination(message, destination))
+			if sendErr != nil {
+				log.Errorf("Problem sending notification for %s to %s, %s", notification.NotificationMessage, destination.Name, sendErr)
 			}
+			deliveries = append(deliveries, newDelivery(destination, response, sendErr))
+		}
+		recordAlert(notification, "", nil, deliveries)
+		return
+	}
+
+	deliveries := make([]history.Delivery, 0, len(destinations))
+	for _, destination := range destinations {
+		deliveries = append(deliveries, history.Delivery{Destination: destination.Name, URL: destination.URL, Outcome: history.Queued})
+	}
+	historyID := recordAlert(notification, "", nil, deliveries)
+	for _, destination := range destinations {
+		destinationMessage := forDestination(message, destination)
+		destinationMessage.HistoryID = historyID
+		if _, err := queue.Enqueue(destinationMessage); err != nil {
+			log.Errorf("Problem queueing notification for %s, %s", notification.NotificationMessage, err)
+			updateAlertOutcome(historyID, destination.Name, history.Failed, delivery.Response{}, err)
+		}
+	}
+}
+
+// NewDeliveryWorker creates the worker that delivers the messages in the queue to the cloud connector,
+// retrying with the backoff set in the configuration
+func NewDeliveryWorker(queue *delivery.Queue) *delivery.Worker {
+	settings := config.Current()
+	return &delivery.Worker{
+		Queue: queue,
+		Backoff: delivery.Backoff{
+			Initial:    time.Duration(settings.DeliveryInitialBackoffMillis) * time.Millisecond,
+			Max:        time.Duration(settings.DeliveryMaxBackoffMillis) * time.Millisecond,
+			Multiplier: settings.DeliveryBackoffMultiplier,
+			Jitter:     settings.DeliveryBackoffJitter,
+		},
+		MaxAttempts: settings.DeliveryMaxAttempts,
+		DeadLetters: delivery.DefaultDeadLetters(),
+		Send:        DeliverMessage,
+		OnDelivered: func(message delivery.Message, response delivery.Response) {
+			updateAlertOutcome(message.HistoryID, message.Destination, history.Delivered, response, nil)
+		},
+		OnFailed: func(message delivery.Message, err error) {
+			updateAlertOutcome(message.HistoryID, message.Destination, history.Failed, delivery.ResponseOf(err), err)
+		},
+	}
+}
+
+// ReplayDeadLetter puts the dead letter with the given id back in the delivery queue
+func ReplayDeadLetter(id string) (delivery.Message, error) {
+	deadLetters, queue := delivery.DefaultDeadLetters(), delivery.DefaultQueue()
+	if deadLetters == nil || queue == nil {
+		return delivery.Message{}, errors.New("delivery queue is not enabled")
+	}
+
+	message, err := deadLetters.Replay(id, queue)
+	if err != nil {
+		return message, err
+	}
+	updateAlertOutcome(message.HistoryID, message.Destination, history.Queued, delivery.Response{}, nil)
+	return message, nil
+}
+
+// ReplayAllDeadLetters puts every dead letter back in the delivery queue
+func ReplayAllDeadLetters() ([]delivery.Message, error) {
+	deadLetters, queue := delivery.DefaultDeadLetters(), delivery.DefaultQueue()
+	if deadLetters == nil || queue == nil {
+		return nil, errors.New("delivery queue is not enabled")
+	}
+
+	replayed, err := deadLetters.ReplayAll(queue)
+	for _, message := range replayed {
+		updateAlertOutcome(message.HistoryID, message.Destination, history.Queued, delivery.Response{}, nil)
+	}
+	return replayed, err
+}
+
+// newMessage converts a notification into a message for the delivery queue, to be sent to each of its destinations
+func newMessage(notification Notification) (delivery.Message, error) {
+	data, err := json.Marshal(notification.Data)
+	if err != nil {
+		return delivery.Message{}, errors.Wrap(err, "unable to marshal notification data")
+	}
+
+	return delivery.Message{
+		NotificationType:    notification.NotificationType,
+		NotificationMessage: notification.NotificationMessage,
+		GatewayID:           notification.GatewayID,
+		Endpoint:            notification.Endpoint,
+		Data:                data,
+	}, nil
+}
+
+// DeliverMessage sends the message to its destination the way the destination mode says, returning the
+// response of destinations reached over HTTP
+func DeliverMessage(message delivery.Message) (delivery.Response, error) {
+	destination := destinationFor(message)
+	switch destinationMode(destination) {
+	case routing.ModeWebhook:
+		return DeliverWebhook(message, destination)
+	case routing.ModeMQTT:
+		return delivery.Response{}, PublishMQTT(message, destination)
+	case routing.ModeEmail:
+		return delivery.Response{}, SendEmail(message, destination)
+	case routing.ModeSlack, routing.ModeTeams:
+		return DeliverChat(message, destination)
+	}
+	return deliverCloudConnector(message, destination)
+}
+
+// deliverCloudConnector wraps the message in a cloud connector payload and posts it to the cloud connector
+func deliverCloudConnector(message delivery.Message, destination routing.Destination) (delivery.Response, error) {
+	// CloudConnector URL to send alerts
+	settings := config.Current()
+	cloudConnectorEndpoint := settings.CloudConnectorURL + settings.CloudConnectorEndpoint
+
+	notification := Notification{
+		NotificationType:    message.NotificationType,
+		NotificationMessage: message.NotificationMessage,
+		Data:                message.Data,
+		GatewayID:           message.GatewayID,
+		Endpoint:            destination.URL,
+	}
+	if err := notification.GeneratePayload(); err != nil {
+		return delivery.Response{}, err
+	}
+
+	dataBytes, err := json.MarshalIndent(notification.Data, "", "    ")
+	if err != nil {
+		return delivery.Response{}, errors.Wrap(err, "unable to marshal")
+	}
+
+	cloudConnectorPayload := getCloudConnectorPayload(dataBytes, destination)
+	cloudConnectorPayloadBytes, err := json.MarshalIndent(cloudConnectorPayload, "", "    ")
+	if err != nil {
+		return delivery.Response{}, errors.Wrap(err, "unable to marshal")
+	}
+
+	response, _, err := postNotification(cloudConnectorPayloadBytes, cloudConnectorEndpoint)
+	recordCloudConnectorDelivery(err)
+	return response, err
+}
+
+// CloudConnectorDelivery is the result of the latest post to the cloud connector
+type CloudConnectorDelivery struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+	// ConsecutiveFailures is the number of posts in a row that failed, up to and including the latest
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+var (
+	lastCloudConnectorDelivery      *CloudConnectorDelivery
+	lastCloudConnectorDeliveryMutex sync.RWMutex
+)
+
+func recordCloudConnectorDelivery(err error) {
+	result := &CloudConnectorDelivery{At: time.Now()}
+	lastCloudConnectorDeliveryMutex.Lock()
+	defer lastCloudConnectorDeliveryMutex.Unlock()
+	if err != nil {
+		result.Error = err.Error()
+		result.ConsecutiveFailures = 1
+		if lastCloudConnectorDelivery != nil {
+			result.ConsecutiveFailures += lastCloudConnectorDelivery.ConsecutiveFailures
 		}
 	}
+	lastCloudConnectorDelivery = result
+}
+
+// LastCloudConnectorDelivery returns the result of the latest post to the cloud connector,
+// or false when nothing has been posted to it yet
+func LastCloudConnectorDelivery() (CloudConnectorDelivery, bool) {
+	lastCloudConnectorDeliveryMutex.RLock()
+	defer lastCloudConnectorDeliveryMutex.RUnlock()
+	if lastCloudConnectorDelivery == nil {
+		return CloudConnectorDelivery{}, false
+	}
+	return *lastCloudConnectorDelivery, true
+}
+
+// recordAlert saves alert notifications in the alert history, if it is enabled, and returns the record id.
+// Without an outcome, the outcome of the record is worked out from its deliveries.
+func recordAlert(notification Notification, outcome string, notifyErr error, deliveries []history.Delivery) string {
+	store := history.DefaultStore()
+	if store == nil || notification.NotificationType != AlertType {
+		return ""
+	}
+	alertData, ok := notification.Data.(models.Alert)
+	if !ok {
+		return ""
+	}
+
+	urls := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		urls = append(urls, delivery.URL)
+	}
+	record := history.Record{
+		ID:          alertData.ID,
+		Alert:       alertData,
+		GatewayID:   notification.GatewayID,
+		Destination: strings.Join(urls, ","),
+		Outcome:     outcome,
+		Deliveries:  deliveries,
+	}
+	if len(deliveries) == 0 {
+		record.Destination = notification.Endpoint
+	}
+	if notifyErr != nil {
+		record.Error = notifyErr.Error()
+	}
+	record, err := store.Add(record)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "recordAlert",
+			"Action": "Add alert record",
+			"Error":  err.Error(),
+		}).Error("unable to record alert in history")
+		return ""
+	}
+	return record.ID
+}
+
+// withAlertID gives alert notifications the stable id they are known by downstream and in the alert history
+func withAlertID(notification Notification) Notification {
+	if alertData, ok := notification.Data.(models.Alert); ok && alertData.ID == "" {
+		alertData.ID = uuid.New()
+		notification.Data = alertData
+	}
+	return notification
+}
+
+// withAlertType fills in alert notifications from the alert catalog entry of their alert number
+func withAlertType(notification Notification) Notification {
+	if alertData, ok := notification.Data.(models.Alert); ok {
+		notification.Data = models.EnrichAlert(alertData)
+	}
+	return notification
+}
+
+// ResolveGatewayDeregistered resolves the open deregistered alerts of a gateway once it registers again
+func ResolveGatewayDeregistered(gatewayID string) {
+	store := history.DefaultStore()
+	if store == nil {
+		return
+	}
+
+	filter := history.Filter{AlertNumber: models.GatewayDeregisteredAlertNumber, DeviceID: gatewayID}
+	resolved, err := store.ResolveOpen(filter, "watchdog", "Gateway "+gatewayID+" registered again")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method":    "ResolveGatewayDeregistered",
+			"GatewayID": gatewayID,
+			"Error":     err.Error(),
+		}).Error("unable to resolve gateway deregistered alerts")
+		return
+	}
+	if len(resolved) > 0 {
+		log.Debugf("Resolved %d deregistered alerts of gateway %s", len(resolved), gatewayID)
+	}
+}
+
+// updateAlertOutcome sets the outcome of an alert in the history, with the response of the destination,
+// once its delivery to a destination completes
+func updateAlertOutcome(historyID string, destination string, outcome string, response delivery.Response, outcomeErr error) {
+	store := history.DefaultStore()
+	if store == nil || historyID == "" {
+		return
+	}
+
+	var errMessage string
+	if outcomeErr != nil {
+		errMessage = outcomeErr.Error()
+	}
+	var err error
+	if destination == "" {
+		// messages queued before routing was introduced have no destination
+		err = store.UpdateOutcome(historyID, outcome, errMessage)
+	} else {
+		err = store.UpdateDelivery(historyID, history.Delivery{
+			Destination: destination,
+			Outcome:     outcome,
+			Error:       errMessage,
+			StatusCode:  response.StatusCode,
+			Response:    response.Body,
+		})
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "updateAlertOutcome",
+			"Action": "Update alert record",
+			"Error":  err.Error(),
+		}).Error("unable to update alert outcome in history")
+	}
 }
 
 // PostNotification post notification data vial http call to the toURL
 func PostNotification(data []byte, toURL string) ([]byte, error) {
+	_, responseData, err := postNotification(data, toURL)
+	return responseData, err
+}
+
+// postNotification posts the data to the toURL, returning the response kept in the alert history along with its whole body
+func postNotification(data []byte, toURL string) (delivery.Response, []byte, error) {
 	// Metrics
 	metrics.GetOrRegisterGauge("Alert.PostNotification.Attempt", nil).Update(1)
 	startTime := time.Now()
@@ -138,29 +536,15 @@ func PostNotification(data []byte, toURL string) ([]byte, error) {
 	log.Debugf("Payload to cloud-connector after marshalling:\n%s", string(data))
 	request, err := http.NewRequest("POST", toURL, bytes.NewBuffer(data))
 	if err != nil {
-		return nil, err
+		return delivery.Response{}, nil, err
 	}
 	request.Header.Set("content-type", jsonApplication)
+	signRequest(request, data)
 	response, respErr := client.Do(request)
 	if respErr != nil {
 		mNotifyErr.Update(1)
-		return nil, respErr
-	}
-
-	if response.StatusCode != http.StatusOK {
-		mNotifyErr.Update(1)
-		return nil, errors.Errorf("PostNotification failed with following response code %d", response.StatusCode)
-
-	}
-
-	var responseData []byte
-	if response.Body != nil {
-		responseData, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to ReadALL response.Body")
-		}
+		return delivery.Response{}, nil, respErr
 	}
-
 	defer func() {
 		if err := response.Body.Close(); err != nil {
 			log.WithFields(log.Fields{
@@ -170,12 +554,25 @@ func PostNotification(data []byte, toURL string) ([]byte, error) {
 		}
 	}()
 
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		mNotifyErr.Update(1)
+		rejected := delivery.ReadResponse(response.StatusCode, response.Body)
+		return delivery.Response{}, nil, &delivery.StatusError{StatusCode: rejected.StatusCode, Body: rejected.Body}
+	}
+
+	responseData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return delivery.Response{}, nil, errors.Wrapf(err, "unable to ReadALL response.Body")
+	}
+
 	log.Debug("Notification posted")
 	mSuccess.Update(1)
-	return responseData, nil
+	return delivery.NewResponse(response.StatusCode, responseData), responseData, nil
 }
 
-func getCloudConnectorPayload(dataBytes []byte) models.CloudConnectorPayload {
+// getCloudConnectorPayload reads the payload for the cloud connector from the data, with the auth
+// the cloud connector authorizes its request to the destination with
+func getCloudConnectorPayload(dataBytes []byte, destination routing.Destination) models.CloudConnectorPayload {
 
 	var cloudConnectorPayload models.CloudConnectorPayload
 
@@ -186,21 +583,7 @@ func getCloudConnectorPayload(dataBytes []byte) models.CloudConnectorPayload {
 	}
 
 	// Unmarshal the auth data into the auth model for the cloud connector service to consume.
-	if config.AppConfig.AlertDestinationAuthEndpoint != "" &&
-		config.AppConfig.AlertDestinationAuthType != "" &&
-		config.AppConfig.AlertDestinationClientID != "" &&
-		config.AppConfig.AlertDestinationClientSecret != "" {
-		// Encode the endpoint credentials as base64
-		authDataString := config.AppConfig.AlertDestinationClientID + ":" + config.AppConfig.AlertDestinationClientSecret
-		authData := "basic " + base64.StdEncoding.EncodeToString([]byte(authDataString))
-
-		var newAuth models.Auth
-		newAuth.Endpoint = config.AppConfig.AlertDestinationAuthEndpoint
-		newAuth.AuthType = config.AppConfig.AlertDestinationAuthType
-		newAuth.Data = authData
-
-		cloudConnectorPayload.Auth = newAuth
-	}
+	cloudConnectorPayload.Auth = cloudConnectorAuth(destination)
 
 	return cloudConnectorPayload
 }
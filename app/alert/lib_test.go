@@ -7,21 +7,30 @@
 package alert
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestMain(m *testing.M) {
-	if err := config.InitConfig(); err != nil {
+	if err := config.InitConfig("", ""); err != nil {
 		log.WithFields(log.Fields{
 			"Method": "config.InitConfig",
 			"Action": "Load config",
@@ -31,11 +40,24 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// changeConfig changes the current configuration, returning the function that restores it
+func changeConfig(change func(settings *config.Variables)) func() {
+	previous := config.Current()
+	settings := previous
+	change(&settings)
+	config.Set(settings)
+	return func() {
+		config.Set(previous)
+	}
+}
+
 func Test_processAlert(t *testing.T) {
-	notificationChan := make(chan Notification, config.AppConfig.NotificationChanSize)
+	notificationChan := make(chan Notification, config.Current().NotificationChanSize)
 	inputData := mockGenerateAlertFromGateway()
 	alertError := ProcessAlert(&inputData, notificationChan)
-	config.AppConfig.AlertDestination = "http://www.test.com"
+	defer changeConfig(func(settings *config.Variables) {
+		settings.AlertDestination = "http://www.test.com"
+	})()
 	if alertError != nil {
 		t.Errorf("Error processing alerts %s", alertError)
 	}
@@ -43,16 +65,524 @@ func Test_processAlert(t *testing.T) {
 }
 
 func Test_processAlert_NoDestination(t *testing.T) {
-	notificationChan := make(chan Notification, config.AppConfig.NotificationChanSize)
+	notificationChan := make(chan Notification, config.Current().NotificationChanSize)
 	inputData := mockGenerateAlertFromGateway()
 	alertError := ProcessAlert(&inputData, notificationChan)
-	config.AppConfig.AlertDestination = ""
+	defer changeConfig(func(settings *config.Variables) {
+		settings.AlertDestination = ""
+	})()
 	if alertError != nil {
 		t.Errorf("Error processing alerts %s", alertError)
 	}
 	go NotifyChannel(notificationChan)
 }
 
+func Test_processAlert_Deduplicated(t *testing.T) {
+	SetDefaultDeduplicator(NewDeduplicator(time.Minute))
+	defer SetDefaultDeduplicator(nil)
+
+	notificationChan := make(chan Notification, config.Current().NotificationChanSize)
+	for i := 0; i < 3; i++ {
+		inputData := mockGenerateDeviceAlert()
+		if alertError := ProcessAlert(&inputData, notificationChan); alertError != nil {
+			t.Fatalf("Error processing alerts %s", alertError)
+		}
+	}
+
+	notification := <-notificationChan
+	if alertData := notification.Data.(models.Alert); alertData.Occurrences != 1 || alertData.FirstSeen == 0 {
+		t.Errorf("Expected first occurrence to be forwarded, got %+v", alertData)
+	}
+	select {
+	case notification := <-notificationChan:
+		t.Errorf("Expected duplicates to be suppressed, got %+v", notification.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSubmitAlert(t *testing.T) {
+	inputData := mockGenerateDeviceAlert()
+	if _, err := SubmitAlert(inputData); errors.Cause(err) != ErrNotAccepted {
+		t.Errorf("Expected alerts not to be accepted without a notification channel, got %v", err)
+	}
+
+	notificationChan := make(chan Notification, 1)
+	SetDefaultChannel(notificationChan)
+	defer SetDefaultChannel(nil)
+
+	id, err := SubmitAlert(inputData)
+	if err != nil {
+		t.Fatalf("Error submitting alert %s", err)
+	}
+	if id == "" || !Submitted(id) {
+		t.Fatalf("Expected the alert to be waiting with its id, got %q", id)
+	}
+	if _, err := SubmitAlert(inputData); errors.Cause(err) != ErrNotAccepted {
+		t.Errorf("Expected alerts not to be accepted while the channel is full, got %v", err)
+	}
+
+	notification := <-notificationChan
+	if alertData := notification.Data.(models.Alert); alertData.ID != id || alertData.AlertNumber != 22 {
+		t.Errorf("Expected the alert to keep its id %s, got %+v", id, alertData)
+	}
+	notify(notificationChan, notification)
+	if Submitted(id) {
+		t.Error("Expected the alert to be no longer waiting once notified")
+	}
+
+	SetDefaultDeduplicator(NewDeduplicator(time.Minute))
+	defer SetDefaultDeduplicator(nil)
+	if id, err := SubmitAlert(inputData); err != nil || id == "" {
+		t.Fatalf("Expected the first alert to be submitted, got %q %v", id, err)
+	}
+	<-notificationChan
+	if id, err := SubmitAlert(inputData); err != nil || id != "" {
+		t.Errorf("Expected the duplicate to be suppressed without an id, got %q %v", id, err)
+	}
+
+	// alerts that are not accepted are not recorded as seen, so they are not suppressed when sent again
+	otherAlert := []byte(`{"device_id":"Sensor2","alert_number":22,"severity":"critical","gateway_id":"rrs-gateway"}`)
+	SetDefaultChannel(nil)
+	if _, err := SubmitAlert(otherAlert); errors.Cause(err) != ErrNotAccepted {
+		t.Errorf("Expected alerts not to be accepted without a notification channel, got %v", err)
+	}
+	SetDefaultChannel(notificationChan)
+	notificationChan <- Notification{}
+	if _, err := SubmitAlert(otherAlert); errors.Cause(err) != ErrNotAccepted {
+		t.Errorf("Expected alerts not to be accepted while the channel is full, got %v", err)
+	}
+	<-notificationChan
+	if id, err := SubmitAlert(otherAlert); err != nil || id == "" {
+		t.Errorf("Expected the rejected alert to be submitted once there is room, got %q %v", id, err)
+	}
+}
+
+func TestWithAlertType(t *testing.T) {
+	alertCatalog, err := catalog.New([]catalog.AlertType{
+		{Number: 22, Name: "sensor_offline", Severity: "critical", Description: "Sensor {{.DeviceID}} is offline", Remediation: "Power cycle the sensor."},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create alert catalog %s", err)
+	}
+	catalog.SetDefault(alertCatalog)
+	defer catalog.SetDefault(nil)
+
+	notification := withAlertType(Notification{Data: models.Alert{AlertNumber: 22, DeviceID: "Sensor1", Severity: "warning"}})
+	alertData := notification.Data.(models.Alert)
+	if alertData.AlertName != "sensor_offline" || alertData.Remediation != "Power cycle the sensor." {
+		t.Errorf("Expected the device alert to be enriched from the catalog, got %+v", alertData)
+	}
+	if alertData.Severity != "warning" || alertData.AlertDescription != "Sensor Sensor1 is offline" {
+		t.Errorf("Expected the severity to be kept and the description filled in, got %+v", alertData)
+	}
+
+	deregistered, _ := models.GatewayDeregisteredAlert(models.Heartbeat{DeviceID: "rrs-gateway"})
+	if deregistered.Severity != "urgent" || deregistered.AlertDescription != "Gateway rrs-gateway deregistered" ||
+		deregistered.AlertName != "gateway_deregistered" {
+		t.Errorf("Expected the generated alert to be filled in from the catalog, got %+v", deregistered)
+	}
+
+	unknown := withAlertType(Notification{Data: models.Alert{AlertNumber: 23}}).Data.(models.Alert)
+	if unknown.AlertName != "" || unknown.Severity != "" {
+		t.Errorf("Expected alerts without a catalog entry to be left as they are, got %+v", unknown)
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	deduplicator := NewDeduplicator(time.Minute)
+	start := time.Now()
+	sensorAlert := models.Alert{DeviceID: "Sensor1", AlertNumber: 22, Severity: "critical"}
+
+	forwarded, forward := deduplicator.Observe(sensorAlert, "rrs-gateway", start)
+	if !forward || forwarded.Occurrences != 1 {
+		t.Fatalf("Expected first occurrence to be forwarded, got %+v", forwarded)
+	}
+	for i := 1; i <= 3; i++ {
+		repeat := sensorAlert
+		repeat.SentOn = int64(i)
+		if _, forward := deduplicator.Observe(repeat, "rrs-gateway", start.Add(time.Duration(i)*time.Second)); forward {
+			t.Fatal("Expected duplicate inside the window to be suppressed")
+		}
+	}
+	otherSeverity := sensorAlert
+	otherSeverity.Severity = "info"
+	if _, forward := deduplicator.Observe(otherSeverity, "rrs-gateway", start.Add(time.Second)); !forward {
+		t.Error("Expected alert with a different severity to be forwarded")
+	}
+	notWhitelisted := models.Alert{AlertNumber: NotWhitelisted, Optional: []interface{}{"first product"}}
+	otherProducts := models.Alert{AlertNumber: NotWhitelisted, Optional: []interface{}{"second product"}}
+	deduplicator.Observe(notWhitelisted, "", start)
+	if _, forward := deduplicator.Observe(otherProducts, "", start.Add(time.Second)); !forward {
+		t.Error("Expected alert with different details to be forwarded")
+	}
+
+	if flushed := deduplicator.Flush(start.Add(30 * time.Second)); len(flushed) != 0 {
+		t.Errorf("Expected nothing flushed inside the window, got %d", len(flushed))
+	}
+	flushed := deduplicator.Flush(start.Add(time.Minute + time.Second))
+	if len(flushed) != 1 {
+		t.Fatalf("Expected suppressed duplicates to be flushed once, got %d", len(flushed))
+	}
+	summary := flushed[0].Data.(models.Alert)
+	if summary.Occurrences != 4 || flushed[0].GatewayID != "rrs-gateway" {
+		t.Errorf("Expected 4 occurrences, got %+v", summary)
+	}
+	if summary.FirstSeen != start.UnixNano()/int64(time.Millisecond) ||
+		summary.LastSeen != start.Add(3*time.Second).UnixNano()/int64(time.Millisecond) {
+		t.Errorf("Unexpected first/last seen %d %d", summary.FirstSeen, summary.LastSeen)
+	}
+
+	// without new duplicates the alert is forgotten and the next one starts over
+	if flushed := deduplicator.Flush(start.Add(3 * time.Minute)); len(flushed) != 0 {
+		t.Errorf("Expected nothing left to flush, got %d", len(flushed))
+	}
+	forwarded, forward = deduplicator.Observe(sensorAlert, "rrs-gateway", start.Add(4*time.Minute))
+	if !forward || forwarded.Occurrences != 1 {
+		t.Errorf("Expected alert to be forwarded as a first occurrence, got %+v", forwarded)
+	}
+}
+
+func TestDeduplicatorPending(t *testing.T) {
+	deduplicator := NewDeduplicator(time.Minute)
+	start := time.Now()
+	sensorAlert := models.Alert{DeviceID: "Sensor1", AlertNumber: 22, Severity: "critical"}
+	deduplicator.Observe(sensorAlert, "rrs-gateway", start)
+	deduplicator.Observe(sensorAlert, "rrs-gateway", start.Add(time.Second))
+	deduplicator.Observe(models.Alert{DeviceID: "Sensor2", AlertNumber: 22}, "rrs-gateway", start)
+
+	pending := deduplicator.FlushPending(start.Add(2 * time.Second))
+	if len(pending) != 1 || pending[0].Data.(models.Alert).Occurrences != 2 {
+		t.Fatalf("Expected the alert with a duplicate to be flushed before its window ends, got %+v", pending)
+	}
+	if pending := deduplicator.FlushPending(start.Add(3 * time.Second)); len(pending) != 0 {
+		t.Errorf("Expected nothing left pending, got %d", len(pending))
+	}
+
+	// a flushed alert the notification channel had no room for is flushed again on the next tick
+	deduplicator.retry(pending[0].Data.(models.Alert), start.Add(3*time.Second))
+	if flushed := deduplicator.Flush(start.Add(4 * time.Second)); len(flushed) != 1 {
+		t.Errorf("Expected the retried alert to be flushed again, got %d", len(flushed))
+	}
+}
+
+func TestNotifyChannel_Queued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+
+	queue, err := delivery.NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create history store %s", err)
+	}
+	delivery.SetDefaultQueue(queue)
+	history.SetDefaultStore(store)
+	defer delivery.SetDefaultQueue(nil)
+	defer history.SetDefaultStore(nil)
+
+	notificationChan := make(chan Notification, 1)
+	notificationChan <- Notification{
+		NotificationType:    AlertType,
+		NotificationMessage: "Process Alert",
+		Data:                models.Alert{AlertNumber: 22, Severity: "info"},
+		GatewayID:           "rrs-gateway",
+		Endpoint:            "http://www.test.com",
+	}
+	close(notificationChan)
+	NotifyChannel(notificationChan)
+
+	due, err := queue.Due(time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Unable to read queue %s", err)
+	}
+	if len(due) != 1 || due[0].Endpoint != "http://www.test.com" || due[0].HistoryID == "" {
+		t.Fatalf("Expected the alert to be queued with its history id, got %v", due)
+	}
+
+	records, _, err := store.Query(history.Filter{})
+	if err != nil {
+		t.Fatalf("Unable to query history %s", err)
+	}
+	if len(records) != 1 || records[0].Outcome != history.Queued {
+		t.Fatalf("Expected a queued alert record, got %v", records)
+	}
+	var queuedAlert models.Alert
+	if err := json.Unmarshal(due[0].Data, &queuedAlert); err != nil {
+		t.Fatalf("Unable to unmarshal queued alert %s", err)
+	}
+	if queuedAlert.ID == "" || records[0].ID != queuedAlert.ID || due[0].HistoryID != queuedAlert.ID {
+		t.Errorf("Expected the alert id %s to identify the history record %s", queuedAlert.ID, records[0].ID)
+	}
+
+	testMockServer, serverErr := getTestMockServer()
+	if serverErr != nil {
+		t.Errorf("Server returned a error %v", serverErr)
+	}
+	defer testMockServer.Close()
+	defer changeConfig(func(settings *config.Variables) {
+		settings.CloudConnectorURL = testMockServer.URL
+	})()
+	NewDeliveryWorker(queue).Run(closedChannel())
+
+	records, _, err = store.Query(history.Filter{})
+	if err != nil {
+		t.Fatalf("Unable to query history %s", err)
+	}
+	if records[0].Outcome != history.Delivered {
+		t.Errorf("Expected alert to be delivered, got %s", records[0].Outcome)
+	}
+	if queue.Depth() != 0 {
+		t.Errorf("Expected empty queue, got %d", queue.Depth())
+	}
+}
+
+func TestNotifyChannel_Routed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+
+	queue, err := delivery.NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create history store %s", err)
+	}
+	var auths []models.Auth
+	var serverErr error
+	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var payload models.CloudConnectorPayload
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			serverErr = err
+		}
+		auths = append(auths, payload.Auth)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+	ResetWebhookClients()
+
+	table, err := routing.NewTable(map[string]routing.Destination{
+		"store-ops": {URL: "http://ops.example.com", AuthType: "oauth2", AuthEndpoint: "http://auth.example.com/token", ClientID: "ops", ClientSecret: "secret"},
+		"it":        {URL: "http://it.example.com"},
+	}, []routing.Route{
+		{Name: "critical", Match: routing.Match{Severities: []string{"critical"}}, Destinations: []string{"store-ops", "it"}},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create routing table %s", err)
+	}
+	delivery.SetDefaultQueue(queue)
+	history.SetDefaultStore(store)
+	routing.SetDefaultTable(table)
+	defer delivery.SetDefaultQueue(nil)
+	defer history.SetDefaultStore(nil)
+	defer routing.SetDefaultTable(nil)
+
+	notificationChan := make(chan Notification, 2)
+	notificationChan <- Notification{
+		NotificationType:    AlertType,
+		NotificationMessage: "Process Alert",
+		Data:                models.Alert{AlertNumber: 22, Severity: "critical"},
+		GatewayID:           "rrs-gateway",
+		Endpoint:            "http://www.test.com",
+	}
+	notificationChan <- Notification{
+		NotificationType:    AlertType,
+		NotificationMessage: "Process Alert",
+		Data:                models.Alert{AlertNumber: 22, Severity: "info"},
+		GatewayID:           "rrs-gateway",
+		Endpoint:            "http://www.test.com",
+	}
+	close(notificationChan)
+	NotifyChannel(notificationChan)
+
+	due, err := queue.Due(time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Unable to read queue %s", err)
+	}
+	endpoints := make(map[string]string)
+	for _, message := range due {
+		endpoints[message.Destination] = message.Endpoint
+	}
+	expected := map[string]string{
+		"store-ops":                    "http://ops.example.com",
+		"it":                           "http://it.example.com",
+		routing.DefaultDestinationName: "http://www.test.com",
+	}
+	if len(due) != 3 || !reflect.DeepEqual(endpoints, expected) {
+		t.Fatalf("Expected critical alert to fan out and info alert to use its endpoint, got %v", endpoints)
+	}
+
+	defer changeConfig(func(settings *config.Variables) {
+		settings.CloudConnectorURL = testServer.URL
+	})()
+	NewDeliveryWorker(queue).Run(closedChannel())
+	if serverErr != nil {
+		t.Fatalf("Unable to decode payload %s", serverErr)
+	}
+	// the cloud connector requests the token of store-ops itself
+	opsAuth := models.Auth{
+		AuthType: "oauth2",
+		Endpoint: "http://auth.example.com/token",
+		Data:     "basic " + base64.StdEncoding.EncodeToString([]byte("ops:secret")),
+	}
+	foundAuth := false
+	for _, auth := range auths {
+		if auth == opsAuth {
+			foundAuth = true
+		}
+	}
+	if len(auths) != 3 || !foundAuth {
+		t.Errorf("Expected the store-ops auth to be sent with its delivery, got %v", auths)
+	}
+
+	records, _, err := store.Query(history.Filter{Severity: "critical"})
+	if err != nil {
+		t.Fatalf("Unable to query history %s", err)
+	}
+	if len(records) != 1 || len(records[0].Deliveries) != 2 || records[0].Outcome != history.Delivered {
+		t.Errorf("Expected critical alert to be delivered to both destinations, got %+v", records)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+
+	queue, err := delivery.NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	delivery.SetDefaultQueue(queue)
+	defer delivery.SetDefaultQueue(nil)
+
+	notificationChan := make(chan Notification, 5)
+	for i := 0; i < 3; i++ {
+		notificationChan <- Notification{
+			NotificationType:    AlertType,
+			NotificationMessage: "Process Alert",
+			Data:                models.Alert{AlertNumber: 22 + i, Severity: "info"},
+			GatewayID:           "rrs-gateway",
+			Endpoint:            "http://www.test.com",
+		}
+	}
+
+	// once stopped, the notifier leaves the notifications in the channel
+	stopped := make(chan struct{})
+	go func() {
+		NotifyChannelUntil(make(chan Notification), closedChannel())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the notifier to return once stopped")
+	}
+
+	if flushed, dropped := Drain(notificationChan, time.Now()); flushed != 0 || dropped != 3 {
+		t.Errorf("Expected every notification to be dropped past the deadline, got %d flushed and %d dropped", flushed, dropped)
+	}
+	if flushed, dropped := Drain(notificationChan, time.Now().Add(time.Minute)); flushed != 3 || dropped != 0 {
+		t.Errorf("Expected every notification to be flushed, got %d flushed and %d dropped", flushed, dropped)
+	}
+	if queue.Depth() != 3 {
+		t.Errorf("Expected the flushed notifications to be persisted in the queue, got %d", queue.Depth())
+	}
+
+	// notifications sent while the channel is full are waited for, and dropped if they are still waiting at the deadline
+	fullChan := make(chan Notification, 1)
+	for i := 0; i < 3; i++ {
+		Send(fullChan, Notification{
+			NotificationType:    AlertType,
+			NotificationMessage: "Process Alert",
+			Data:                models.Alert{AlertNumber: 30 + i, Severity: "info"},
+			GatewayID:           "rrs-gateway",
+			Endpoint:            "http://www.test.com",
+		})
+	}
+	if flushed, dropped := Drain(fullChan, time.Now()); flushed != 0 || dropped != 3 {
+		t.Errorf("Expected the waiting sends to be dropped past the deadline, got %d flushed and %d dropped", flushed, dropped)
+	}
+	if flushed, dropped := Drain(fullChan, time.Now().Add(time.Minute)); flushed != 3 || dropped != 0 || WaitingSends() != 0 {
+		t.Errorf("Expected the waiting sends to be flushed, got %d flushed and %d dropped", flushed, dropped)
+	}
+
+	// duplicates counted in a window that has not ended yet are flushed too
+	SetDefaultDeduplicator(NewDeduplicator(time.Minute))
+	defer SetDefaultDeduplicator(nil)
+	sensorAlert := models.Alert{DeviceID: "Sensor1", AlertNumber: 22, Severity: "critical"}
+	deduplicate(sensorAlert, "rrs-gateway")
+	deduplicate(sensorAlert, "rrs-gateway")
+	if flushed, dropped := Drain(notificationChan, time.Now().Add(time.Minute)); flushed != 1 || dropped != 0 {
+		t.Errorf("Expected the pending duplicates to be flushed, got %d flushed and %d dropped", flushed, dropped)
+	}
+}
+
+func TestResolveGatewayDeregistered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create history store %s", err)
+	}
+	history.SetDefaultStore(store)
+	defer history.SetDefaultStore(nil)
+
+	deregistered, _ := models.GatewayDeregisteredAlert(models.Heartbeat{DeviceID: "rrs-gateway"})
+	record, err := store.Add(history.Record{Alert: deregistered, GatewayID: "rrs-gateway"})
+	if err != nil {
+		t.Fatalf("Unable to add record %s", err)
+	}
+
+	ResolveGatewayDeregistered("rrs-gateway")
+	record, err = store.Get(record.ID)
+	if err != nil {
+		t.Fatalf("Unable to get record %s", err)
+	}
+	if record.State != history.Resolved || record.Transitions[0].User != "watchdog" {
+		t.Errorf("Expected deregistered alert to be resolved by the watchdog, got %+v", record)
+	}
+}
+
+func closedChannel() chan struct{} {
+	stop := make(chan struct{})
+	close(stop)
+	return stop
+}
+
 func TestGeneratePayloadAlert_withDestination(t *testing.T) {
 	testNotification := new(Notification)
 	inputData := mockGenerateAlert()
@@ -142,7 +672,7 @@ func TestGeneratePayloadAlert_noDestination(t *testing.T) {
 func TestGeneratePayloadHeartbeat(t *testing.T) {
 	testNotification := new(Notification)
 	inputData := mockGenerateHeartbeat()
-	hbPayloadURL := config.AppConfig.HeartbeatDestination
+	hbPayloadURL := config.Current().HeartbeatDestination
 	var hb models.Heartbeat
 	err := json.Unmarshal(inputData, &hb)
 	if err != nil {
@@ -202,11 +732,31 @@ func TestPostNotification(t *testing.T) {
 
 }
 
+func TestPostNotificationStatus(t *testing.T) {
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	for _, status = range []int{http.StatusCreated, http.StatusNoContent} {
+		if _, err := PostNotification([]byte(`{}`), server.URL); err != nil {
+			t.Errorf("Expected %d to be a successful post, got %s", status, err)
+		}
+	}
+	status = http.StatusServiceUnavailable
+	if _, err := PostNotification([]byte(`{}`), server.URL); delivery.StatusCode(err) != status {
+		t.Errorf("Expected the status of a failed post, got %v", err)
+	}
+}
+
 func TestPostNotificationWithAuth(t *testing.T) {
-	config.AppConfig.AlertDestinationAuthEndpoint = "www.auth.com"
-	config.AppConfig.AlertDestinationAuthType = "oauth2"
-	config.AppConfig.AlertDestinationClientID = "12345657"
-	config.AppConfig.AlertDestinationClientSecret = "abcdefghijklmn10000"
+	defer changeConfig(func(settings *config.Variables) {
+		settings.AlertDestinationAuthEndpoint = "www.auth.com"
+		settings.AlertDestinationAuthType = "oauth2"
+		settings.AlertDestinationClientID = "12345657"
+		settings.AlertDestinationClientSecret = "abcdefghijklmn10000"
+	})()
 	testMockServer, serverErr := getTestMockServer()
 	if serverErr != nil {
 		t.Errorf("Server returned a error %v", serverErr)
@@ -246,6 +796,20 @@ func mockGenerateAlertFromGateway() []byte {
 	return testAlert
 }
 
+// Alert from the params of a device_alert reading
+func mockGenerateDeviceAlert() []byte {
+	testAlert := []byte(`{
+		"sent_on": 1523904547000,
+		"facilities": ["front"],
+		"device_id": "Sensor1",
+		"gateway_id": "rrs-gateway",
+		"alert_number": 22,
+		"alert_description": "sensor disconnected",
+		"severity": "info"
+	}`)
+	return testAlert
+}
+
 // Alert for cloud which excludes gateway_id field
 func mockGenerateAlert() []byte {
 	alert := []byte(`{
@@ -306,3 +870,36 @@ func getTestMockServer() (*httptest.Server, error) {
 	}))
 	return testServer, serverErr
 }
+
+func TestLastCloudConnectorDelivery(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	defer changeConfig(func(settings *config.Variables) {
+		settings.CloudConnectorURL, settings.CloudConnectorEndpoint = server.URL, "/callwebhook"
+	})()
+
+	message := delivery.Message{NotificationType: AlertType, Endpoint: "http://www.test.com", Data: []byte(`{"alert_number":22}`)}
+	if _, err := DeliverMessage(message); err == nil {
+		t.Fatal("Expected error when the cloud connector fails")
+	}
+	first, found := LastCloudConnectorDelivery()
+	if !found || first.Error == "" || first.ConsecutiveFailures == 0 {
+		t.Errorf("Expected the failed delivery to be recorded, got %+v", first)
+	}
+	_, _ = DeliverMessage(message)
+	if last, _ := LastCloudConnectorDelivery(); last.ConsecutiveFailures != first.ConsecutiveFailures+1 {
+		t.Errorf("Expected another failure in a row to be counted, got %+v", last)
+	}
+
+	status = http.StatusOK
+	if _, err := DeliverMessage(message); err != nil {
+		t.Fatalf("Error delivering message %s", err)
+	}
+	if last, found := LastCloudConnectorDelivery(); !found || last.Error != "" || last.At.IsZero() || last.ConsecutiveFailures != 0 {
+		t.Errorf("Expected the successful delivery to be recorded, got %+v", last)
+	}
+}
@@ -0,0 +1,255 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// mqttClients caches the connection to each mqtt destination
+	mqttClients      = make(map[string]*mqttConnection)
+	mqttClientsMutex sync.Mutex
+
+	// topicReplacer keeps values from adding levels or wildcards to a topic
+	topicReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+)
+
+// PublishMQTT publishes the notification data of the message to the topics of the destination,
+// one for each facility of the notification when the topic template includes {facility}
+func PublishMQTT(message delivery.Message, destination routing.Destination) error {
+	// Metrics
+	metrics.GetOrRegisterGauge("Alert.PublishMQTT.Attempt", nil).Update(1)
+	startTime := time.Now()
+	defer metrics.GetOrRegisterTimer("Alert.PublishMQTT.Latency", nil).UpdateSince(startTime)
+	mSuccess := metrics.GetOrRegisterGauge("Alert.PublishMQTT.Success", nil)
+	mPublishErr := metrics.GetOrRegisterGauge("Alert.PublishMQTT.Publish-Error", nil)
+
+	client, err := mqttClient(destination)
+	if err != nil {
+		mPublishErr.Update(1)
+		return err
+	}
+
+	timeout := time.Duration(connectionTimeout) * time.Second
+	for _, topic := range expandTopic(destination.MQTT.Topic, message) {
+		token := client.Publish(topic, destination.MQTT.QoS, destination.MQTT.Retain, []byte(message.Data))
+		if !waitToken(token, timeout) {
+			mPublishErr.Update(1)
+			return errors.Errorf("timed out publishing to %s on %s", topic, destination.Name)
+		}
+		if err := token.Error(); err != nil {
+			mPublishErr.Update(1)
+			return errors.Wrapf(err, "unable to publish to %s on %s", topic, destination.Name)
+		}
+		log.Debugf("Notification published to %s on %s", topic, destination.Name)
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// expandTopic fills in the {type}, {facility}, {severity}, {alert_number}, {device_id} and {gateway_id}
+// placeholders of the topic template, returning one topic for each facility of the notification
+func expandTopic(template string, message delivery.Message) []string {
+	var data struct {
+		Facilities  []string `json:"facilities"`
+		Severity    string   `json:"severity"`
+		AlertNumber int      `json:"alert_number"`
+		DeviceID    string   `json:"device_id"`
+	}
+	// notifications that are not alerts or heartbeats leave their placeholders empty
+	_ = json.Unmarshal(message.Data, &data)
+
+	alertNumber := ""
+	if data.AlertNumber != 0 {
+		alertNumber = strconv.Itoa(data.AlertNumber)
+	}
+	replacer := strings.NewReplacer(
+		"{type}", topicValue(strings.ToLower(message.NotificationType)),
+		"{severity}", topicValue(data.Severity),
+		"{alert_number}", topicValue(alertNumber),
+		"{device_id}", topicValue(data.DeviceID),
+		"{gateway_id}", topicValue(message.GatewayID),
+	)
+	topic := replacer.Replace(template)
+
+	if !strings.Contains(topic, "{facility}") {
+		return []string{topic}
+	}
+	if len(data.Facilities) == 0 {
+		return []string{strings.Replace(topic, "{facility}", topicValue(""), -1)}
+	}
+	topics := make([]string, 0, len(data.Facilities))
+	seen := make(map[string]bool)
+	for _, facility := range data.Facilities {
+		facilityTopic := strings.Replace(topic, "{facility}", topicValue(facility), -1)
+		if !seen[facilityTopic] {
+			seen[facilityTopic] = true
+			topics = append(topics, facilityTopic)
+		}
+	}
+	return topics
+}
+
+func topicValue(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return topicReplacer.Replace(value)
+}
+
+// mqttConnection is the client shared by the publishes to an mqtt destination. Its mutex is only held to read
+// and swap the client, so connecting to one destination does not hold up the publishes to the others.
+type mqttConnection struct {
+	mutex  sync.Mutex
+	client mqtt.Client
+	// connecting is closed once the connect in progress, if any, completes with client or err
+	connecting chan struct{}
+	err        error
+	// reset is set once the destination is reset, its connection is then no longer cached
+	reset bool
+}
+
+// mqttClient returns a connected client for the destination, connecting the first time it is needed and again
+// once the client has given up reconnecting
+func mqttClient(destination routing.Destination) (mqtt.Client, error) {
+	mqttClientsMutex.Lock()
+	connection, found := mqttClients[destination.Name]
+	if !found {
+		connection = &mqttConnection{}
+		mqttClients[destination.Name] = connection
+	}
+	mqttClientsMutex.Unlock()
+
+	connection.mutex.Lock()
+	// a client with auto reconnect is connected while it reconnects, and is left to finish reconnecting
+	if connection.client != nil && connection.client.IsConnected() {
+		client := connection.client
+		connection.mutex.Unlock()
+		return client, nil
+	}
+	if connecting := connection.connecting; connecting != nil {
+		// wait for the connect in progress rather than compete with it for the broker session of the client id
+		connection.mutex.Unlock()
+		<-connecting
+		connection.mutex.Lock()
+		defer connection.mutex.Unlock()
+		if connection.err != nil {
+			return nil, connection.err
+		}
+		if connection.client == nil {
+			return nil, errors.Errorf("%s was reset while connecting", destination.Name)
+		}
+		return connection.client, nil
+	}
+	stale := connection.client
+	connecting := make(chan struct{})
+	connection.client, connection.connecting = nil, connecting
+	connection.mutex.Unlock()
+
+	if stale != nil {
+		stale.Disconnect(0)
+	}
+	client, err := connectMQTT(destination)
+
+	connection.mutex.Lock()
+	if err == nil && connection.reset {
+		// the settings the client connected with were replaced while it was connecting
+		client.Disconnect(0)
+		client, err = nil, errors.Errorf("%s was reset while connecting", destination.Name)
+	}
+	connection.client, connection.err, connection.connecting = client, err, nil
+	connection.mutex.Unlock()
+	close(connecting)
+	return client, err
+}
+
+// connectMQTT connects a new client to the destination
+func connectMQTT(destination routing.Destination) (mqtt.Client, error) {
+	tlsConfig, err := newTLSConfig(destination.TLS)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load tls settings of %s", destination.Name)
+	}
+	clientID := destination.MQTT.ClientID
+	if clientID == "" {
+		clientID = "alert-service-" + uuid.New()
+	}
+	timeout := time.Duration(connectionTimeout) * time.Second
+	options := mqtt.NewClientOptions().
+		AddBroker(destination.URL).
+		SetClientID(clientID).
+		SetUsername(destination.MQTT.Username).
+		SetPassword(destination.MQTT.Password).
+		SetProtocolVersion(4).
+		SetConnectTimeout(timeout).
+		SetAutoReconnect(true)
+	if tlsConfig != nil {
+		options.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	if !waitToken(token, timeout) {
+		client.Disconnect(0)
+		return nil, errors.Errorf("timed out connecting to %s", destination.Name)
+	}
+	if err := token.Error(); err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to %s", destination.Name)
+	}
+	return client, nil
+}
+
+// waitToken waits for the token to complete, returning false if it took longer than the timeout.
+// Token.WaitTimeout is not used as it holds the token lock, blocking any error from being set until it times out.
+func waitToken(token mqtt.Token, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		token.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// ResetMQTTClients disconnects the clients of the mqtt destinations, so they reconnect with their current settings
+func ResetMQTTClients() {
+	mqttClientsMutex.Lock()
+	connections := mqttClients
+	mqttClients = make(map[string]*mqttConnection)
+	mqttClientsMutex.Unlock()
+
+	for _, connection := range connections {
+		connection.mutex.Lock()
+		connection.reset = true
+		client := connection.client
+		connection.client = nil
+		connection.mutex.Unlock()
+		if client != nil {
+			client.Disconnect(250)
+		}
+	}
+}
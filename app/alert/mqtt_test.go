@@ -0,0 +1,222 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+)
+
+// publishedMessage is a message received by the test broker
+type publishedMessage struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+}
+
+// testBroker is a local stand-in for an mqtt broker, accepting connections with the expected credentials
+// and keeping the messages published to it
+type testBroker struct {
+	listener  net.Listener
+	username  string
+	password  string
+	mutex     sync.Mutex
+	published []publishedMessage
+	connects  int
+}
+
+func newTestBroker(t *testing.T, username string, password string) *testBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen %s", err)
+	}
+	broker := &testBroker{listener: listener, username: username, password: password}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+func (broker *testBroker) url() string {
+	return "tcp://" + broker.listener.Addr().String()
+}
+
+func (broker *testBroker) close() {
+	_ = broker.listener.Close()
+}
+
+func (broker *testBroker) messages() []publishedMessage {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	return append([]publishedMessage(nil), broker.published...)
+}
+
+func (broker *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch received := packet.(type) {
+		case *packets.ConnectPacket:
+			broker.mutex.Lock()
+			broker.connects++
+			broker.mutex.Unlock()
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			if received.Username != broker.username || string(received.Password) != broker.password {
+				connack.ReturnCode = packets.ErrRefusedNotAuthorised
+			}
+			if err := connack.Write(conn); err != nil || connack.ReturnCode != packets.Accepted {
+				return
+			}
+		case *packets.PublishPacket:
+			broker.mutex.Lock()
+			broker.published = append(broker.published, publishedMessage{
+				topic:   received.TopicName,
+				payload: string(received.Payload),
+				qos:     received.Qos,
+				retain:  received.Retain,
+			})
+			broker.mutex.Unlock()
+			if received.Qos == 1 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = received.MessageID
+				_ = puback.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			_ = packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func TestPublishMQTT(t *testing.T) {
+	broker := newTestBroker(t, "alerts", "secret")
+	defer broker.close()
+	defer ResetMQTTClients()
+
+	destination := routing.Destination{
+		Name: "automation",
+		URL:  broker.url(),
+		Mode: routing.ModeMQTT,
+		MQTT: routing.MQTT{Topic: "alerts/{facility}/{severity}", QoS: 1, Retain: true, Username: "alerts", Password: "secret"},
+	}
+	message := delivery.Message{
+		NotificationType: AlertType,
+		GatewayID:        "rrs-gateway",
+		Data:             []byte(`{"alert_number":22,"severity":"critical","facilities":["front","back/room"]}`),
+	}
+	if err := PublishMQTT(message, destination); err != nil {
+		t.Fatalf("Error publishing %s", err)
+	}
+
+	expected := []publishedMessage{
+		{topic: "alerts/front/critical", payload: string(message.Data), qos: 1, retain: true},
+		{topic: "alerts/back_room/critical", payload: string(message.Data), qos: 1, retain: true},
+	}
+	if published := broker.messages(); !reflect.DeepEqual(published, expected) {
+		t.Errorf("Expected %v, got %v", expected, published)
+	}
+
+	rejected := destination
+	rejected.Name = "rejected"
+	rejected.MQTT.Password = "wrong"
+	if err := PublishMQTT(message, rejected); err == nil {
+		t.Error("Expected error connecting with the wrong password")
+	}
+}
+
+func TestMQTTClientReconnects(t *testing.T) {
+	broker := newTestBroker(t, "", "")
+	defer broker.close()
+	defer ResetMQTTClients()
+
+	destination := routing.Destination{Name: "automation", URL: broker.url(), Mode: routing.ModeMQTT}
+	var wait sync.WaitGroup
+	clients := make(chan mqtt.Client, 5)
+	for i := 0; i < 5; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			client, err := mqttClient(destination)
+			if err != nil {
+				t.Errorf("Error connecting %s", err)
+			}
+			clients <- client
+		}()
+	}
+	wait.Wait()
+	close(clients)
+
+	first := <-clients
+	for client := range clients {
+		if client != first {
+			t.Error("Expected publishes at the same time to share one client")
+		}
+	}
+
+	// a client that is no longer connected is disconnected for good and replaced
+	first.Disconnect(0)
+	replacement, err := mqttClient(destination)
+	if err != nil {
+		t.Fatalf("Error reconnecting %s", err)
+	}
+	if replacement == first || !replacement.IsConnected() {
+		t.Error("Expected a new connected client to replace the disconnected one")
+	}
+	broker.mutex.Lock()
+	connects := broker.connects
+	broker.mutex.Unlock()
+	if connects != 2 {
+		t.Errorf("Expected 2 connects, got %d", connects)
+	}
+}
+
+func TestExpandTopic(t *testing.T) {
+	tests := []struct {
+		template string
+		message  delivery.Message
+		expected []string
+	}{
+		{
+			"alerts/{facility}/{severity}",
+			delivery.Message{Data: []byte(`{"severity":"info"}`)},
+			[]string{"alerts/none/info"},
+		},
+		{
+			"{type}/{gateway_id}/{device_id}/{alert_number}",
+			delivery.Message{NotificationType: AlertType, GatewayID: "rrs-gateway", Data: []byte(`{"alert_number":322,"device_id":"rrs+gateway"}`)},
+			[]string{"alert/rrs-gateway/rrs_gateway/322"},
+		},
+		{
+			"heartbeats/{facility}",
+			delivery.Message{NotificationType: "Heartbeat", Data: []byte(`{"facilities":["front","front"]}`)},
+			[]string{"heartbeats/front"},
+		},
+	}
+	for _, test := range tests {
+		if topics := expandTopic(test.template, test.message); !reflect.DeepEqual(topics, test.expected) {
+			t.Errorf("Expected %v for %s, got %v", test.expected, test.template, topics)
+		}
+	}
+}
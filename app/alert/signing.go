@@ -0,0 +1,103 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of the timestamp and body of a request, as sha256={hex}
+	SignatureHeader = "X-Alert-Signature"
+	// SignatureTimestampHeader carries the unix time in seconds the request was signed at
+	SignatureTimestampHeader = "X-Alert-Signature-Timestamp"
+	// SignatureKeyIDHeader carries the id of the key the request was signed with
+	SignatureKeyIDHeader = "X-Alert-Signature-Key-Id"
+
+	// DefaultSignatureTolerance is how old, or how far in the future, the timestamp of a signed request can be
+	DefaultSignatureTolerance = 5 * time.Minute
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	// ErrSignatureMissing occurs when a request to verify has no signature, timestamp or key id header
+	ErrSignatureMissing = errors.New("Signature headers missing")
+	// ErrSignatureUnknownKey occurs when a request is signed with a key the verifier does not have
+	ErrSignatureUnknownKey = errors.New("Signature key unknown")
+	// ErrSignatureExpired occurs when the timestamp of a request is outside the tolerance, as for a replayed request
+	ErrSignatureExpired = errors.New("Signature timestamp outside tolerance")
+	// ErrSignatureInvalid occurs when the signature does not match the timestamp and body of a request
+	ErrSignatureInvalid = errors.New("Signature invalid")
+)
+
+// Sign adds the signature, timestamp and key id headers for the body to the header. The signature is the
+// HMAC-SHA256 of the timestamp, a dot and the body, so the timestamp cannot be changed to replay the body later.
+func Sign(header http.Header, body []byte, key []byte, keyID string, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header.Set(SignatureHeader, signaturePrefix+hex.EncodeToString(signature(key, timestamp, body)))
+	header.Set(SignatureTimestampHeader, timestamp)
+	header.Set(SignatureKeyIDHeader, keyID)
+}
+
+// VerifySignature checks the signature headers of a request received from the service against its body,
+// with the keys the service may sign with by key id. Requests signed more than tolerance before or after
+// now are rejected, use DefaultSignatureTolerance unless the clocks are known to drift further apart.
+func VerifySignature(header http.Header, body []byte, keys map[string][]byte, tolerance time.Duration, now time.Time) error {
+	signed, timestamp, keyID := header.Get(SignatureHeader), header.Get(SignatureTimestampHeader), header.Get(SignatureKeyIDHeader)
+	if signed == "" || timestamp == "" || keyID == "" {
+		return ErrSignatureMissing
+	}
+	key, found := keys[keyID]
+	if !found {
+		return errors.Wrapf(ErrSignatureUnknownKey, "key id %s", keyID)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrapf(ErrSignatureInvalid, "timestamp %s", timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return errors.Wrapf(ErrSignatureExpired, "signed %s ago", age)
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signed, signaturePrefix))
+	if err != nil || !strings.HasPrefix(signed, signaturePrefix) {
+		return ErrSignatureInvalid
+	}
+	if !hmac.Equal(received, signature(key, timestamp, body)) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+func signature(key []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(timestamp))
+	_, _ = mac.Write([]byte("."))
+	_, _ = mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// signRequest signs the body of a request with the signingKey setting, leaving the request unsigned without one
+func signRequest(request *http.Request, body []byte) {
+	settings := config.Current()
+	if settings.SigningKey == "" {
+		return
+	}
+	Sign(request.Header, body, []byte(settings.SigningKey), settings.SigningKeyID, time.Now())
+}
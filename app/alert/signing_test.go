@@ -0,0 +1,107 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/pkg/errors"
+)
+
+func TestVerifySignature(t *testing.T) {
+	keys := map[string][]byte{"2019-01": []byte("secret")}
+	body := []byte(`{"alert_number":22}`)
+	signedAt := time.Unix(1546300800, 0)
+	header := http.Header{}
+	Sign(header, body, keys["2019-01"], "2019-01", signedAt)
+
+	if err := VerifySignature(header, body, keys, DefaultSignatureTolerance, signedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected the signature to be valid, got %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		body     []byte
+		keys     map[string][]byte
+		now      time.Time
+		expected error
+	}{
+		{"tampered body", header, []byte(`{"alert_number":23}`), keys, signedAt, ErrSignatureInvalid},
+		{"replayed", header, body, keys, signedAt.Add(DefaultSignatureTolerance + time.Second), ErrSignatureExpired},
+		{"other key", header, body, map[string][]byte{"2019-01": []byte("other")}, signedAt, ErrSignatureInvalid},
+		{"unknown key", header, body, map[string][]byte{"2019-02": []byte("secret")}, signedAt, ErrSignatureUnknownKey},
+		{"unsigned", http.Header{}, body, keys, signedAt, ErrSignatureMissing},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifySignature(test.header, test.body, test.keys, DefaultSignatureTolerance, test.now)
+			if errors.Cause(err) != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+
+	// the timestamp is part of the signature
+	changed := http.Header{}
+	Sign(changed, body, keys["2019-01"], "2019-01", signedAt)
+	changed.Set(SignatureTimestampHeader, "1546300900")
+	if err := VerifySignature(changed, body, keys, DefaultSignatureTolerance, signedAt); err != ErrSignatureInvalid {
+		t.Errorf("Expected a changed timestamp to invalidate the signature, got %v", err)
+	}
+}
+
+func TestDeliverWebhook_Signed(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header = request.Header
+		body, _ = ioutil.ReadAll(request.Body)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+
+	defer changeConfig(func(settings *config.Variables) {})()
+	destination := routing.Destination{Name: "signed", URL: server.URL}
+	message := delivery.Message{Data: []byte(`{"alert_number":22}`)}
+
+	changeConfig(func(settings *config.Variables) {
+		settings.SigningKey = ""
+	})
+	if _, err := DeliverWebhook(message, destination); err != nil {
+		t.Fatalf("Error delivering webhook %s", err)
+	}
+	if header.Get(SignatureHeader) != "" {
+		t.Error("Expected no signature without a signing key")
+	}
+
+	changeConfig(func(settings *config.Variables) {
+		settings.SigningKey, settings.SigningKeyID = "secret", "2019-01"
+	})
+	if _, err := DeliverWebhook(message, destination); err != nil {
+		t.Fatalf("Error delivering webhook %s", err)
+	}
+	keys := map[string][]byte{"2019-01": []byte("secret")}
+	if err := VerifySignature(header, body, keys, DefaultSignatureTolerance, time.Now()); err != nil {
+		t.Errorf("Expected the webhook to be signed, got %v", err)
+	}
+
+	if _, err := PostNotification(message.Data, server.URL); err != nil {
+		t.Fatalf("Error posting notification %s", err)
+	}
+	if err := VerifySignature(header, body, keys, DefaultSignatureTolerance, time.Now()); err != nil {
+		t.Errorf("Expected the cloud connector payload to be signed, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"sync"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Suppressed is the status of an alert dropped as a duplicate of one sent shortly before
+	Suppressed = "suppressed"
+)
+
+var (
+	defaultChannel      chan Notification
+	defaultChannelMutex sync.RWMutex
+
+	// submitted holds the ids of the alerts submitted to the notification channel that are not recorded yet
+	submitted      = make(map[string]bool)
+	submittedMutex sync.Mutex
+
+	// ErrNotAccepted occurs when an alert is submitted while the notification channel is full or not set
+	ErrNotAccepted = errors.New("Alert not accepted")
+)
+
+// SetDefaultChannel sets the notification channel SubmitAlert sends alerts to, read by the long lived notifier
+func SetDefaultChannel(notificationChan chan Notification) {
+	defaultChannelMutex.Lock()
+	defer defaultChannelMutex.Unlock()
+	defaultChannel = notificationChan
+}
+
+// DefaultChannel returns the notification channel SubmitAlert sends alerts to, or nil if it is not set
+func DefaultChannel() chan Notification {
+	defaultChannelMutex.RLock()
+	defer defaultChannelMutex.RUnlock()
+	return defaultChannel
+}
+
+// SubmitAlert gives the alert in the json bytes an id and sends it to the default notification channel without
+// waiting for room in it. It returns the id of the alert, which is empty when the alert is suppressed as a duplicate.
+func SubmitAlert(jsonBytes []byte) (string, error) {
+	alertEvent, gatewayID, err := parseAlert(jsonBytes)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to parse alert")
+	}
+	notificationChan := DefaultChannel()
+	if notificationChan == nil {
+		return "", errors.Wrap(ErrNotAccepted, "notification channel is not set")
+	}
+
+	alertEvent, forward := deduplicate(alertEvent, gatewayID)
+	if !forward {
+		return "", nil
+	}
+
+	alertEvent.ID = uuid.New()
+	setSubmitted(alertEvent.ID, true)
+	select {
+	case notificationChan <- alertNotification(alertEvent, gatewayID):
+		log.Debugf("Submitted alert %s", alertEvent.ID)
+		return alertEvent.ID, nil
+	default:
+		setSubmitted(alertEvent.ID, false)
+		// the alert was not accepted, so the next one like it is not its duplicate
+		forget(alertEvent)
+		metrics.GetOrRegisterCounter("Alert.SubmitAlert.Rejected", nil).Inc(1)
+		return "", errors.Wrapf(ErrNotAccepted, "notification channel is full with %d notifications", cap(notificationChan))
+	}
+}
+
+// Submitted reports whether the alert with the id was submitted and is still waiting in the notification channel
+func Submitted(id string) bool {
+	submittedMutex.Lock()
+	defer submittedMutex.Unlock()
+	return submitted[id]
+}
+
+func setSubmitted(id string, waiting bool) {
+	submittedMutex.Lock()
+	defer submittedMutex.Unlock()
+	if waiting {
+		submitted[id] = true
+	} else {
+		delete(submitted, id)
+	}
+}
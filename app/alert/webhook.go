@@ -0,0 +1,177 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// webhookClients caches the http client of each destination, as each can have its own TLS settings
+	webhookClients      = make(map[string]*http.Client)
+	webhookClientsMutex sync.Mutex
+)
+
+// destinationMode returns how notifications reach the destination, defaulting to the deliveryMode setting
+func destinationMode(destination routing.Destination) string {
+	if destination.Mode != "" {
+		return destination.Mode
+	}
+	return config.Current().DeliveryMode
+}
+
+// DeliverWebhook posts the notification data of the message as it is to the destination url,
+// with the headers, auth and TLS settings of the destination, returning the response of the destination
+func DeliverWebhook(message delivery.Message, destination routing.Destination) (delivery.Response, error) {
+	// Metrics
+	metrics.GetOrRegisterGauge("Alert.DeliverWebhook.Attempt", nil).Update(1)
+	startTime := time.Now()
+	defer metrics.GetOrRegisterTimer("Alert.DeliverWebhook.Latency", nil).UpdateSince(startTime)
+	mSuccess := metrics.GetOrRegisterGauge("Alert.DeliverWebhook.Success", nil)
+	mNotifyErr := metrics.GetOrRegisterGauge("Alert.DeliverWebhook.Notify-Error", nil)
+
+	client, err := webhookClient(destination)
+	if err != nil {
+		mNotifyErr.Update(1)
+		return delivery.Response{}, err
+	}
+	provider, err := authProvider(destination)
+	if err != nil {
+		mNotifyErr.Update(1)
+		return delivery.Response{}, err
+	}
+
+	response, err := postWebhook(client, provider, message.Data, destination)
+	if provider != nil && unauthorized(err) {
+		// the credentials may have expired or been revoked, try once more with new ones
+		provider.Invalidate()
+		response, err = postWebhook(client, provider, message.Data, destination)
+	}
+	if err != nil {
+		mNotifyErr.Update(1)
+		return delivery.Response{}, err
+	}
+
+	log.Debugf("Notification posted to %s", destination.Name)
+	mSuccess.Update(1)
+	return response, nil
+}
+
+// postWebhook posts the data to the destination url with the headers of the destination and the
+// credentials of the provider. A response with a status code other than 2xx is returned in a StatusError.
+func postWebhook(client *http.Client, provider AuthProvider, data []byte, destination routing.Destination) (delivery.Response, error) {
+	request, err := http.NewRequest(http.MethodPost, destination.URL, bytes.NewBuffer(data))
+	if err != nil {
+		return delivery.Response{}, errors.Wrapf(err, "unable to create request to %s", destination.Name)
+	}
+	request.Header.Set("Content-Type", jsonApplication)
+	for name, value := range destination.Headers {
+		request.Header.Set(name, value)
+	}
+	credentials, err := authorization(provider, destination)
+	if err != nil {
+		return delivery.Response{}, err
+	}
+	if credentials != "" {
+		request.Header.Set("Authorization", credentials)
+	}
+	signRequest(request, data)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return delivery.Response{}, err
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"Method": "postWebhook",
+				"Action": "response.Body.Close()",
+			}).Info(err.Error())
+		}
+	}()
+
+	responded := delivery.ReadResponse(response.StatusCode, response.Body)
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return delivery.Response{}, &delivery.StatusError{StatusCode: responded.StatusCode, Body: responded.Body}
+	}
+	return responded, nil
+}
+
+// webhookClient returns the http client for the destination, creating it the first time it is needed
+func webhookClient(destination routing.Destination) (*http.Client, error) {
+	webhookClientsMutex.Lock()
+	defer webhookClientsMutex.Unlock()
+
+	if client, found := webhookClients[destination.Name]; found {
+		return client, nil
+	}
+
+	tlsConfig, err := newTLSConfig(destination.TLS)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load tls settings of %s", destination.Name)
+	}
+	client := &http.Client{
+		Timeout: time.Duration(connectionTimeout) * time.Second,
+	}
+	if tlsConfig != nil {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	webhookClients[destination.Name] = client
+	return client, nil
+}
+
+// ResetWebhookClients forgets the http clients and auth providers of the destinations, so they are recreated
+// with their current settings
+func ResetWebhookClients() {
+	webhookClientsMutex.Lock()
+	webhookClients = make(map[string]*http.Client)
+	webhookClientsMutex.Unlock()
+	resetAuthProviders()
+}
+
+func newTLSConfig(settings routing.TLS) (*tls.Config, error) {
+	if settings == (routing.TLS{}) {
+		return nil, nil
+	}
+
+	// nolint: gosec
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+	if settings.CACertFile != "" {
+		caCert, err := ioutil.ReadFile(settings.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, errors.Errorf("no certificates found in %s", settings.CACertFile)
+		}
+	}
+	if settings.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
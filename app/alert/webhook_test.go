@@ -0,0 +1,159 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/pkg/errors"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	var received []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/token":
+			if user, password, ok := request.BasicAuth(); !ok || user != "client" || password != "secret" {
+				writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = writer.Write([]byte(`{"access_token":"abc123","token_type":"bearer"}`))
+		case "/rejected":
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"error":"unknown severity"}`))
+		case "/verbose":
+			_, _ = writer.Write(bytes.Repeat([]byte("a"), 2*delivery.MaxResponseBody))
+		default:
+			received, _ = ioutil.ReadAll(request.Body)
+			header = request.Header
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+
+	message := delivery.Message{Data: []byte(`{"alert_number":22,"severity":"critical"}`)}
+	tests := []struct {
+		name          string
+		destination   routing.Destination
+		authorization string
+	}{
+		{"no auth", routing.Destination{Name: "plain", URL: server.URL + "/hook", Headers: map[string]string{"X-Source": "alert-service"}}, ""},
+		{"basic", routing.Destination{Name: "basic", URL: server.URL + "/hook", AuthType: "basic", ClientID: "client", ClientSecret: "secret"}, "Basic Y2xpZW50OnNlY3JldA=="},
+		{"oauth2", routing.Destination{Name: "oauth2", URL: server.URL + "/hook", AuthType: "oauth2", AuthEndpoint: server.URL + "/token", ClientID: "client", ClientSecret: "secret"}, "Bearer abc123"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received, header = nil, nil
+			response, err := DeliverWebhook(message, test.destination)
+			if err != nil {
+				t.Fatalf("Error delivering webhook %s", err)
+			}
+			if response.StatusCode != http.StatusNoContent {
+				t.Errorf("Expected the status code of the destination, got %d", response.StatusCode)
+			}
+			if string(received) != string(message.Data) {
+				t.Errorf("Expected the raw alert to be posted, got %s", received)
+			}
+			if header.Get("Authorization") != test.authorization {
+				t.Errorf("Expected authorization %q, got %q", test.authorization, header.Get("Authorization"))
+			}
+			for name, value := range test.destination.Headers {
+				if header.Get(name) != value {
+					t.Errorf("Expected header %s: %s, got %s", name, value, header.Get(name))
+				}
+			}
+		})
+	}
+
+	response, err := DeliverWebhook(message, routing.Destination{Name: "verbose", URL: server.URL + "/verbose"})
+	if err != nil || response.StatusCode != http.StatusOK || len(response.Body) != delivery.MaxResponseBody {
+		t.Errorf("Expected 200 with the body cut to %d bytes, got %d %d %v", delivery.MaxResponseBody, response.StatusCode, len(response.Body), err)
+	}
+	_, err = DeliverWebhook(message, routing.Destination{Name: "rejected", URL: server.URL + "/rejected"})
+	if statusErr, ok := errors.Cause(err).(*delivery.StatusError); !ok || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status error 400, got %v", err)
+	}
+	if rejected := delivery.ResponseOf(err); rejected.Body != `{"error":"unknown severity"}` {
+		t.Errorf("Expected the body of the rejection, got %q", rejected.Body)
+	}
+	_, err = DeliverWebhook(message, routing.Destination{Name: "bad-credentials", URL: server.URL + "/hook", AuthType: "oauth2", AuthEndpoint: server.URL + "/token"})
+	if err == nil {
+		t.Error("Expected error when the token request is rejected")
+	}
+}
+
+func TestDeliverWebhook_TLS(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_ = json.NewDecoder(request.Body).Decode(&received)
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+	defer ResetWebhookClients()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	caCertFile := filepath.Join(dir, "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caCertFile, caCert, 0600); err != nil {
+		t.Fatalf("Unable to write ca cert %s", err)
+	}
+
+	message := delivery.Message{Data: []byte(`{"alert_number":22}`)}
+	if _, err := DeliverWebhook(message, routing.Destination{Name: "untrusted", URL: server.URL}); err == nil {
+		t.Error("Expected error without the server certificate authority")
+	}
+	trusted := routing.Destination{Name: "trusted", URL: server.URL, TLS: routing.TLS{CACertFile: caCertFile}}
+	if _, err := DeliverWebhook(message, trusted); err != nil {
+		t.Fatalf("Error delivering webhook over tls %s", err)
+	}
+	if received["alert_number"] != float64(22) {
+		t.Errorf("Unexpected alert received %v", received)
+	}
+}
+
+func TestDeliverMessage_WebhookMode(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path = request.URL.Path
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	ResetWebhookClients()
+
+	table, err := routing.NewTable(map[string]routing.Destination{
+		"direct": {URL: server.URL + "/direct", Mode: routing.ModeWebhook},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unable to create routing table %s", err)
+	}
+	routing.SetDefaultTable(table)
+	defer routing.SetDefaultTable(nil)
+
+	if _, err := DeliverMessage(delivery.Message{Destination: "direct", Data: []byte(`{}`)}); err != nil {
+		t.Fatalf("Error delivering message %s", err)
+	}
+	if path != "/direct" {
+		t.Errorf("Expected the message to be posted to the destination, not the cloud connector, got %s", path)
+	}
+}
@@ -18,13 +18,11 @@ import (
 func buildNotWhitelistedAlert(notWhitelisted []models.ProductID) models.Alert {
 	var notWhitelistedAlert models.Alert
 	notWhitelistedAlert.SentOn = helper.UnixMilliNow()
-	notWhitelistedAlert.AlertDescription = "Received a list of ASNs that are not whitelisted!"
 	notWhitelistedAlert.DeviceID = ""
 	notWhitelistedAlert.Facilities = []string{}
 	notWhitelistedAlert.AlertNumber = alert.NotWhitelisted
-	notWhitelistedAlert.Severity = "critical"
 	notWhitelistedAlert.Optional = notWhitelisted
-	return notWhitelistedAlert
+	return models.EnrichAlert(notWhitelistedAlert)
 }
 
 func GenerateNotWhitelistedAlert(notWhitelisted []models.ProductID) ([]byte, error) {
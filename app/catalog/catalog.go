@@ -0,0 +1,194 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package catalog
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// GatewayRegistered is the alert number of a gateway seen in a heartbeat for the first time
+	GatewayRegistered = 320
+	// GatewayMissedHeartbeat is the alert number of a gateway that missed a heartbeat
+	GatewayMissedHeartbeat = 321
+	// GatewayDeregistered is the alert number of a gateway that missed the maximum number of heartbeats
+	GatewayDeregistered = 322
+	// NotWhitelisted is the alert number of advanced shipping notices with products that are not whitelisted
+	NotWhitelisted = 401
+	// ApplicationAlert is the alert number of alerts sent through the API without one
+	ApplicationAlert = 686
+)
+
+// builtIn are the alert types of the alerts the service raises itself
+var builtIn = []AlertType{
+	{
+		Number:      GatewayRegistered,
+		Name:        "gateway_registered",
+		Severity:    "info",
+		Description: "Gateway {{.DeviceID}} registered",
+		Remediation: "None, the gateway is sending heartbeats again.",
+	},
+	{
+		Number:      GatewayMissedHeartbeat,
+		Name:        "gateway_missed_heartbeat",
+		Severity:    "critical",
+		Description: "Gateway {{.DeviceID}} missed heartbeat",
+		Remediation: "Check that the gateway is running and can reach the service, it is deregistered after maxMissedHeartbeats.",
+	},
+	{
+		Number:      GatewayDeregistered,
+		Name:        "gateway_deregistered",
+		Severity:    "urgent",
+		Description: "Gateway {{.DeviceID}} deregistered",
+		Remediation: "Restart the gateway or its network connection, the alert is resolved once it registers again.",
+	},
+	{
+		Number:      NotWhitelisted,
+		Name:        "asn_not_whitelisted",
+		Severity:    "critical",
+		Description: "Received a list of ASNs that are not whitelisted!",
+		Remediation: "Add the products listed in optional to the product whitelist, or check the advanced shipping notice.",
+	},
+	{
+		Number:      ApplicationAlert,
+		Name:        "application_alert",
+		Severity:    "info",
+		Description: "Alert from {{.DeviceID}}",
+	},
+}
+
+var (
+	defaultCatalog = mustBuiltIn()
+	defaultMutex   sync.RWMutex
+)
+
+// AlertType describes the alerts with an alert number, filling in the severity and description they are sent
+// without and telling how to deal with them
+// swagger:model AlertType
+type AlertType struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	// Description is a Go template the alert is rendered with, such as Gateway {{.DeviceID}} registered
+	Description string `json:"description"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Catalog is the alert types by alert number
+type Catalog struct {
+	types        map[int]AlertType
+	descriptions map[int]*template.Template
+}
+
+// New creates a catalog of the built-in alert types along with the given alert types,
+// which replace the built-in ones with the same number
+func New(alertTypes []AlertType) (*Catalog, error) {
+	catalog := &Catalog{
+		types:        make(map[int]AlertType),
+		descriptions: make(map[int]*template.Template),
+	}
+	for _, alertType := range builtIn {
+		if err := catalog.add(alertType); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[int]bool)
+	for i, alertType := range alertTypes {
+		if alertType.Number <= 0 {
+			return nil, errors.Errorf("alert type %d must have a number greater than 0", i+1)
+		}
+		if seen[alertType.Number] {
+			return nil, errors.Errorf("alert type %d is listed more than once", alertType.Number)
+		}
+		seen[alertType.Number] = true
+		if alertType.Name == "" || alertType.Severity == "" {
+			return nil, errors.Errorf("alert type %d needs a name and a severity", alertType.Number)
+		}
+		if err := catalog.add(alertType); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+func (catalog *Catalog) add(alertType AlertType) error {
+	description, err := template.New(alertType.Name).Option("missingkey=zero").Parse(alertType.Description)
+	if err != nil {
+		return errors.Wrapf(err, "alert type %d has an invalid description template", alertType.Number)
+	}
+	catalog.types[alertType.Number] = alertType
+	catalog.descriptions[alertType.Number] = description
+	return nil
+}
+
+func mustBuiltIn() *Catalog {
+	catalog, err := New(nil)
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}
+
+// SetDefault sets the catalog alerts are filled in from, the built-in alert types when nil
+func SetDefault(catalog *Catalog) {
+	if catalog == nil {
+		catalog = mustBuiltIn()
+	}
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultCatalog = catalog
+}
+
+// Default returns the catalog alerts are filled in from
+func Default() *Catalog {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultCatalog
+}
+
+// Types returns the alert types of the catalog by alert number
+func (catalog *Catalog) Types() []AlertType {
+	types := make([]AlertType, 0, len(catalog.types))
+	for _, alertType := range catalog.types {
+		types = append(types, alertType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Number < types[j].Number
+	})
+	return types
+}
+
+// Lookup returns the alert type of the alert number
+func (catalog *Catalog) Lookup(number int) (AlertType, bool) {
+	alertType, found := catalog.types[number]
+	return alertType, found
+}
+
+// Describe renders the description of the alert number with the alert, returning false for unknown alert numbers
+func (catalog *Catalog) Describe(number int, alert interface{}) (string, bool) {
+	description, found := catalog.descriptions[number]
+	if !found {
+		return "", false
+	}
+	var rendered bytes.Buffer
+	if err := description.Execute(&rendered, alert); err != nil {
+		log.WithFields(log.Fields{
+			"Method":      "Describe",
+			"AlertNumber": number,
+			"Error":       err.Error(),
+		}).Warn("unable to render alert description")
+		return catalog.types[number].Description, true
+	}
+	return rendered.String(), true
+}
@@ -0,0 +1,66 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	catalog, err := New([]AlertType{
+		{Number: 22, Name: "sensor_offline", Severity: "critical", Description: "Sensor {{.DeviceID}} is offline", Remediation: "Power cycle the sensor."},
+		{Number: GatewayMissedHeartbeat, Name: "gateway_missed_heartbeat", Severity: "warning", Description: "Gateway {{.DeviceID}} is late"},
+	})
+	if err != nil {
+		t.Fatalf("Error creating catalog %s", err)
+	}
+
+	if alertType, found := catalog.Lookup(22); !found || alertType.Remediation != "Power cycle the sensor." {
+		t.Errorf("Expected the configured alert type, got %+v", alertType)
+	}
+	if alertType, _ := catalog.Lookup(GatewayMissedHeartbeat); alertType.Severity != "warning" {
+		t.Errorf("Expected the configured alert type to replace the built-in one, got %+v", alertType)
+	}
+	if alertType, _ := catalog.Lookup(GatewayDeregistered); alertType.Severity != "urgent" {
+		t.Errorf("Expected the built-in alert types to be kept, got %+v", alertType)
+	}
+	if _, found := catalog.Lookup(23); found {
+		t.Error("Expected no alert type for an unknown number")
+	}
+
+	alert := struct{ DeviceID string }{"Sensor1"}
+	if description, found := catalog.Describe(22, alert); !found || description != "Sensor Sensor1 is offline" {
+		t.Errorf("Expected the description rendered with the alert, got %q", description)
+	}
+	if _, found := catalog.Describe(23, alert); found {
+		t.Error("Expected no description for an unknown number")
+	}
+	if types := catalog.Types(); len(types) != 6 || types[0].Number != 22 {
+		t.Errorf("Expected the alert types by number, got %+v", types)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		alertTypes []AlertType
+		expected   string
+	}{
+		{"no number", []AlertType{{Name: "a", Severity: "info"}}, "greater than 0"},
+		{"duplicate", []AlertType{{Number: 1, Name: "a", Severity: "info"}, {Number: 1, Name: "b", Severity: "info"}}, "more than once"},
+		{"no severity", []AlertType{{Number: 1, Name: "a"}}, "name and a severity"},
+		{"bad template", []AlertType{{Number: 1, Name: "a", Severity: "info", Description: "{{.DeviceID"}}, "description template"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.alertTypes); err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error about %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
@@ -7,12 +7,19 @@
 package config
 
 import (
+	"encoding/json"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/configuration"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 type (
-	variables struct {
+	// Variables are the settings of the service
+	Variables struct {
 		ServiceName, LoggingLevel, Port                        string
 		NotificationChanSize                                   int
 		CloudConnectorURL, CloudConnectorEndpoint              string
@@ -26,133 +33,292 @@ type (
 		SendNotWhitelistedAlert                                bool
 		AlertDestinationAuthEndpoint, AlertDestinationAuthType string
 		AlertDestinationClientID, AlertDestinationClientSecret string
+		DatabasePath                                           string
+		AlertHistoryMaxAgeDays, AlertHistoryMaxRecords         int
+		DeliveryMaxAttempts                                    int
+		DeliveryInitialBackoffMillis, DeliveryMaxBackoffMillis int
+		DeliveryBackoffMultiplier, DeliveryBackoffJitter       float64
+		DedupWindowSeconds                                     int
+		ShutdownTimeoutSeconds                                 int
+		ConfigWatchSeconds                                     int
+		SigningKey, SigningKeyID                               string
+		APIKeys                                                []middlewares.APIKey
+		JWTSecret                                              string
+		RateLimitPerSecond                                     float64
+		RateLimitBurst                                         int
+		RateLimitKey                                           string
+		IdempotencyKeyTTLSeconds                               int
+		DeliveryMode                                           string
+		Destinations                                           map[string]routing.Destination
+		Routes                                                 []routing.Route
+		AlertTypes                                             []catalog.AlertType
 	}
 )
 
 // AppConfig exports all config variables
-var AppConfig variables
+var AppConfig Variables
+
+// InitConfig loads application variables from the named section of the configuration, falling back to the
+// settings outside of any section, read from the configuration file at file unless they come from Consul.
+// Without a file, it is looked up by the configuration library and is not watched for changes.
+func InitConfig(section string, file string) error {
+	// reloads read the same section and file
+	sectionName, filePath = section, file
+
+	config, err := newSource()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+	}
+
+	if usesConsul() {
+		consulSource = config
+		config.SetConfigChangeCallback(func([]configuration.ChangeDetails) {
+			if _, err := Reload(); err != nil {
+				log.WithFields(log.Fields{
+					"Method": "InitConfig",
+					"Action": "Reload configuration from Consul",
+					"Error":  err.Error(),
+				}).Error("Unable to reload configuration")
+			}
+		})
+	}
 
-// InitConfig loads application variables
-func InitConfig() error {
+	loaded, err := load(config)
 
-	AppConfig = variables{}
+	mutex.Lock()
+	AppConfig = loaded
+	mutex.Unlock()
+	return err
+}
+
+// load reads the application variables from the configuration and validates them,
+// returning every problem found as Problems
+func load(config *configuration.Configuration) (Variables, error) {
+
+	loaded := Variables{}
+	var problems Problems
 
 	var err error
 
-	config, err := configuration.NewConfiguration()
+	loaded.ServiceName, err = config.GetString("serviceName")
+	problems.addRequired("serviceName", err)
+
+	loaded.WatchdogSeconds, err = config.GetInt("watchdogSeconds")
+	problems.addRequired("watchdogSeconds", err)
+
+	loaded.NotificationChanSize, err = config.GetInt("notificationChanSize")
+	problems.addRequired("notificationChanSize", err)
+
+	loaded.CloudConnectorURL, err = config.GetString("cloudConnectorURL")
+	problems.addRequired("cloudConnectorURL", err)
+
+	loaded.CloudConnectorEndpoint, err = config.GetString("cloudConnectorEndpoint")
+	problems.addRequired("cloudConnectorEndpoint", err)
+
+	loaded.MaxMissedHeartbeats, err = config.GetInt("maxMissedHeartbeats")
+	problems.addRequired("maxMissedHeartbeats", err)
+
+	loaded.Port, err = config.GetString("port")
+	problems.addRequired("port", err)
+
+	// Set "debug" for development purposes. Nil for Production.
+	loaded.LoggingLevel, err = config.GetString("loggingLevel")
+	problems.addRequired("loggingLevel", err)
+
+	loaded.TelemetryEndpoint, err = config.GetString("telemetryEndpoint")
+	problems.addRequired("telemetryEndpoint", err)
+
+	loaded.TelemetryDataStoreName, err = config.GetString("telemetryDataStoreName")
+	problems.addRequired("telemetryDataStoreName", err)
+
+	loaded.MappingSkuURL, err = config.GetString("mappingSkuURL")
+	problems.addRequired("mappingSkuURL", err)
+
+	loaded.MappingSkuEndpoint, err = config.GetString("mappingSkuEndpoint")
+	problems.addRequired("mappingSkuEndpoint", err)
+
+	loaded.AlertDestination, err = config.GetString("alertDestination")
+	problems.addRequired("alertDestination", err)
+
+	loaded.HeartbeatDestination, err = config.GetString("heartbeatDestination")
+	problems.addRequired("heartbeatDestination", err)
+
+	loaded.BatchSizeMax, err = config.GetInt("batchSizeMax")
+	problems.addRequired("batchSizeMax", err)
+
+	loaded.SendNotWhitelistedAlert, err = config.GetBool("sendNotWhitelistedAlert")
+	problems.addRequired("sendNotWhitelistedAlert", err)
+
+	loaded.AlertDestinationAuthEndpoint, err = config.GetString("alertDestinationAuthEndpoint")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.AlertDestinationAuthEndpoint = ""
+		problems.addOptional("alertDestinationAuthEndpoint", err)
 	}
 
-	AppConfig.ServiceName, err = config.GetString("serviceName")
+	loaded.AlertDestinationAuthType, err = config.GetString("alertDestinationAuthType")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.AlertDestinationAuthType = ""
+		problems.addOptional("alertDestinationAuthType", err)
 	}
 
-	AppConfig.WatchdogSeconds, err = config.GetInt("watchdogSeconds")
+	loaded.AlertDestinationClientID, err = config.GetString("alertDestinationClientID")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
-	}
-	if AppConfig.WatchdogSeconds < 0 {
-		return errors.New("Negative value not accepted")
+		loaded.AlertDestinationClientID = ""
+		problems.addOptional("alertDestinationClientID", err)
 	}
 
-	AppConfig.NotificationChanSize, err = config.GetInt("notificationChanSize")
+	loaded.AlertDestinationClientSecret, err = config.GetString("alertDestinationClientSecret")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.AlertDestinationClientSecret = ""
+		problems.addOptional("alertDestinationClientSecret", err)
 	}
 
-	AppConfig.CloudConnectorURL, err = config.GetString("cloudConnectorURL")
+	loaded.DatabasePath, err = config.GetString("databasePath")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DatabasePath = "alert-service.db"
+		problems.addOptional("databasePath", err)
 	}
 
-	AppConfig.CloudConnectorEndpoint, err = config.GetString("cloudConnectorEndpoint")
+	loaded.AlertHistoryMaxAgeDays, err = config.GetInt("alertHistoryMaxAgeDays")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.AlertHistoryMaxAgeDays = 30
+		problems.addOptional("alertHistoryMaxAgeDays", err)
 	}
 
-	AppConfig.MaxMissedHeartbeats, err = config.GetInt("maxMissedHeartbeats")
+	loaded.AlertHistoryMaxRecords, err = config.GetInt("alertHistoryMaxRecords")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
-	}
-	if AppConfig.MaxMissedHeartbeats < 0 {
-		return errors.New("Negative value not accepted")
+		loaded.AlertHistoryMaxRecords = 100000
+		problems.addOptional("alertHistoryMaxRecords", err)
 	}
 
-	AppConfig.Port, err = config.GetString("port")
+	loaded.DeliveryMaxAttempts, err = config.GetInt("deliveryMaxAttempts")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DeliveryMaxAttempts = 10
+		problems.addOptional("deliveryMaxAttempts", err)
 	}
 
-	// Set "debug" for development purposes. Nil for Production.
-	AppConfig.LoggingLevel, err = config.GetString("loggingLevel")
+	loaded.DeliveryInitialBackoffMillis, err = config.GetInt("deliveryInitialBackoffMillis")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DeliveryInitialBackoffMillis = 1000
+		problems.addOptional("deliveryInitialBackoffMillis", err)
 	}
 
-	AppConfig.TelemetryEndpoint, err = config.GetString("telemetryEndpoint")
+	loaded.DeliveryMaxBackoffMillis, err = config.GetInt("deliveryMaxBackoffMillis")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DeliveryMaxBackoffMillis = 300000
+		problems.addOptional("deliveryMaxBackoffMillis", err)
 	}
 
-	AppConfig.TelemetryDataStoreName, err = config.GetString("telemetryDataStoreName")
+	loaded.DeliveryBackoffMultiplier, err = config.GetFloat("deliveryBackoffMultiplier")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DeliveryBackoffMultiplier = 2
+		problems.addOptional("deliveryBackoffMultiplier", err)
 	}
 
-	AppConfig.MappingSkuURL, err = config.GetString("mappingSkuURL")
+	loaded.DeliveryBackoffJitter, err = config.GetFloat("deliveryBackoffJitter")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DeliveryBackoffJitter = 0.2
+		problems.addOptional("deliveryBackoffJitter", err)
 	}
-	AppConfig.MappingSkuEndpoint, err = config.GetString("mappingSkuEndpoint")
+
+	loaded.DedupWindowSeconds, err = config.GetInt("dedupWindowSeconds")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.DedupWindowSeconds = 60
+		problems.addOptional("dedupWindowSeconds", err)
 	}
 
-	AppConfig.AlertDestination, err = config.GetString("alertDestination")
+	loaded.ShutdownTimeoutSeconds, err = config.GetInt("shutdownTimeoutSeconds")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.ShutdownTimeoutSeconds = 10
+		problems.addOptional("shutdownTimeoutSeconds", err)
 	}
 
-	AppConfig.HeartbeatDestination, err = config.GetString("heartbeatDestination")
+	loaded.ConfigWatchSeconds, err = config.GetInt("configWatchSeconds")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.ConfigWatchSeconds = 10
+		problems.addOptional("configWatchSeconds", err)
 	}
 
-	AppConfig.BatchSizeMax, err = config.GetInt("batchSizeMax")
+	loaded.SigningKey, err = config.GetString("signingKey")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.SigningKey = ""
+		problems.addOptional("signingKey", err)
 	}
 
-	AppConfig.SendNotWhitelistedAlert, err = config.GetBool("sendNotWhitelistedAlert")
+	loaded.SigningKeyID, err = config.GetString("signingKeyID")
 	if err != nil {
-		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+		loaded.SigningKeyID = ""
+		problems.addOptional("signingKeyID", err)
 	}
 
-	AppConfig.AlertDestinationAuthEndpoint, err = config.GetString("alertDestinationAuthEndpoint")
+	loaded.JWTSecret, err = config.GetString("jwtSecret")
 	if err != nil {
-		AppConfig.AlertDestinationAuthEndpoint = ""
-		err = nil
+		loaded.JWTSecret = ""
+		problems.addOptional("jwtSecret", err)
 	}
 
-	AppConfig.AlertDestinationAuthType, err = config.GetString("alertDestinationAuthType")
+	loaded.RateLimitPerSecond, err = config.GetFloat("rateLimitPerSecond")
 	if err != nil {
-		AppConfig.AlertDestinationAuthType = ""
-		err = nil
+		loaded.RateLimitPerSecond = 10
+		problems.addOptional("rateLimitPerSecond", err)
 	}
 
-	AppConfig.AlertDestinationClientID, err = config.GetString("alertDestinationClientID")
+	loaded.RateLimitBurst, err = config.GetInt("rateLimitBurst")
 	if err != nil {
-		AppConfig.AlertDestinationClientID = ""
-		err = nil
+		loaded.RateLimitBurst = 20
+		problems.addOptional("rateLimitBurst", err)
+	}
+
+	loaded.RateLimitKey, err = config.GetString("rateLimitKey")
+	if err != nil || loaded.RateLimitKey == "" {
+		loaded.RateLimitKey = middlewares.RateLimitByIP
+		problems.addOptional("rateLimitKey", err)
 	}
 
-	AppConfig.AlertDestinationClientSecret, err = config.GetString("alertDestinationClientSecret")
+	loaded.IdempotencyKeyTTLSeconds, err = config.GetInt("idempotencyKeyTTLSeconds")
 	if err != nil {
-		AppConfig.AlertDestinationClientSecret = ""
-		err = nil
+		loaded.IdempotencyKeyTTLSeconds = 86400
+		problems.addOptional("idempotencyKeyTTLSeconds", err)
+	}
+
+	loaded.DeliveryMode, err = config.GetString("deliveryMode")
+	if err != nil || loaded.DeliveryMode == "" {
+		loaded.DeliveryMode = routing.ModeCloudConnector
+		problems.addOptional("deliveryMode", err)
+	}
+
+	// The routing table is optional, without it alerts and heartbeats go to alertDestination and heartbeatDestination
+	if err := parseJSONValue(config.GetParsedJson()["destinations"], &loaded.Destinations); err != nil {
+		problems.add("destinations", err.Error())
+	}
+	if err := parseJSONValue(config.GetParsedJson()["routes"], &loaded.Routes); err != nil {
+		problems.add("routes", err.Error())
 	}
+	// Without API keys or a JWT secret the HTTP API is open to every caller
+	if err := parseJSONValue(config.GetParsedJson()["apiKeys"], &loaded.APIKeys); err != nil {
+		problems.add("apiKeys", err.Error())
+	}
+	// The alert types add to, or replace, the built-in entries of the alert catalog
+	if err := parseJSONValue(config.GetParsedJson()["alertTypes"], &loaded.AlertTypes); err != nil {
+		problems.add("alertTypes", err.Error())
+	}
+
+	// settings that could not be read are not validated any further
+	problems.validate(loaded)
+	if len(problems) > 0 {
+		return loaded, problems
+	}
+	return loaded, nil
+}
 
-	return nil
+// parseJSONValue converts a nested value of the configuration into the given struct
+func parseJSONValue(value interface{}, v interface{}) error {
+	if value == nil {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
 }
@@ -0,0 +1,339 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/configuration"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// masked replaces secrets in the changes reported by a reload
+const masked = "******"
+
+var (
+	// mutex guards AppConfig while a reload replaces it
+	mutex sync.RWMutex
+	// reloadMutex keeps reloads from running at the same time
+	reloadMutex sync.Mutex
+
+	reloadHandler      func(previous Variables, next Variables) error
+	reloadHandlerMutex sync.RWMutex
+
+	// sectionName is the section of the configuration the service reads its settings from first
+	sectionName string
+	// filePath is the configuration file the settings are read from without Consul, or empty when the
+	// configuration library looks it up
+	filePath string
+	// consulSource is the configuration loaded from Consul, which its watcher keeps up to date, or nil without Consul
+	consulSource *configuration.Configuration
+)
+
+// restartSettings only take effect when the service starts, a reload keeps their current values
+var restartSettings = map[string]bool{
+	"serviceName":                  true,
+	"port":                         true,
+	"notificationChanSize":         true,
+	"telemetryEndpoint":            true,
+	"telemetryDataStoreName":       true,
+	"databasePath":                 true,
+	"deliveryMaxAttempts":          true,
+	"deliveryInitialBackoffMillis": true,
+	"deliveryMaxBackoffMillis":     true,
+	"deliveryBackoffMultiplier":    true,
+	"deliveryBackoffJitter":        true,
+	"dedupWindowSeconds":           true,
+}
+
+// secretSettings are masked in the changes reported by a reload
+var secretSettings = map[string]bool{
+	"alertDestinationClientSecret": true,
+	"signingKey":                   true,
+	"apiKeys":                      true,
+	"jwtSecret":                    true,
+}
+
+// Change is a setting with a different value after a reload
+// swagger:model ConfigChange
+type Change struct {
+	// Setting is the name of the setting, destinations.{name} for each destination
+	Setting string `json:"setting"`
+	// Old is the previous value, left out for a destination that was added
+	Old interface{} `json:"old,omitempty"`
+	// New is the reloaded value, left out for a destination that was removed
+	New interface{} `json:"new,omitempty"`
+	// Applied is false for settings that only take effect once the service is restarted
+	Applied bool `json:"applied"`
+}
+
+// Current returns a copy of the configuration, safe to read while the configuration is reloaded
+func Current() Variables {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return AppConfig
+}
+
+// Set replaces the current configuration without a reload, so settings can be changed while the
+// configuration is read, such as in tests
+func Set(settings Variables) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	AppConfig = settings
+}
+
+// SetReloadHandler sets the function that applies a reloaded configuration to the rest of the service,
+// such as the routing table, before it replaces the current configuration. A reload is abandoned when
+// the function returns an error.
+func SetReloadHandler(handler func(previous Variables, next Variables) error) {
+	reloadHandlerMutex.Lock()
+	defer reloadHandlerMutex.Unlock()
+	reloadHandler = handler
+}
+
+// Reload reads the configuration again, replaces the current configuration with it and logs and returns
+// the settings that changed. Settings that need a restart keep their current values. Nothing changes
+// when the configuration cannot be read or applied.
+func Reload() ([]Change, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	source := consulSource
+	if source == nil {
+		var err error
+		source, err = newSource()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to reload config variables: %s", err.Error())
+		}
+	}
+	next, err := load(source)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := Current()
+	changes := Diff(previous, next)
+	keepRestartSettings(&next, previous)
+	if len(changes) == 0 {
+		log.Info("Configuration reloaded without changes")
+		return changes, nil
+	}
+
+	reloadHandlerMutex.RLock()
+	handler := reloadHandler
+	reloadHandlerMutex.RUnlock()
+	if handler != nil {
+		if err := handler(previous, next); err != nil {
+			return nil, errors.Wrap(err, "unable to apply reloaded configuration")
+		}
+	}
+
+	mutex.Lock()
+	AppConfig = next
+	mutex.Unlock()
+
+	for _, change := range changes {
+		entry := log.WithFields(log.Fields{
+			"Setting": change.Setting,
+			"Old":     change.Old,
+			"New":     change.New,
+		})
+		if change.Applied {
+			entry.Info("Configuration changed")
+		} else {
+			entry.Warn("Configuration changed, restart the service to apply it")
+		}
+	}
+	return changes, nil
+}
+
+// Diff lists the settings that differ between two configurations, with a change for each destination
+// that was added, removed or changed. Secrets are masked.
+func Diff(previous Variables, next Variables) []Change {
+	changes := []Change{}
+	previousValue, nextValue := reflect.ValueOf(previous), reflect.ValueOf(next)
+	for i := 0; i < previousValue.NumField(); i++ {
+		setting := settingName(previousValue.Type().Field(i).Name)
+		if setting == "destinations" {
+			changes = append(changes, destinationChanges(previous.Destinations, next.Destinations)...)
+			continue
+		}
+
+		oldValue, newValue := previousValue.Field(i).Interface(), nextValue.Field(i).Interface()
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if secretSettings[setting] {
+			oldValue, newValue = masked, masked
+		}
+		changes = append(changes, Change{Setting: setting, Old: oldValue, New: newValue, Applied: !restartSettings[setting]})
+	}
+	return changes
+}
+
+func destinationChanges(previous map[string]routing.Destination, next map[string]routing.Destination) []Change {
+	var names []string
+	for name := range previous {
+		names = append(names, name)
+	}
+	for name := range next {
+		if _, found := previous[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	for _, name := range names {
+		oldDestination, wasFound := previous[name]
+		newDestination, isFound := next[name]
+		if wasFound && isFound && reflect.DeepEqual(oldDestination, newDestination) {
+			continue
+		}
+		change := Change{Setting: "destinations." + name, Applied: true}
+		if wasFound {
+			change.Old = maskDestination(oldDestination)
+		}
+		if isFound {
+			change.New = maskDestination(newDestination)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// maskDestination hides the client secret, passwords and header values of the destination
+func maskDestination(destination routing.Destination) routing.Destination {
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return masked
+	}
+	destination.ClientSecret = mask(destination.ClientSecret)
+	destination.Token = mask(destination.Token)
+	destination.MQTT.Password = mask(destination.MQTT.Password)
+	destination.Email.Password = mask(destination.Email.Password)
+	if destination.Headers != nil {
+		headers := make(map[string]string, len(destination.Headers))
+		for name, value := range destination.Headers {
+			headers[name] = mask(value)
+		}
+		destination.Headers = headers
+	}
+	return destination
+}
+
+// keepRestartSettings gives the settings that need a restart their previous values
+func keepRestartSettings(next *Variables, previous Variables) {
+	nextValue, previousValue := reflect.ValueOf(next).Elem(), reflect.ValueOf(previous)
+	for i := 0; i < nextValue.NumField(); i++ {
+		if restartSettings[settingName(nextValue.Type().Field(i).Name)] {
+			nextValue.Field(i).Set(previousValue.Field(i))
+		}
+	}
+}
+
+// settingName is the name of the setting in the configuration file for a field of Variables
+func settingName(field string) string {
+	first, size := utf8.DecodeRuneInString(field)
+	return string(unicode.ToLower(first)) + field[size:]
+}
+
+// usesConsul reports whether the configuration library loads the configuration from Consul
+func usesConsul() bool {
+	_, urlOk := os.LookupEnv("consulUrl")
+	_, keyOk := os.LookupEnv("consulConfigKey")
+	return urlOk && keyOk
+}
+
+// newSource reads the section of the configuration from Consul, or else from the configuration file
+func newSource() (*configuration.Configuration, error) {
+	source, err := configuration.NewSectionedConfiguration(sectionName)
+	if err != nil {
+		return nil, err
+	}
+	if path := FilePath(); path != "" {
+		if err := source.Load(path); err != nil {
+			return nil, errors.Wrapf(err, "unable to read configuration file %s", path)
+		}
+	}
+	return source, nil
+}
+
+// FilePath returns the configuration file the settings are read from, as passed to InitConfig, or an empty
+// string when the configuration comes from Consul
+func FilePath() string {
+	if usesConsul() {
+		return ""
+	}
+	return filePath
+}
+
+// WatchFile reloads the configuration whenever the configuration file changes, checking it every
+// configWatchSeconds until stop is closed. Nothing is watched without a configuration file, or when
+// the configuration comes from Consul, whose changes are reloaded as they are made.
+func WatchFile(stop <-chan struct{}) {
+	path := FilePath()
+	if path == "" {
+		return
+	}
+	watchFile(path, func() time.Duration {
+		return time.Duration(Current().ConfigWatchSeconds) * time.Second
+	}, stop)
+}
+
+// watchFile calls Reload when the modification time or size of the file changes, waiting the
+// interval between checks. Checks are paused while the interval is 0.
+func watchFile(path string, interval func() time.Duration, stop <-chan struct{}) {
+	modified, size := fileVersion(path)
+	for {
+		wait := interval()
+		paused := wait <= 0
+		if paused {
+			wait = time.Second
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		if paused {
+			continue
+		}
+
+		currentModified, currentSize := fileVersion(path)
+		if currentModified.Equal(modified) && currentSize == size {
+			continue
+		}
+		modified, size = currentModified, currentSize
+		log.WithField("File", path).Info("Configuration file changed, reloading")
+		if _, err := Reload(); err != nil {
+			log.WithFields(log.Fields{
+				"Method": "watchFile",
+				"Action": "Reload configuration",
+				"Error":  err.Error(),
+			}).Error("Unable to reload configuration")
+		}
+	}
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,209 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/pkg/errors"
+)
+
+func TestReload(t *testing.T) {
+	if err := InitConfig("", ""); err != nil {
+		t.Fatalf("Unable to load configuration %s", err)
+	}
+	loaded := Current()
+	defer func() {
+		AppConfig = loaded
+		SetReloadHandler(nil)
+	}()
+
+	// nothing changed since the configuration was loaded
+	changes, err := Reload()
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %v %v", changes, err)
+	}
+
+	AppConfig.WatchdogSeconds = loaded.WatchdogSeconds + 1
+	AppConfig.Port = "1"
+	AppConfig.AlertDestinationClientSecret = "previous"
+
+	// a failing handler leaves the configuration as it is
+	SetReloadHandler(func(previous Variables, next Variables) error {
+		return errors.New("invalid routing table")
+	})
+	if _, err := Reload(); err == nil {
+		t.Fatal("Expected the reload to fail")
+	}
+	if Current().WatchdogSeconds != loaded.WatchdogSeconds+1 {
+		t.Fatal("Expected the configuration to be kept when the reload fails")
+	}
+
+	var handled Variables
+	SetReloadHandler(func(previous Variables, next Variables) error {
+		handled = next
+		return nil
+	})
+	changes, err = Reload()
+	if err != nil {
+		t.Fatalf("Unable to reload %s", err)
+	}
+	expected := []Change{
+		{Setting: "port", Old: "1", New: loaded.Port, Applied: false},
+		{Setting: "watchdogSeconds", Old: loaded.WatchdogSeconds + 1, New: loaded.WatchdogSeconds, Applied: true},
+		{Setting: "alertDestinationClientSecret", Old: masked, New: masked, Applied: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+	current := Current()
+	if current.WatchdogSeconds != loaded.WatchdogSeconds || current.Port != "1" || !reflect.DeepEqual(handled, current) {
+		t.Errorf("Expected the watchdog to be reloaded and the port to be kept until restart, got %+v", current)
+	}
+}
+
+func TestDiffDestinations(t *testing.T) {
+	previous := Variables{Destinations: map[string]routing.Destination{
+		"ops":     {URL: "http://ops.example.com", ClientSecret: "secret"},
+		"removed": {URL: "http://removed.example.com"},
+		"same":    {URL: "http://same.example.com"},
+	}}
+	next := Variables{Destinations: map[string]routing.Destination{
+		"added": {URL: "tcp://broker:1883", Mode: routing.ModeMQTT, MQTT: routing.MQTT{Password: "secret"}},
+		"ops":   {URL: "http://ops.example.com", ClientSecret: "rotated", Headers: map[string]string{"Authorization": "token"}},
+		"same":  {URL: "http://same.example.com"},
+	}}
+
+	changes := Diff(previous, next)
+	expected := []Change{
+		{Setting: "destinations.added", New: routing.Destination{URL: "tcp://broker:1883", Mode: routing.ModeMQTT, MQTT: routing.MQTT{Password: masked}}, Applied: true},
+		{Setting: "destinations.ops",
+			Old:     routing.Destination{URL: "http://ops.example.com", ClientSecret: masked},
+			New:     routing.Destination{URL: "http://ops.example.com", ClientSecret: masked, Headers: map[string]string{"Authorization": masked}},
+			Applied: true},
+		{Setting: "destinations.removed", Old: routing.Destination{URL: "http://removed.example.com"}, Applied: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v", expected, changes)
+	}
+	if next.Destinations["ops"].Headers["Authorization"] != "token" {
+		t.Error("Expected masking to leave the configuration unchanged")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "configuration.json")
+	if err := ioutil.WriteFile(file, []byte(`{}`), 0600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	if err := InitConfig("", ""); err != nil {
+		t.Fatalf("Unable to load configuration %s", err)
+	}
+	loaded := Current()
+	defer func() {
+		AppConfig = loaded
+		SetReloadHandler(nil)
+	}()
+	var reloads int32
+	SetReloadHandler(func(previous Variables, next Variables) error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	})
+	// the reload finds a change as long as the current configuration differs from the file
+	mutex.Lock()
+	AppConfig.MaxMissedHeartbeats = loaded.MaxMissedHeartbeats + 1
+	mutex.Unlock()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		watchFile(file, func() time.Duration { return 10 * time.Millisecond }, stop)
+		close(stopped)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&reloads) != 0 {
+		t.Fatal("Expected no reload while the file is unchanged")
+	}
+	if err := ioutil.WriteFile(file, []byte(`{"watchdogSeconds": 1}`), 0600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&reloads) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&reloads) != 1 {
+		t.Errorf("Expected a reload once the file changed, got %d", reloads)
+	}
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the watcher to return once stopped")
+	}
+}
+
+func TestInitConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	settings, err := ioutil.ReadFile("configuration.json")
+	if err != nil {
+		t.Fatalf("Unable to read configuration %s", err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(settings, &parsed); err != nil {
+		t.Fatalf("Unable to parse configuration %s", err)
+	}
+	parsed["alert-service"] = map[string]interface{}{"watchdogSeconds": 7}
+	settings, _ = json.Marshal(parsed)
+	file := filepath.Join(dir, "configuration.json")
+	if err := ioutil.WriteFile(file, settings, 0600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	loaded := Current()
+	defer func() {
+		sectionName, filePath = "", ""
+		AppConfig = loaded
+	}()
+	if err := InitConfig("alert-service", file); err != nil {
+		t.Fatalf("Unable to load configuration %s", err)
+	}
+	if FilePath() != file {
+		t.Errorf("Expected the file passed in to be watched, got %s", FilePath())
+	}
+	if Current().WatchdogSeconds != 7 {
+		t.Errorf("Expected the setting of the section, got %d", Current().WatchdogSeconds)
+	}
+
+	parsed["alert-service"] = map[string]interface{}{"watchdogSeconds": 8}
+	settings, _ = json.Marshal(parsed)
+	if err := ioutil.WriteFile(file, settings, 0600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	if _, err := Reload(); err != nil || Current().WatchdogSeconds != 8 {
+		t.Errorf("Expected the reload to read the same section and file, got %d %v", Current().WatchdogSeconds, err)
+	}
+}
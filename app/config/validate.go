@@ -0,0 +1,204 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
+)
+
+// minJWTSecretLength keeps the secret of the HS256 tokens as long as the hash, 32 bytes
+const minJWTSecretLength = 32
+
+// minNotificationChanSize keeps the notification channel larger than the margin NotifyChannel warns within
+const minNotificationChanSize = 10
+
+// Problem is something wrong with a setting of the configuration
+type Problem struct {
+	Setting string
+	Message string
+}
+
+// Problems lists everything wrong with the configuration, reported together as one error
+type Problems []Problem
+
+func (problems Problems) Error() string {
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Setting + " " + problem.Message
+	}
+	return fmt.Sprintf("invalid configuration, %d problems: %s", len(problems), strings.Join(messages, "; "))
+}
+
+func (problems *Problems) add(setting string, format string, args ...interface{}) {
+	*problems = append(*problems, Problem{Setting: setting, Message: fmt.Sprintf(format, args...)})
+}
+
+// addRequired adds the error reading a setting that must be set
+func (problems *Problems) addRequired(setting string, err error) {
+	if err == nil {
+		return
+	}
+	if missing(err) {
+		problems.add(setting, "is required")
+		return
+	}
+	problems.add(setting, "is not valid, %s", err.Error())
+}
+
+// addOptional adds the error reading a setting that has a default, unless the setting is simply not set
+func (problems *Problems) addOptional(setting string, err error) {
+	if err == nil || missing(err) {
+		return
+	}
+	problems.add(setting, "is not valid, %s", err.Error())
+}
+
+// missing reports whether the configuration library could not find the setting, rather than read it
+func missing(err error) bool {
+	return strings.HasSuffix(err.Error(), " not found")
+}
+
+// Validate checks the ranges, urls and related settings of the configuration, returning every problem found as Problems
+func Validate(settings Variables) error {
+	var problems Problems
+	problems.validate(settings)
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validate adds the problems of the settings, leaving out the settings that already have a problem
+func (problems *Problems) validate(settings Variables) {
+	reported := make(map[string]bool)
+	for _, problem := range *problems {
+		reported[problem.Setting] = true
+	}
+	check := func(setting string, valid bool, format string, args ...interface{}) {
+		if !valid && !reported[setting] {
+			problems.add(setting, format, args...)
+			reported[setting] = true
+		}
+	}
+
+	check("serviceName", settings.ServiceName != "", "must not be empty")
+	check("port", validPort(settings.Port), "must be a port number between 1 and 65535, got %q", settings.Port)
+	check("loggingLevel", validLoggingLevel(settings.LoggingLevel), "must be error, warn, info or debug, got %q", settings.LoggingLevel)
+	check("notificationChanSize", settings.NotificationChanSize >= minNotificationChanSize,
+		"must be at least %d, got %d", minNotificationChanSize, settings.NotificationChanSize)
+	check("watchdogSeconds", settings.WatchdogSeconds > 0, "must be greater than 0, got %d", settings.WatchdogSeconds)
+	check("maxMissedHeartbeats", settings.MaxMissedHeartbeats >= 0, "must not be negative, got %d", settings.MaxMissedHeartbeats)
+	check("batchSizeMax", settings.BatchSizeMax > 0, "must be greater than 0, got %d", settings.BatchSizeMax)
+
+	check("cloudConnectorURL", validURL(settings.CloudConnectorURL), "must be an http or https url, got %q", settings.CloudConnectorURL)
+	check("cloudConnectorEndpoint", strings.HasPrefix(settings.CloudConnectorEndpoint, "/"),
+		"must be a path starting with /, got %q", settings.CloudConnectorEndpoint)
+	check("mappingSkuURL", validURL(settings.MappingSkuURL), "must be an http or https url, got %q", settings.MappingSkuURL)
+	check("mappingSkuEndpoint", strings.HasPrefix(settings.MappingSkuEndpoint, "/"),
+		"must be a path starting with /, got %q", settings.MappingSkuEndpoint)
+	check("alertDestination", settings.AlertDestination == "" || validURL(settings.AlertDestination),
+		"must be an http or https url, got %q", settings.AlertDestination)
+	check("heartbeatDestination", settings.HeartbeatDestination == "" || validURL(settings.HeartbeatDestination),
+		"must be an http or https url, got %q", settings.HeartbeatDestination)
+	check("telemetryEndpoint", settings.TelemetryEndpoint == "" || validURL(settings.TelemetryEndpoint),
+		"must be an http or https url, got %q", settings.TelemetryEndpoint)
+
+	// the alertDestination auth settings only work together, all of them set or none
+	auth := []struct {
+		setting string
+		value   string
+	}{
+		{"alertDestinationAuthType", settings.AlertDestinationAuthType},
+		{"alertDestinationAuthEndpoint", settings.AlertDestinationAuthEndpoint},
+		{"alertDestinationClientID", settings.AlertDestinationClientID},
+		{"alertDestinationClientSecret", settings.AlertDestinationClientSecret},
+	}
+	authSet := 0
+	for _, field := range auth {
+		if field.value != "" {
+			authSet++
+		}
+	}
+	if authSet > 0 {
+		for _, field := range auth {
+			check(field.setting, field.value != "", "must be set along with the other alertDestination auth settings")
+		}
+	}
+	authType := strings.ToLower(settings.AlertDestinationAuthType)
+	check("alertDestinationAuthType", authType == "" || authType == "basic" || authType == "oauth2",
+		"must be basic or oauth2, got %q", settings.AlertDestinationAuthType)
+	check("alertDestinationAuthEndpoint", settings.AlertDestinationAuthEndpoint == "" || validURL(settings.AlertDestinationAuthEndpoint),
+		"must be an http or https url, got %q", settings.AlertDestinationAuthEndpoint)
+
+	check("databasePath", settings.DatabasePath != "", "must not be empty")
+	check("alertHistoryMaxAgeDays", settings.AlertHistoryMaxAgeDays >= 0, "must not be negative, got %d", settings.AlertHistoryMaxAgeDays)
+	check("alertHistoryMaxRecords", settings.AlertHistoryMaxRecords >= 0, "must not be negative, got %d", settings.AlertHistoryMaxRecords)
+	check("deliveryMaxAttempts", settings.DeliveryMaxAttempts > 0, "must be greater than 0, got %d", settings.DeliveryMaxAttempts)
+	check("deliveryInitialBackoffMillis", settings.DeliveryInitialBackoffMillis > 0,
+		"must be greater than 0, got %d", settings.DeliveryInitialBackoffMillis)
+	check("deliveryMaxBackoffMillis", settings.DeliveryMaxBackoffMillis >= settings.DeliveryInitialBackoffMillis,
+		"must not be less than deliveryInitialBackoffMillis, got %d", settings.DeliveryMaxBackoffMillis)
+	check("deliveryBackoffMultiplier", settings.DeliveryBackoffMultiplier >= 1,
+		"must be at least 1, got %g", settings.DeliveryBackoffMultiplier)
+	check("deliveryBackoffJitter", settings.DeliveryBackoffJitter >= 0 && settings.DeliveryBackoffJitter <= 1,
+		"must be between 0 and 1, got %g", settings.DeliveryBackoffJitter)
+	check("dedupWindowSeconds", settings.DedupWindowSeconds >= 0, "must not be negative, got %d", settings.DedupWindowSeconds)
+	check("shutdownTimeoutSeconds", settings.ShutdownTimeoutSeconds >= 0, "must not be negative, got %d", settings.ShutdownTimeoutSeconds)
+	check("configWatchSeconds", settings.ConfigWatchSeconds >= 0, "must not be negative, got %d", settings.ConfigWatchSeconds)
+	check("signingKeyID", settings.SigningKey == "" || settings.SigningKeyID != "", "must be set along with signingKey")
+	for i, apiKey := range settings.APIKeys {
+		check("apiKeys", apiKey.Name != "" && apiKey.Key != "", "entry %d needs a name and a key", i+1)
+		check("apiKeys", middlewares.ValidRole(apiKey.Role), "entry %s must have the role read-only or admin, got %q", apiKey.Name, apiKey.Role)
+	}
+	check("jwtSecret", settings.JWTSecret == "" || len(settings.JWTSecret) >= minJWTSecretLength,
+		"must be at least %d characters", minJWTSecretLength)
+	check("rateLimitPerSecond", settings.RateLimitPerSecond >= 0, "must not be negative, got %g", settings.RateLimitPerSecond)
+	check("rateLimitBurst", settings.RateLimitBurst >= 1, "must be at least 1, got %d", settings.RateLimitBurst)
+	check("rateLimitKey", settings.RateLimitKey == middlewares.RateLimitByIP || settings.RateLimitKey == middlewares.RateLimitByAPIKey ||
+		settings.RateLimitKey == middlewares.RateLimitByApplication, "must be %s, %s or %s, got %q",
+		middlewares.RateLimitByIP, middlewares.RateLimitByAPIKey, middlewares.RateLimitByApplication, settings.RateLimitKey)
+	check("idempotencyKeyTTLSeconds", settings.IdempotencyKeyTTLSeconds >= 0, "must not be negative, got %d", settings.IdempotencyKeyTTLSeconds)
+	check("deliveryMode", settings.DeliveryMode == routing.ModeCloudConnector || settings.DeliveryMode == routing.ModeWebhook,
+		"must be %s or %s, got %q", routing.ModeCloudConnector, routing.ModeWebhook, settings.DeliveryMode)
+
+	if !reported["destinations"] && !reported["routes"] && (len(settings.Destinations) > 0 || len(settings.Routes) > 0) {
+		if _, err := routing.NewTable(settings.Destinations, settings.Routes); err != nil {
+			check("routes", false, "are not valid, %s", err.Error())
+		}
+	}
+	if !reported["alertTypes"] && len(settings.AlertTypes) > 0 {
+		if _, err := catalog.New(settings.AlertTypes); err != nil {
+			check("alertTypes", false, "are not valid, %s", err.Error())
+		}
+	}
+}
+
+func validPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number <= 65535
+}
+
+func validLoggingLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "error", "warn", "info", "debug":
+		return true
+	}
+	return false
+}
+
+// validURL reports whether the value is an absolute http or https url
+func validURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
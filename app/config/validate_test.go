@@ -0,0 +1,113 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/configuration"
+)
+
+func TestValidate(t *testing.T) {
+	if err := InitConfig("", ""); err != nil {
+		t.Fatalf("Expected the default configuration to be valid, got %s", err)
+	}
+	valid := Current()
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Expected the default configuration to be valid, got %s", err)
+	}
+
+	settings := valid
+	settings.NotificationChanSize = 5
+	settings.BatchSizeMax = 0
+	settings.Port = "http"
+	settings.CloudConnectorURL = "localhost:8089"
+	settings.AlertDestinationAuthType = "oauth2"
+	settings.AlertDestinationAuthEndpoint = "http://auth.example.com/token"
+	settings.AlertDestinationClientID = "client"
+	settings.AlertDestinationClientSecret = ""
+	settings.DeliveryBackoffJitter = 1.5
+	settings.APIKeys = []middlewares.APIKey{{Name: "dashboard", Key: "key", Role: "viewer"}}
+	settings.JWTSecret = "short"
+
+	problems, ok := Validate(settings).(Problems)
+	if !ok {
+		t.Fatalf("Expected problems, got %v", Validate(settings))
+	}
+	var reported []string
+	for _, problem := range problems {
+		reported = append(reported, problem.Setting)
+	}
+	expected := []string{"port", "notificationChanSize", "batchSizeMax", "cloudConnectorURL", "alertDestinationClientSecret", "deliveryBackoffJitter", "apiKeys", "jwtSecret"}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Errorf("Expected problems with %v, got %v", expected, problems)
+	}
+
+	// the auth settings are fine all unset
+	settings = valid
+	settings.AlertDestinationAuthType = ""
+	settings.AlertDestinationAuthEndpoint = ""
+	settings.AlertDestinationClientID = ""
+	settings.AlertDestinationClientSecret = ""
+	if err := Validate(settings); err != nil {
+		t.Errorf("Expected no auth settings to be valid, got %s", err)
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "configuration.json")
+	settings := `{
+		"serviceName": "Alert service",
+		"loggingLevel": "verbose",
+		"notificationChanSize": 100,
+		"port": "9001",
+		"watchdogSeconds": "two minutes",
+		"maxMissedHeartbeats": 3,
+		"cloudConnectorURL": "http://localhost:8089",
+		"cloudConnectorEndpoint": "/callwebhook",
+		"telemetryEndpoint": "",
+		"telemetryDataStoreName": "",
+		"mappingSkuURL": "http://127.0.0.1:8081",
+		"mappingSkuEndpoint": "/skus",
+		"alertDestination": "",
+		"heartbeatDestination": "",
+		"sendNotWhitelistedAlert": false,
+		"deliveryMaxAttempts": "ten",
+		"routes": [{"name": "urgent", "destinations": ["unknown"]}]
+	}`
+	if err := ioutil.WriteFile(file, []byte(settings), 0600); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	source := &configuration.Configuration{}
+	if err := source.Load(file); err != nil {
+		t.Fatalf("Unable to load file %s", err)
+	}
+
+	_, err = load(source)
+	problems, ok := err.(Problems)
+	if !ok {
+		t.Fatalf("Expected problems, got %v", err)
+	}
+	reported := make(map[string]string)
+	for _, problem := range problems {
+		reported[problem.Setting] = problem.Message
+	}
+	if len(problems) != 5 || reported["batchSizeMax"] != "is required" || reported["watchdogSeconds"] == "" ||
+		reported["deliveryMaxAttempts"] == "" || reported["loggingLevel"] == "" || reported["routes"] == "" {
+		t.Errorf("Expected every problem to be reported, got %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially increasing delays between delivery attempts
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the fraction, between 0 and 1, by which each delay is randomly increased or decreased
+	Jitter float64
+	// Random returns a number in [0.0,1.0), defaults to rand.Float64
+	Random func() float64
+}
+
+// Duration returns how long to wait before the next attempt after the given number of failed attempts
+func (backoff Backoff) Duration(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	multiplier := backoff.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(backoff.Initial) * math.Pow(multiplier, float64(attempts-1))
+	if backoff.Max > 0 && delay > float64(backoff.Max) {
+		delay = float64(backoff.Max)
+	}
+
+	if backoff.Jitter > 0 {
+		random := backoff.Random
+		if random == nil {
+			random = rand.Float64
+		}
+		delay += delay * backoff.Jitter * (2*random() - 1)
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,200 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	deadLettersBucket = []byte("dead_letters")
+
+	// ErrDeadLetterNotFound occurs when there is no dead letter with the requested id
+	ErrDeadLetterNotFound = errors.New("Dead letter not found")
+	// errSeparateDatabases occurs when replaying dead letters to a queue kept in another database
+	errSeparateDatabases = errors.New("dead letters and the delivery queue must be kept in the same database")
+
+	defaultDeadLetters *DeadLetters
+)
+
+// DeadLetter is a message that could not be delivered, kept so it can be inspected and replayed
+// swagger:model DeadLetter
+type DeadLetter struct {
+	ID         string    `json:"id"`
+	Reason     string    `json:"reason"`
+	Attempts   int       `json:"attempts"`
+	LastStatus int       `json:"last_status,omitempty"`
+	FailedAt   time.Time `json:"failed_at"`
+	Message    Message   `json:"message"`
+}
+
+// DeadLetters keeps the messages that failed delivery permanently in a bolt database
+type DeadLetters struct {
+	db *bolt.DB
+}
+
+// NewDeadLetters creates the dead letter bucket in the database if it doesn't exist yet
+func NewDeadLetters(db *bolt.DB) (*DeadLetters, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create dead letter bucket")
+	}
+
+	return &DeadLetters{db: db}, nil
+}
+
+// SetDefaultDeadLetters sets the store for messages that failed delivery
+func SetDefaultDeadLetters(deadLetters *DeadLetters) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultDeadLetters = deadLetters
+}
+
+// DefaultDeadLetters returns the store for messages that failed delivery, or nil if it is not enabled
+func DefaultDeadLetters() *DeadLetters {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultDeadLetters
+}
+
+// Add saves a message that failed delivery along with the reason it failed
+func (deadLetters *DeadLetters) Add(message Message, reason string) (DeadLetter, error) {
+	deadLetter := DeadLetter{
+		ID:         message.ID,
+		Reason:     reason,
+		Attempts:   message.Attempts,
+		LastStatus: message.LastStatus,
+		FailedAt:   time.Now(),
+		Message:    message,
+	}
+
+	err := deadLetters.db.Update(func(tx *bolt.Tx) error {
+		value, err := json.Marshal(deadLetter)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(deadLettersBucket).Put([]byte(deadLetter.ID), value)
+	})
+	if err != nil {
+		return deadLetter, errors.Wrapf(err, "unable to save dead letter %s", deadLetter.ID)
+	}
+
+	return deadLetter, nil
+}
+
+// List returns every dead letter, oldest failure first
+func (deadLetters *DeadLetters) List() ([]DeadLetter, error) {
+	list := make([]DeadLetter, 0)
+	err := deadLetters.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLettersBucket).ForEach(func(key, value []byte) error {
+			var deadLetter DeadLetter
+			if err := json.Unmarshal(value, &deadLetter); err != nil {
+				return err
+			}
+			list = append(list, deadLetter)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read dead letters")
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FailedAt.Before(list[j].FailedAt)
+	})
+	return list, nil
+}
+
+// Get returns the dead letter with the given id
+func (deadLetters *DeadLetters) Get(id string) (DeadLetter, error) {
+	var deadLetter DeadLetter
+	err := deadLetters.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(deadLettersBucket).Get([]byte(id))
+		if value == nil {
+			return ErrDeadLetterNotFound
+		}
+		return json.Unmarshal(value, &deadLetter)
+	})
+	return deadLetter, errors.Wrapf(err, "unable to read dead letter %s", id)
+}
+
+// Count returns the number of dead letters
+func (deadLetters *DeadLetters) Count() int {
+	count := 0
+	_ = deadLetters.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(deadLettersBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// Replay puts the dead letter with the given id back in the queue with a fresh set of attempts. The dead letter is
+// removed in the same transaction, so replaying it more than once at the same time only queues it once.
+func (deadLetters *DeadLetters) Replay(id string, queue *Queue) (Message, error) {
+	if deadLetters.db != queue.db {
+		return Message{}, errSeparateDatabases
+	}
+
+	var message Message
+	err := deadLetters.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deadLettersBucket)
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return ErrDeadLetterNotFound
+		}
+		var deadLetter DeadLetter
+		if err := json.Unmarshal(value, &deadLetter); err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		message = deadLetter.Message
+		message.Attempts = 0
+		message.LastError = ""
+		message.LastStatus = 0
+		message.NextAttempt = time.Time{}
+		return enqueue(tx, &message)
+	})
+	if err != nil {
+		return message, errors.Wrapf(err, "unable to replay dead letter %s", id)
+	}
+
+	queue.wake()
+	return message, nil
+}
+
+// ReplayAll puts every dead letter back in the queue, returning the replayed messages
+func (deadLetters *DeadLetters) ReplayAll(queue *Queue) ([]Message, error) {
+	list, err := deadLetters.List()
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := make([]Message, 0, len(list))
+	for _, deadLetter := range list {
+		message, err := deadLetters.Replay(deadLetter.ID, queue)
+		if errors.Cause(err) == ErrDeadLetterNotFound {
+			// replayed on its own since the list was read
+			continue
+		}
+		if err != nil {
+			return replayed, err
+		}
+		replayed = append(replayed, message)
+	}
+	return replayed, nil
+}
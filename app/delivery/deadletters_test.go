@@ -0,0 +1,157 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestDeadLettersReplay(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+	deadLetters, err := NewDeadLetters(queue.db)
+	if err != nil {
+		t.Fatalf("Unable to create dead letters %s", err)
+	}
+
+	for _, id := range []string{"first", "second"} {
+		message := Message{ID: id, NotificationMessage: "Gateway Deregistered Alert", Attempts: 10, LastError: "timeout", LastStatus: 503}
+		if _, err := deadLetters.Add(message, "maximum delivery attempts reached: timeout"); err != nil {
+			t.Fatalf("Unable to add dead letter %s", err)
+		}
+	}
+
+	list, err := deadLetters.List()
+	if err != nil {
+		t.Fatalf("Unable to list dead letters %s", err)
+	}
+	if len(list) != 2 || list[0].ID != "first" || list[0].Attempts != 10 || list[0].LastStatus != 503 {
+		t.Fatalf("Unexpected dead letters %v", list)
+	}
+
+	if _, err := deadLetters.Replay("unknown", queue); pkgerrors.Cause(err) != ErrDeadLetterNotFound {
+		t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+	}
+
+	message, err := deadLetters.Replay("first", queue)
+	if err != nil {
+		t.Fatalf("Unable to replay dead letter %s", err)
+	}
+	if message.Attempts != 0 || message.LastError != "" || message.LastStatus != 0 {
+		t.Errorf("Expected replayed message to start over, got %v", message)
+	}
+	if deadLetters.Count() != 1 || queue.Depth() != 1 {
+		t.Fatalf("Expected 1 dead letter and 1 queued message, got %d and %d", deadLetters.Count(), queue.Depth())
+	}
+
+	replayed, err := deadLetters.ReplayAll(queue)
+	if err != nil {
+		t.Fatalf("Unable to replay dead letters %s", err)
+	}
+	if len(replayed) != 1 || replayed[0].ID != "second" {
+		t.Errorf("Unexpected replayed messages %v", replayed)
+	}
+	if deadLetters.Count() != 0 || queue.Depth() != 2 {
+		t.Errorf("Expected no dead letters and 2 queued messages, got %d and %d", deadLetters.Count(), queue.Depth())
+	}
+}
+
+func TestDeadLettersReplayConcurrently(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+	deadLetters, err := NewDeadLetters(queue.db)
+	if err != nil {
+		t.Fatalf("Unable to create dead letters %s", err)
+	}
+	if _, err := deadLetters.Add(Message{ID: "first", NotificationMessage: "Gateway Deregistered Alert"}, "timeout"); err != nil {
+		t.Fatalf("Unable to add dead letter %s", err)
+	}
+
+	var wait sync.WaitGroup
+	replays := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := deadLetters.Replay("first", queue)
+			replays <- err
+		}()
+	}
+	wait.Wait()
+	close(replays)
+
+	replayed := 0
+	for err := range replays {
+		if err == nil {
+			replayed++
+		} else if pkgerrors.Cause(err) != ErrDeadLetterNotFound {
+			t.Errorf("Unexpected error replaying dead letter %s", err)
+		}
+	}
+	if replayed != 1 || queue.Depth() != 1 {
+		t.Errorf("Expected the dead letter to be queued once, got %d replays and %d queued", replayed, queue.Depth())
+	}
+}
+
+func TestWorkerDeadLetters(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+	deadLetters, err := NewDeadLetters(queue.db)
+	if err != nil {
+		t.Fatalf("Unable to create dead letters %s", err)
+	}
+
+	responses := map[string]error{
+		"rejected":    &StatusError{StatusCode: 400},
+		"unavailable": &StatusError{StatusCode: 503},
+		"exhausted":   errors.New("connection refused"),
+	}
+	worker := &Worker{
+		Queue:       queue,
+		Backoff:     Backoff{Initial: time.Millisecond},
+		MaxAttempts: 2,
+		DeadLetters: deadLetters,
+		Send: func(message Message) (Response, error) {
+			return Response{}, responses[message.ID]
+		},
+	}
+	for id := range responses {
+		if _, err := queue.Enqueue(Message{ID: id}); err != nil {
+			t.Fatalf("Unable to enqueue message %s", err)
+		}
+	}
+
+	// a 4xx response is not retried
+	worker.deliverDue(time.Now().Add(time.Minute))
+	if deadLetters.Count() != 1 || queue.Depth() != 2 {
+		t.Fatalf("Expected 1 dead letter and 2 queued messages, got %d and %d", deadLetters.Count(), queue.Depth())
+	}
+	rejected, err := deadLetters.Get("rejected")
+	if err != nil {
+		t.Fatalf("Unable to get dead letter %s", err)
+	}
+	if rejected.Attempts != 1 || rejected.LastStatus != 400 || rejected.Reason != "rejected by destination: PostNotification failed with following response code 400" {
+		t.Errorf("Unexpected dead letter %v", rejected)
+	}
+
+	worker.deliverDue(time.Now().Add(time.Minute))
+	if deadLetters.Count() != 3 || queue.Depth() != 0 {
+		t.Fatalf("Expected 3 dead letters and no queued messages, got %d and %d", deadLetters.Count(), queue.Depth())
+	}
+	unavailable, err := deadLetters.Get("unavailable")
+	if err != nil {
+		t.Fatalf("Unable to get dead letter %s", err)
+	}
+	if unavailable.Attempts != 2 || unavailable.LastStatus != 503 {
+		t.Errorf("Unexpected dead letter %v", unavailable)
+	}
+}
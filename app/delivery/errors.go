@@ -0,0 +1,43 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// StatusError occurs when a destination responds to a delivery with an unexpected HTTP status code
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the body of the response, at most MaxResponseBody bytes
+	Body string
+}
+
+func (statusErr *StatusError) Error() string {
+	return fmt.Sprintf("PostNotification failed with following response code %d", statusErr.StatusCode)
+}
+
+// StatusCode returns the HTTP status code carried by the error, or 0 if there is none
+func StatusCode(err error) int {
+	if statusErr, ok := errors.Cause(err).(*StatusError); ok {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// isPermanent reports whether retrying the delivery cannot succeed, which is the case when the
+// destination rejects the request itself rather than being unavailable
+func isPermanent(err error) bool {
+	code := StatusCode(err)
+	if code < 400 || code >= 500 {
+		return false
+	}
+	return code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
@@ -0,0 +1,202 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	queueBucket = []byte("delivery_queue")
+
+	defaultQueue *Queue
+	defaultMutex sync.RWMutex
+)
+
+// Message is a notification waiting to be delivered to its destination
+type Message struct {
+	ID                  string          `json:"id"`
+	Sequence            uint64          `json:"sequence"`
+	NotificationType    string          `json:"notification_type"`
+	NotificationMessage string          `json:"notification_message"`
+	GatewayID           string          `json:"gateway_id"`
+	Endpoint            string          `json:"endpoint"`
+	Destination         string          `json:"destination,omitempty"`
+	Data                json.RawMessage `json:"data"`
+	HistoryID           string          `json:"history_id,omitempty"`
+	Attempts            int             `json:"attempts"`
+	LastError           string          `json:"last_error,omitempty"`
+	LastStatus          int             `json:"last_status,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	NextAttempt         time.Time       `json:"next_attempt"`
+}
+
+// Queue keeps the messages waiting for delivery in a bolt database so they survive restarts
+type Queue struct {
+	db     *bolt.DB
+	signal chan struct{}
+}
+
+// NewQueue creates the delivery queue bucket in the database if it doesn't exist yet
+func NewQueue(db *bolt.DB) (*Queue, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(queueBucket)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create delivery queue bucket")
+	}
+
+	return &Queue{db: db, signal: make(chan struct{}, 1)}, nil
+}
+
+// SetDefaultQueue sets the queue notifications are delivered through
+func SetDefaultQueue(queue *Queue) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultQueue = queue
+}
+
+// DefaultQueue returns the queue notifications are delivered through, or nil if notifications are sent directly
+func DefaultQueue() *Queue {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultQueue
+}
+
+// Enqueue saves the message to be delivered as soon as possible
+func (queue *Queue) Enqueue(message Message) (Message, error) {
+	err := queue.db.Update(func(tx *bolt.Tx) error {
+		return enqueue(tx, &message)
+	})
+	if err != nil {
+		return message, errors.Wrapf(err, "unable to enqueue message %s", message.ID)
+	}
+
+	queue.wake()
+	return message, nil
+}
+
+// enqueue saves the message in the queue bucket as part of the transaction
+func enqueue(tx *bolt.Tx, message *Message) error {
+	if message.ID == "" {
+		message.ID = uuid.New()
+	}
+	now := time.Now()
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = now
+	}
+	if message.NextAttempt.IsZero() {
+		message.NextAttempt = now
+	}
+
+	bucket := tx.Bucket(queueBucket)
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	message.Sequence = sequence
+	return putMessage(bucket, *message)
+}
+
+// wake wakes up the worker without blocking if it has already been signalled
+func (queue *Queue) wake() {
+	select {
+	case queue.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Due returns up to limit messages whose next attempt is at or before now, oldest first
+func (queue *Queue) Due(now time.Time, limit int) ([]Message, error) {
+	var messages []Message
+	err := queue.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(queueBucket).Cursor()
+		for key, value := cursor.First(); key != nil && len(messages) < limit; key, value = cursor.Next() {
+			var message Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if !message.NextAttempt.After(now) {
+				messages = append(messages, message)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read delivery queue")
+	}
+
+	return messages, nil
+}
+
+// NextAttempt returns the earliest time a queued message is due, and false if the queue is empty
+func (queue *Queue) NextAttempt() (time.Time, bool) {
+	var next time.Time
+	found := false
+	_ = queue.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).ForEach(func(key, value []byte) error {
+			var message Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return nil
+			}
+			if !found || message.NextAttempt.Before(next) {
+				next = message.NextAttempt
+				found = true
+			}
+			return nil
+		})
+	})
+	return next, found
+}
+
+// Update saves the changes to a queued message, such as its attempts and next attempt time
+func (queue *Queue) Update(message Message) error {
+	err := queue.db.Update(func(tx *bolt.Tx) error {
+		return putMessage(tx.Bucket(queueBucket), message)
+	})
+	return errors.Wrapf(err, "unable to update message %s", message.ID)
+}
+
+// Remove deletes a message from the queue once it no longer needs to be delivered
+func (queue *Queue) Remove(message Message) error {
+	err := queue.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Delete(sequenceKey(message.Sequence))
+	})
+	return errors.Wrapf(err, "unable to remove message %s", message.ID)
+}
+
+// Depth returns the number of messages waiting for delivery
+func (queue *Queue) Depth() int {
+	depth := 0
+	_ = queue.db.View(func(tx *bolt.Tx) error {
+		depth = tx.Bucket(queueBucket).Stats().KeyN
+		return nil
+	})
+	return depth
+}
+
+func putMessage(bucket *bolt.Bucket, message Message) error {
+	value, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(sequenceKey(message.Sequence), value)
+}
+
+func sequenceKey(sequence uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
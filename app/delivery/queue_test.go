@@ -0,0 +1,112 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestDB(t *testing.T, dir string) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	return db
+}
+
+func newTestQueue(t *testing.T) (*Queue, func()) {
+	dir, err := ioutil.TempDir("", "delivery")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	db := openTestDB(t, dir)
+	queue, err := NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	return queue, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delivery")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := openTestDB(t, dir)
+	queue, err := NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	enqueued, err := queue.Enqueue(Message{NotificationMessage: "Gateway Deregistered Alert", Data: []byte(`{"alert_number":322}`)})
+	if err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Unable to close database %s", err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+	queue, err = NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	if queue.Depth() != 1 {
+		t.Fatalf("Expected 1 queued message after restart, got %d", queue.Depth())
+	}
+	due, err := queue.Due(time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Unable to read due messages %s", err)
+	}
+	if len(due) != 1 || due[0].ID != enqueued.ID || string(due[0].Data) != `{"alert_number":322}` {
+		t.Errorf("Unexpected due messages %v", due)
+	}
+}
+
+func TestQueueDue(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+
+	now := time.Now()
+	if _, err := queue.Enqueue(Message{NotificationMessage: "now"}); err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+	later, err := queue.Enqueue(Message{NotificationMessage: "later", NextAttempt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+
+	due, err := queue.Due(now.Add(time.Second), 10)
+	if err != nil {
+		t.Fatalf("Unable to read due messages %s", err)
+	}
+	if len(due) != 1 || due[0].NotificationMessage != "now" {
+		t.Fatalf("Expected only the message due now, got %v", due)
+	}
+
+	if err := queue.Remove(due[0]); err != nil {
+		t.Fatalf("Unable to remove message %s", err)
+	}
+	next, ok := queue.NextAttempt()
+	if !ok || !next.Equal(later.NextAttempt) {
+		t.Errorf("Expected next attempt %v, got %v", later.NextAttempt, next)
+	}
+	if queue.Depth() != 1 {
+		t.Errorf("Expected 1 queued message, got %d", queue.Depth())
+	}
+}
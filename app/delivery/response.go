@@ -0,0 +1,45 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// MaxResponseBody is the most of the body a destination responds to a delivery with that is kept
+const MaxResponseBody = 1024
+
+// Response is the HTTP status code and the start of the body a destination responded to a delivery with
+type Response struct {
+	StatusCode int
+	Body       string
+}
+
+// ReadResponse reads the status code and at most MaxResponseBody bytes of the body of a response to a delivery
+func ReadResponse(statusCode int, body io.Reader) Response {
+	data, _ := ioutil.ReadAll(io.LimitReader(body, MaxResponseBody))
+	return Response{StatusCode: statusCode, Body: string(data)}
+}
+
+// NewResponse keeps the status code and at most MaxResponseBody bytes of the body of a response to a delivery
+func NewResponse(statusCode int, body []byte) Response {
+	if len(body) > MaxResponseBody {
+		body = body[:MaxResponseBody]
+	}
+	return Response{StatusCode: statusCode, Body: string(body)}
+}
+
+// ResponseOf returns the response carried by the error, or an empty response if there is none
+func ResponseOf(err error) Response {
+	if statusErr, ok := errors.Cause(err).(*StatusError); ok {
+		return Response{StatusCode: statusErr.StatusCode, Body: statusErr.Body}
+	}
+	return Response{}
+}
@@ -0,0 +1,198 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// batchSize is the number of due messages read from the queue at a time
+	batchSize = 50
+	// maxIdle is the longest the worker sleeps before checking the queue again
+	maxIdle = 30 * time.Second
+	// storeRetry is how long the worker first sleeps after the queue could not be read or updated,
+	// doubled on every failure in a row up to maxIdle
+	storeRetry = time.Second
+)
+
+// Worker delivers the messages in the queue, retrying failed deliveries with backoff
+type Worker struct {
+	Queue       *Queue
+	Backoff     Backoff
+	MaxAttempts int
+	// DeadLetters, if set, keeps the messages that could not be delivered
+	DeadLetters *DeadLetters
+	// Send delivers a message to its destination
+	Send func(message Message) (Response, error)
+	// OnDelivered, if set, is called after a message is delivered with the response of its destination
+	OnDelivered func(message Message, response Response)
+	// OnFailed, if set, is called after a message has used up all of its attempts or was rejected by its destination
+	OnFailed func(message Message, err error)
+}
+
+// Run delivers due messages until stop is closed
+func (worker *Worker) Run(stop <-chan struct{}) {
+	var storeBackoff time.Duration
+	for {
+		_, storeErr := worker.deliverDue(time.Now())
+
+		wait := maxIdle
+		if next, ok := worker.Queue.NextAttempt(); ok {
+			if untilNext := time.Until(next); untilNext < wait {
+				wait = untilNext
+			}
+		}
+		if storeErr != nil {
+			// messages left due by a store error would be attempted again straight away, wait for the store to recover
+			storeBackoff = nextStoreBackoff(storeBackoff)
+			if wait < storeBackoff {
+				wait = storeBackoff
+			}
+		} else {
+			storeBackoff = 0
+		}
+		if wait <= 0 {
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-worker.Queue.signal:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextStoreBackoff is the wait after another store error in a row, following a wait of previous
+func nextStoreBackoff(previous time.Duration) time.Duration {
+	if previous <= 0 {
+		return storeRetry
+	}
+	if previous*2 > maxIdle {
+		return maxIdle
+	}
+	return previous * 2
+}
+
+// deliverDue attempts every message due at now, returning the number of messages attempted
+// and the last error reading or updating the queue
+func (worker *Worker) deliverDue(now time.Time) (int, error) {
+	messages, err := worker.Queue.Due(now, batchSize)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "deliverDue",
+			"Action": "Read due messages",
+			"Error":  err.Error(),
+		}).Error("unable to read delivery queue")
+		return 0, err
+	}
+
+	var storeErr error
+	for _, message := range messages {
+		if err := worker.attempt(message); err != nil {
+			storeErr = err
+		}
+	}
+	return len(messages), storeErr
+}
+
+// attempt sends the message, then removes it from the queue or reschedules it, returning the error updating the queue
+func (worker *Worker) attempt(message Message) error {
+	mRetry := metrics.GetOrRegisterMeter("Alert.Delivery.Retry", nil)
+	mGiveUp := metrics.GetOrRegisterMeter("Alert.Delivery.GiveUp", nil)
+
+	message.Attempts++
+	if message.Attempts > 1 {
+		mRetry.Mark(1)
+	}
+
+	response, sendErr := worker.Send(message)
+	if sendErr == nil {
+		removeErr := worker.remove(message)
+		if worker.OnDelivered != nil {
+			worker.OnDelivered(message, response)
+		}
+		return removeErr
+	}
+
+	message.LastError = sendErr.Error()
+	message.LastStatus = StatusCode(sendErr)
+	permanent := isPermanent(sendErr)
+	if permanent || (worker.MaxAttempts > 0 && message.Attempts >= worker.MaxAttempts) {
+		mGiveUp.Mark(1)
+		log.WithFields(log.Fields{
+			"Method":   "attempt",
+			"ID":       message.ID,
+			"Attempts": message.Attempts,
+			"Status":   message.LastStatus,
+			"Error":    sendErr.Error(),
+		}).Errorf("Giving up delivering %s", message.NotificationMessage)
+		worker.deadLetter(message, permanent)
+		removeErr := worker.remove(message)
+		if worker.OnFailed != nil {
+			worker.OnFailed(message, sendErr)
+		}
+		return removeErr
+	}
+
+	delay := worker.Backoff.Duration(message.Attempts)
+	message.NextAttempt = time.Now().Add(delay)
+	log.WithFields(log.Fields{
+		"Method":   "attempt",
+		"ID":       message.ID,
+		"Attempts": message.Attempts,
+		"Retry":    delay,
+		"Error":    sendErr.Error(),
+	}).Warnf("Problem delivering %s, will retry", message.NotificationMessage)
+	if err := worker.Queue.Update(message); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "attempt",
+			"Action": "Update message",
+			"Error":  err.Error(),
+		}).Error("unable to reschedule message")
+		return err
+	}
+	return nil
+}
+
+func (worker *Worker) remove(message Message) error {
+	err := worker.Queue.Remove(message)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "remove",
+			"Action": "Remove message",
+			"Error":  err.Error(),
+		}).Error("unable to remove message from delivery queue")
+	}
+	return err
+}
+
+func (worker *Worker) deadLetter(message Message, permanent bool) {
+	if worker.DeadLetters == nil {
+		return
+	}
+
+	reason := "maximum delivery attempts reached: " + message.LastError
+	if permanent {
+		reason = "rejected by destination: " + message.LastError
+	}
+	if _, err := worker.DeadLetters.Add(message, reason); err != nil {
+		log.WithFields(log.Fields{
+			"Method": "deadLetter",
+			"Action": "Add dead letter",
+			"Error":  err.Error(),
+		}).Error("unable to keep undelivered message")
+	}
+}
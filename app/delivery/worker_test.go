@@ -0,0 +1,172 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package delivery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	backoff := Backoff{
+		Initial:    time.Second,
+		Max:        10 * time.Second,
+		Multiplier: 2,
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, duration := range expected {
+		if actual := backoff.Duration(i + 1); actual != duration {
+			t.Errorf("Attempt %d: expected %v, got %v", i+1, duration, actual)
+		}
+	}
+
+	backoff.Jitter = 0.5
+	backoff.Random = func() float64 { return 0 }
+	if actual := backoff.Duration(1); actual != 500*time.Millisecond {
+		t.Errorf("Expected lowest jitter to halve the delay, got %v", actual)
+	}
+	backoff.Random = func() float64 { return 0.5 }
+	if actual := backoff.Duration(1); actual != time.Second {
+		t.Errorf("Expected middle jitter to keep the delay, got %v", actual)
+	}
+}
+
+func TestWorkerRetriesThenDelivers(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+
+	sendAttempts := 0
+	var delivered []Message
+	var responses []Response
+	worker := &Worker{
+		Queue:       queue,
+		Backoff:     Backoff{Initial: time.Millisecond, Multiplier: 2},
+		MaxAttempts: 5,
+		Send: func(message Message) (Response, error) {
+			sendAttempts++
+			if sendAttempts < 3 {
+				return Response{}, errors.New("cloud connector unavailable")
+			}
+			return Response{StatusCode: 202, Body: "accepted"}, nil
+		},
+		OnDelivered: func(message Message, response Response) {
+			delivered = append(delivered, message)
+			responses = append(responses, response)
+		},
+	}
+
+	if _, err := queue.Enqueue(Message{NotificationMessage: "Gateway Deregistered Alert"}); err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if attempted, err := worker.deliverDue(time.Now().Add(time.Minute)); err != nil || attempted != 1 {
+			t.Fatalf("Expected 1 message attempted, got %d %v", attempted, err)
+		}
+	}
+
+	if len(delivered) != 1 || delivered[0].Attempts != 3 {
+		t.Fatalf("Expected message delivered on the third attempt, got %v", delivered)
+	}
+	if responses[0] != (Response{StatusCode: 202, Body: "accepted"}) {
+		t.Errorf("Expected the response of the destination, got %+v", responses[0])
+	}
+	if queue.Depth() != 0 {
+		t.Errorf("Expected empty queue after delivery, got %d", queue.Depth())
+	}
+}
+
+func TestWorkerGivesUp(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+
+	var failed []Message
+	worker := &Worker{
+		Queue:       queue,
+		Backoff:     Backoff{Initial: time.Millisecond},
+		MaxAttempts: 2,
+		Send: func(message Message) (Response, error) {
+			return Response{}, errors.New("cloud connector unavailable")
+		},
+		OnFailed: func(message Message, err error) {
+			failed = append(failed, message)
+		},
+	}
+
+	if _, err := queue.Enqueue(Message{NotificationMessage: "Missed HeartBeat Alert"}); err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+
+	worker.deliverDue(time.Now().Add(time.Minute))
+	if len(failed) != 0 || queue.Depth() != 1 {
+		t.Fatal("Expected message to be rescheduled after the first failure")
+	}
+	worker.deliverDue(time.Now().Add(time.Minute))
+	if len(failed) != 1 || failed[0].LastError != "cloud connector unavailable" {
+		t.Fatalf("Expected message to fail after the second attempt, got %v", failed)
+	}
+	if queue.Depth() != 0 {
+		t.Errorf("Expected failed message to be removed from the queue, got %d", queue.Depth())
+	}
+}
+
+func TestWorkerStoreErrors(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+
+	worker := &Worker{
+		Queue: queue,
+		Send:  func(message Message) (Response, error) { return Response{}, nil },
+	}
+	if err := queue.db.Close(); err != nil {
+		t.Fatalf("Unable to close database %s", err)
+	}
+	if _, err := worker.deliverDue(time.Now()); err == nil {
+		t.Error("Expected an error reading the queue from a closed database")
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, maxIdle, maxIdle}
+	var backoff time.Duration
+	for i, duration := range expected {
+		if backoff = nextStoreBackoff(backoff); backoff != duration {
+			t.Errorf("Store error %d: expected %v, got %v", i+1, duration, backoff)
+		}
+	}
+}
+
+func TestWorkerRun(t *testing.T) {
+	queue, cleanup := newTestQueue(t)
+	defer cleanup()
+
+	delivered := make(chan Message, 1)
+	worker := &Worker{
+		Queue: queue,
+		Send:  func(message Message) (Response, error) { return Response{}, nil },
+		OnDelivered: func(message Message, response Response) {
+			delivered <- message
+		},
+	}
+	stop := make(chan struct{})
+	go worker.Run(stop)
+	defer close(stop)
+
+	if _, err := queue.Enqueue(Message{NotificationMessage: "Process Alert"}); err != nil {
+		t.Fatalf("Unable to enqueue message %s", err)
+	}
+
+	select {
+	case message := <-delivered:
+		if message.NotificationMessage != "Process Alert" {
+			t.Errorf("Unexpected message delivered %v", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the worker to deliver the message")
+	}
+}
@@ -0,0 +1,91 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package health reports whether the service and the dependencies it needs are usable
+package health
+
+import (
+	"sync"
+)
+
+const (
+	// StatusUp is the status of a check that passed, and of a report whose checks all passed
+	StatusUp = "up"
+	// StatusDown is the status of a check that failed, and of a report with a failed check
+	StatusDown = "down"
+)
+
+var (
+	checks      = make(map[string]Check)
+	checksMutex sync.RWMutex
+)
+
+// Check reports the state of something the service needs to be ready
+type Check func() Result
+
+// Result is the outcome of a check, with the details of what was checked
+// swagger:model HealthCheckResult
+type Result struct {
+	Status string      `json:"status"`
+	Detail interface{} `json:"detail,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check
+// swagger:model HealthReport
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Up is a passed check with its details
+func Up(detail interface{}) Result {
+	return Result{Status: StatusUp, Detail: detail}
+}
+
+// Down is a failed check with the reason it failed and its details
+func Down(err error, detail interface{}) Result {
+	return Result{Status: StatusDown, Detail: detail, Error: err.Error()}
+}
+
+// RegisterCheck adds a check to the readiness report, replacing any check with the same name
+func RegisterCheck(name string, check Check) {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+	checks[name] = check
+}
+
+// UnregisterCheck removes a check from the readiness report
+func UnregisterCheck(name string) {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+	delete(checks, name)
+}
+
+// Ready runs every check at the same time, the service being ready when all of them are up
+func Ready() Report {
+	checksMutex.RLock()
+	defer checksMutex.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checks))}
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	for name, check := range checks {
+		wait.Add(1)
+		go func(name string, check Check) {
+			defer wait.Done()
+			result := check()
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wait.Wait()
+	return report
+}
@@ -0,0 +1,34 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package health
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestReady(t *testing.T) {
+	RegisterCheck("first", func() Result { return Up(map[string]int{"depth": 1}) })
+	defer UnregisterCheck("first")
+
+	report := Ready()
+	if report.Status != StatusUp || report.Checks["first"].Status != StatusUp {
+		t.Errorf("Expected the service to be ready, got %+v", report)
+	}
+
+	RegisterCheck("second", func() Result { return Down(errors.New("unreachable"), nil) })
+	defer UnregisterCheck("second")
+
+	report = Ready()
+	if report.Status != StatusDown || len(report.Checks) != 2 {
+		t.Fatalf("Expected the service not to be ready, got %+v", report)
+	}
+	if second := report.Checks["second"]; second.Status != StatusDown || second.Error != "unreachable" {
+		t.Errorf("Unexpected result of the failed check %+v", second)
+	}
+}
@@ -0,0 +1,617 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// Queued is the outcome of an alert waiting in the delivery queue
+	Queued = "queued"
+	// Delivered is the outcome of an alert accepted by its destination
+	Delivered = "delivered"
+	// Failed is the outcome of an alert that could not be delivered to its destination
+	Failed = "failed"
+	// NotSent is the outcome of an alert that had no destination to be delivered to
+	NotSent = "not_sent"
+
+	// Open is the state of an alert nobody has looked at yet
+	Open = "open"
+	// Acknowledged is the state of an alert someone is taking care of
+	Acknowledged = "acknowledged"
+	// Resolved is the state of an alert whose cause has been dealt with
+	Resolved = "resolved"
+
+	// pruneInterval is how often the records past the retention are deleted when adding new ones
+	pruneInterval = time.Minute
+)
+
+var (
+	alertsBucket   = []byte("alerts")
+	alertIDsBucket = []byte("alert_ids")
+	// devicesBucket indexes the records by the device id and the gateway id of their alert
+	devicesBucket = []byte("alert_devices")
+
+	// ErrRecordNotFound occurs when there is no alert record with the requested id
+	ErrRecordNotFound = errors.New("Alert record not found")
+	// ErrInvalidTransition occurs when an alert cannot move from its current state to the requested one
+	ErrInvalidTransition = errors.New("Invalid alert state transition")
+
+	// transitions lists the states an alert can move to from each state
+	transitions = map[string][]string{
+		Open:         {Acknowledged, Resolved},
+		Acknowledged: {Resolved},
+	}
+
+	defaultStore *Store
+	defaultMutex sync.RWMutex
+)
+
+// Record is an alert processed by the service along with where it was sent and how that went
+// swagger:model AlertRecord
+type Record struct {
+	ID          string       `json:"id"`
+	Alert       models.Alert `json:"alert"`
+	GatewayID   string       `json:"gateway_id"`
+	Destination string       `json:"destination"`
+	Outcome     string       `json:"outcome"`
+	Error       string       `json:"error,omitempty"`
+	ProcessedAt time.Time    `json:"processed_at"`
+	State       string       `json:"state"`
+	Transitions []Transition `json:"transitions,omitempty"`
+	Deliveries  []Delivery   `json:"deliveries,omitempty"`
+}
+
+// Delivery is the outcome of sending an alert to one of the destinations it was routed to
+// swagger:model AlertDelivery
+type Delivery struct {
+	Destination string `json:"destination"`
+	URL         string `json:"url"`
+	Outcome     string `json:"outcome"`
+	Error       string `json:"error,omitempty"`
+	// StatusCode is the HTTP status code the destination responded to the delivery with
+	StatusCode int `json:"status_code,omitempty"`
+	// Response is the start of the body the destination responded to the delivery with
+	Response string `json:"response,omitempty"`
+}
+
+// Transition is a change in the state of an alert, made by a user or by the service itself
+// swagger:model AlertTransition
+type Transition struct {
+	State string    `json:"state"`
+	User  string    `json:"user"`
+	Note  string    `json:"note,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// Filter selects the alert records returned by Query. Zero values match everything.
+type Filter struct {
+	From        time.Time
+	To          time.Time
+	Severity    string
+	AlertNumber int
+	DeviceID    string
+	Facility    string
+	State       string
+	Offset      int
+	Limit       int
+}
+
+// Retention limits the records kept in the alert history. Zero values keep records forever.
+type Retention struct {
+	MaxAge     time.Duration
+	MaxRecords int
+}
+
+// Store keeps the alert history in a bolt database, in the order the alerts were processed
+type Store struct {
+	db  *bolt.DB
+	now func() time.Time
+
+	mutex     sync.Mutex
+	retention Retention
+	lastPrune time.Time
+}
+
+// NewStore creates the alert history buckets in the database if they don't exist yet
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		alerts, err := tx.CreateBucketIfNotExists(alertsBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(alertIDsBucket); err != nil {
+			return err
+		}
+		if tx.Bucket(devicesBucket) != nil {
+			return nil
+		}
+
+		// index the records saved before the device index was added
+		devices, err := tx.CreateBucket(devicesBucket)
+		if err != nil {
+			return err
+		}
+		return alerts.ForEach(func(key, value []byte) error {
+			var record Record
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			return indexDevices(devices, key, record)
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create alert history buckets")
+	}
+
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// SetRetention sets the records kept in the alert history, the others are deleted as new records are added
+func (store *Store) SetRetention(retention Retention) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.retention = retention
+	store.lastPrune = time.Time{}
+}
+
+// SetDefaultStore sets the store used to record every alert processed by the service
+func SetDefaultStore(store *Store) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultStore = store
+}
+
+// DefaultStore returns the store used to record alerts, or nil if the alert history is not enabled
+func DefaultStore() *Store {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultStore
+}
+
+// Add saves a new record, generating its id if not already set. A record added with the id of an earlier one
+// takes its place in Get and the other lookups by id, the earlier record is still listed by Query.
+func (store *Store) Add(record Record) (Record, error) {
+	if record.ID == "" {
+		record.ID = uuid.New()
+	}
+	if record.ProcessedAt.IsZero() {
+		record.ProcessedAt = time.Now()
+	}
+	if record.State == "" {
+		record.State = Open
+	}
+	if record.Outcome == "" && len(record.Deliveries) > 0 {
+		record.Outcome, record.Error = overallOutcome(record.Deliveries)
+	}
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		alerts := tx.Bucket(alertsBucket)
+		sequence, err := alerts.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, sequence)
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := alerts.Put(key, value); err != nil {
+			return err
+		}
+		if err := tx.Bucket(alertIDsBucket).Put([]byte(record.ID), key); err != nil {
+			return err
+		}
+		return indexDevices(tx.Bucket(devicesBucket), key, record)
+	})
+	if err != nil {
+		return record, errors.Wrapf(err, "unable to save alert record %s", record.ID)
+	}
+
+	store.pruneIfDue()
+	return record, nil
+}
+
+// pruneIfDue deletes the records past the retention, at most once every pruneInterval
+func (store *Store) pruneIfDue() {
+	now := store.now()
+	store.mutex.Lock()
+	retention := store.retention
+	due := (retention.MaxAge > 0 || retention.MaxRecords > 0) && now.Sub(store.lastPrune) >= pruneInterval
+	if due {
+		store.lastPrune = now
+	}
+	store.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	pruned, err := store.Prune(now)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "pruneIfDue",
+			"Action": "Prune alert records",
+			"Error":  err.Error(),
+		}).Error("unable to prune alert history")
+		return
+	}
+	if pruned > 0 {
+		log.Debugf("Pruned %d alert records past the retention", pruned)
+	}
+}
+
+// Prune deletes the oldest records until the rest are younger than the retention max age at now
+// and no more than its max records, returning how many were deleted
+func (store *Store) Prune(now time.Time) (int, error) {
+	store.mutex.Lock()
+	retention := store.retention
+	store.mutex.Unlock()
+
+	var pruned int
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		alerts, ids, devices := tx.Bucket(alertsBucket), tx.Bucket(alertIDsBucket), tx.Bucket(devicesBucket)
+		cursor := alerts.Cursor()
+
+		// records are only ever deleted from the oldest, so their keys are consecutive
+		var count int
+		if first, _ := cursor.First(); first != nil {
+			last, _ := cursor.Last()
+			count = int(binary.BigEndian.Uint64(last)-binary.BigEndian.Uint64(first)) + 1
+		}
+
+		var keys [][]byte
+		var records []Record
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var record Record
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			tooMany := retention.MaxRecords > 0 && count-len(keys) > retention.MaxRecords
+			tooOld := retention.MaxAge > 0 && record.ProcessedAt.Before(now.Add(-retention.MaxAge))
+			if !tooMany && !tooOld {
+				break
+			}
+			keys = append(keys, append([]byte(nil), key...))
+			records = append(records, record)
+		}
+
+		for i, key := range keys {
+			if err := alerts.Delete(key); err != nil {
+				return err
+			}
+			// a newer record added with the same id owns the id now
+			if id := []byte(records[i].ID); bytes.Equal(ids.Get(id), key) {
+				if err := ids.Delete(id); err != nil {
+					return err
+				}
+			}
+			if err := unindexDevices(devices, key, records[i]); err != nil {
+				return err
+			}
+		}
+		pruned = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to prune alert history")
+	}
+	return pruned, nil
+}
+
+// UpdateOutcome sets the delivery outcome of the record with the given id
+func (store *Store) UpdateOutcome(id string, outcome string, outcomeErr string) error {
+	_, err := store.update(id, func(record *Record) error {
+		record.Outcome = outcome
+		record.Error = outcomeErr
+		return nil
+	})
+	return err
+}
+
+// UpdateDelivery sets the outcome, error and response of delivering the record with the given id to
+// the destination of delivered, and the overall outcome of the record from the outcomes of all of its destinations
+func (store *Store) UpdateDelivery(id string, delivered Delivery) error {
+	_, err := store.update(id, func(record *Record) error {
+		for i := range record.Deliveries {
+			if record.Deliveries[i].Destination == delivered.Destination {
+				record.Deliveries[i].Outcome = delivered.Outcome
+				record.Deliveries[i].Error = delivered.Error
+				record.Deliveries[i].StatusCode = delivered.StatusCode
+				record.Deliveries[i].Response = delivered.Response
+			}
+		}
+		record.Outcome, record.Error = overallOutcome(record.Deliveries)
+		return nil
+	})
+	return err
+}
+
+// Get returns the record with the given id
+func (store *Store) Get(id string) (Record, error) {
+	var record Record
+	err := store.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(alertIDsBucket).Get([]byte(id))
+		if key == nil {
+			return ErrRecordNotFound
+		}
+		return json.Unmarshal(tx.Bucket(alertsBucket).Get(key), &record)
+	})
+	return record, errors.Wrapf(err, "unable to read alert record %s", id)
+}
+
+// Transition moves the record with the given id to a new state, noting who did it and why
+func (store *Store) Transition(id string, state string, user string, note string) (Record, error) {
+	return store.update(id, func(record *Record) error {
+		return record.transition(state, user, note)
+	})
+}
+
+// ResolveOpen resolves every record matching the filter that is not resolved yet, returning the resolved records
+func (store *Store) ResolveOpen(filter Filter, user string, note string) ([]Record, error) {
+	var resolved []Record
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		var records []Record
+		err := each(tx, filter, func(key []byte, record Record) bool {
+			if record.State != Resolved && filter.matches(record) {
+				keys = append(keys, append([]byte(nil), key...))
+				records = append(records, record)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		alerts := tx.Bucket(alertsBucket)
+
+		for i, record := range records {
+			if err := record.transition(Resolved, user, note); err != nil {
+				return err
+			}
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := alerts.Put(keys[i], value); err != nil {
+				return err
+			}
+			resolved = append(resolved, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve alert records")
+	}
+
+	return resolved, nil
+}
+
+func (store *Store) update(id string, change func(record *Record) error) (Record, error) {
+	var record Record
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		key := tx.Bucket(alertIDsBucket).Get([]byte(id))
+		if key == nil {
+			return ErrRecordNotFound
+		}
+		alerts := tx.Bucket(alertsBucket)
+
+		if err := json.Unmarshal(alerts.Get(key), &record); err != nil {
+			return err
+		}
+		if err := change(&record); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return alerts.Put(key, value)
+	})
+	return record, errors.Wrapf(err, "unable to update alert record %s", id)
+}
+
+// overallOutcome is queued while any destination is still queued, failed if any destination failed,
+// and delivered once every destination is delivered
+func overallOutcome(deliveries []Delivery) (string, string) {
+	outcome, outcomeErr := Delivered, ""
+	for _, delivery := range deliveries {
+		switch delivery.Outcome {
+		case Queued:
+			return Queued, ""
+		case Failed:
+			outcome = Failed
+			if outcomeErr == "" {
+				outcomeErr = delivery.Destination + ": " + delivery.Error
+			}
+		}
+	}
+	return outcome, outcomeErr
+}
+
+func (record *Record) transition(state string, user string, note string) error {
+	current := record.State
+	if current == "" {
+		// records saved before alerts had a state are open
+		current = Open
+	}
+
+	for _, allowed := range transitions[current] {
+		if allowed == state {
+			record.State = state
+			record.Transitions = append(record.Transitions, Transition{
+				State: state,
+				User:  user,
+				Note:  note,
+				At:    time.Now(),
+			})
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrInvalidTransition, "alert %s is %s and cannot be %s", record.ID, current, state)
+}
+
+// Query returns the records matching the filter, newest first, along with the total number of matches
+func (store *Store) Query(filter Filter) ([]Record, int, error) {
+	records := make([]Record, 0)
+	total := 0
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return each(tx, filter, func(key []byte, record Record) bool {
+			if !filter.matches(record) {
+				return true
+			}
+			if total >= filter.Offset && (filter.Limit <= 0 || len(records) < filter.Limit) {
+				records = append(records, record)
+			}
+			total++
+			return true
+		})
+	})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "unable to query alert history")
+	}
+
+	return records, total, nil
+}
+
+// each calls visit with the records that can match the filter, newest first, until visit returns false. The records
+// of a device are found through the device index, and as records are kept in the order they were processed, the
+// search stops at the first record processed before the start of the filter.
+func each(tx *bolt.Tx, filter Filter, visit func(key []byte, record Record) bool) error {
+	alerts := tx.Bucket(alertsBucket)
+
+	var keys [][]byte
+	if filter.DeviceID != "" {
+		prefix := deviceKey(filter.DeviceID, nil)
+		cursor := tx.Bucket(devicesBucket).Cursor()
+		for key, alertKey := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, alertKey = cursor.Next() {
+			keys = append(keys, alertKey)
+		}
+	}
+
+	cursor := alerts.Cursor()
+	next := func(i int) ([]byte, []byte) {
+		if filter.DeviceID != "" {
+			if i >= len(keys) {
+				return nil, nil
+			}
+			key := keys[len(keys)-1-i]
+			return key, alerts.Get(key)
+		}
+		if i == 0 {
+			return cursor.Last()
+		}
+		return cursor.Prev()
+	}
+
+	for i := 0; ; i++ {
+		key, value := next(i)
+		if key == nil {
+			return nil
+		}
+		if value == nil {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+		if !filter.From.IsZero() && record.ProcessedAt.Before(filter.From) {
+			return nil
+		}
+		if !visit(key, record) {
+			return nil
+		}
+	}
+}
+
+// deviceKey is the key of a record in the device index, the device id and the key of the record in the alerts bucket
+func deviceKey(device string, key []byte) []byte {
+	indexKey := make([]byte, 0, len(device)+1+len(key))
+	indexKey = append(indexKey, device...)
+	indexKey = append(indexKey, 0)
+	return append(indexKey, key...)
+}
+
+// recordDevices are the distinct device id and gateway id of the record, which filters on device id match
+func recordDevices(record Record) []string {
+	devices := make([]string, 0, 2)
+	if record.Alert.DeviceID != "" {
+		devices = append(devices, record.Alert.DeviceID)
+	}
+	if record.GatewayID != "" && record.GatewayID != record.Alert.DeviceID {
+		devices = append(devices, record.GatewayID)
+	}
+	return devices
+}
+
+func indexDevices(devices *bolt.Bucket, key []byte, record Record) error {
+	for _, device := range recordDevices(record) {
+		if err := devices.Put(deviceKey(device, key), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unindexDevices(devices *bolt.Bucket, key []byte, record Record) error {
+	for _, device := range recordDevices(record) {
+		if err := devices.Delete(deviceKey(device, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (filter Filter) matches(record Record) bool {
+	if !filter.From.IsZero() && record.ProcessedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && record.ProcessedAt.After(filter.To) {
+		return false
+	}
+	if filter.State != "" && filter.State != record.State && (filter.State != Open || record.State != "") {
+		return false
+	}
+	if filter.Severity != "" && record.Alert.Severity != filter.Severity {
+		return false
+	}
+	if filter.AlertNumber != 0 && record.Alert.AlertNumber != filter.AlertNumber {
+		return false
+	}
+	if filter.DeviceID != "" && record.Alert.DeviceID != filter.DeviceID && record.GatewayID != filter.DeviceID {
+		return false
+	}
+	if filter.Facility != "" {
+		found := false
+		for _, facility := range record.Alert.Facilities {
+			if facility == filter.Facility {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
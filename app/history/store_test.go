@@ -0,0 +1,333 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create store %s", err)
+	}
+	return store, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestAddAndQuery(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	start := time.Now().Add(-time.Hour)
+	records := []Record{
+		{Alert: models.Alert{AlertNumber: 320, Severity: "info", DeviceID: "rrs-gateway", Facilities: []string{"front"}}, GatewayID: "rrs-gateway", Outcome: Delivered, ProcessedAt: start},
+		{Alert: models.Alert{AlertNumber: 321, Severity: "critical", DeviceID: "rrs-gateway", Facilities: []string{"front"}}, GatewayID: "rrs-gateway", Outcome: Failed, ProcessedAt: start.Add(time.Minute)},
+		{Alert: models.Alert{AlertNumber: 22, Severity: "critical", DeviceID: "Sensor1", Facilities: []string{"back"}}, GatewayID: "other-gateway", Outcome: Delivered, ProcessedAt: start.Add(2 * time.Minute)},
+	}
+	for _, record := range records {
+		added, err := store.Add(record)
+		if err != nil {
+			t.Fatalf("Error adding record %s", err)
+		}
+		if added.ID == "" {
+			t.Error("Expected record id to be generated")
+		}
+	}
+
+	all, total, err := store.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Error querying records %s", err)
+	}
+	if total != 3 || len(all) != 3 {
+		t.Fatalf("Expected 3 records, got %d of %d", len(all), total)
+	}
+	if all[0].Alert.AlertNumber != 22 {
+		t.Error("Expected newest record first")
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected int
+	}{
+		{"severity", Filter{Severity: "critical"}, 2},
+		{"alert number", Filter{AlertNumber: 320}, 1},
+		{"device id matches gateway", Filter{DeviceID: "rrs-gateway"}, 2},
+		{"device id matches sensor", Filter{DeviceID: "Sensor1"}, 1},
+		{"facility", Filter{Facility: "back"}, 1},
+		{"from", Filter{From: start.Add(30 * time.Second)}, 2},
+		{"to", Filter{To: start.Add(30 * time.Second)}, 1},
+		{"no match", Filter{Severity: "urgent"}, 0},
+	}
+	for _, test := range tests {
+		matches, total, err := store.Query(test.filter)
+		if err != nil {
+			t.Fatalf("%s: error querying records %s", test.name, err)
+		}
+		if total != test.expected || len(matches) != test.expected {
+			t.Errorf("%s: expected %d records, got %d of %d", test.name, test.expected, len(matches), total)
+		}
+	}
+
+	page, total, err := store.Query(Filter{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Error querying records %s", err)
+	}
+	if total != 3 || len(page) != 1 || page[0].Alert.AlertNumber != 321 {
+		t.Errorf("Unexpected page %v of %d", page, total)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	var ids []string
+	for i := 0; i < 5; i++ {
+		record, err := store.Add(Record{
+			Alert:       models.Alert{AlertNumber: 320 + i, DeviceID: "rrs-gateway"},
+			GatewayID:   "rrs-gateway",
+			ProcessedAt: now.Add(time.Duration(i-5) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Error adding record %s", err)
+		}
+		ids = append(ids, record.ID)
+	}
+
+	store.SetRetention(Retention{MaxAge: 4*time.Hour + time.Minute})
+	if pruned, err := store.Prune(now); err != nil || pruned != 1 {
+		t.Fatalf("Expected the record older than the max age to be pruned, got %d %v", pruned, err)
+	}
+	store.SetRetention(Retention{MaxRecords: 2})
+	if pruned, err := store.Prune(now); err != nil || pruned != 2 {
+		t.Fatalf("Expected the records over the max records to be pruned, got %d %v", pruned, err)
+	}
+
+	if _, err := store.Get(ids[2]); errors.Cause(err) != ErrRecordNotFound {
+		t.Errorf("Expected pruned record to be gone, got %v", err)
+	}
+	records, total, err := store.Query(Filter{DeviceID: "rrs-gateway"})
+	if err != nil {
+		t.Fatalf("Error querying records %s", err)
+	}
+	if total != 2 || records[0].ID != ids[4] || records[1].ID != ids[3] {
+		t.Errorf("Expected the 2 newest records to be kept, got %d %+v", total, records)
+	}
+}
+
+func TestPruneDuplicateID(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := store.Add(Record{
+			ID:          "duplicate",
+			Alert:       models.Alert{AlertNumber: 320 + i, DeviceID: "rrs-gateway"},
+			ProcessedAt: now.Add(time.Duration(i-2) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Error adding record %s", err)
+		}
+	}
+
+	record, err := store.Get("duplicate")
+	if err != nil || record.Alert.AlertNumber != 321 {
+		t.Fatalf("Expected the newest record with the id, got %+v %v", record, err)
+	}
+
+	store.SetRetention(Retention{MaxRecords: 1})
+	if pruned, err := store.Prune(now); err != nil || pruned != 1 {
+		t.Fatalf("Expected the oldest record to be pruned, got %d %v", pruned, err)
+	}
+	record, err = store.Get("duplicate")
+	if err != nil || record.Alert.AlertNumber != 321 {
+		t.Errorf("Expected the newest record to be found after pruning the oldest, got %+v %v", record, err)
+	}
+	if _, err := store.Transition("duplicate", Acknowledged, "tester", ""); err != nil {
+		t.Errorf("Expected the newest record to be updated after pruning the oldest, got %v", err)
+	}
+}
+
+func TestNewStoreIndexesExistingRecords(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if _, err := store.Add(Record{Alert: models.Alert{AlertNumber: 322, DeviceID: "rrs-gateway"}, GatewayID: "rrs-gateway"}); err != nil {
+		t.Fatalf("Error adding record %s", err)
+	}
+	// a database saved before the device index was added
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(devicesBucket)
+	})
+	if err != nil {
+		t.Fatalf("Error deleting device index %s", err)
+	}
+
+	reopened, err := NewStore(store.db)
+	if err != nil {
+		t.Fatalf("Error creating store %s", err)
+	}
+	if _, total, _ := reopened.Query(Filter{DeviceID: "rrs-gateway"}); total != 1 {
+		t.Errorf("Expected the existing record to be indexed, got %d", total)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	record, err := store.Add(Record{Alert: models.Alert{AlertNumber: 22, Severity: "critical"}})
+	if err != nil {
+		t.Fatalf("Error adding record %s", err)
+	}
+	if record.State != Open {
+		t.Fatalf("Expected new record to be open, got %s", record.State)
+	}
+
+	if _, err := store.Transition("unknown", Acknowledged, "jdoe", ""); errors.Cause(err) != ErrRecordNotFound {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+
+	acknowledged, err := store.Transition(record.ID, Acknowledged, "jdoe", "on my way")
+	if err != nil {
+		t.Fatalf("Error acknowledging record %s", err)
+	}
+	if acknowledged.State != Acknowledged || len(acknowledged.Transitions) != 1 ||
+		acknowledged.Transitions[0].User != "jdoe" || acknowledged.Transitions[0].Note != "on my way" {
+		t.Errorf("Unexpected acknowledged record %+v", acknowledged)
+	}
+	if _, err := store.Transition(record.ID, Acknowledged, "jdoe", ""); errors.Cause(err) != ErrInvalidTransition {
+		t.Errorf("Expected ErrInvalidTransition acknowledging twice, got %v", err)
+	}
+
+	if _, err := store.Transition(record.ID, Resolved, "asmith", "fixed"); err != nil {
+		t.Fatalf("Error resolving record %s", err)
+	}
+	resolved, err := store.Get(record.ID)
+	if err != nil {
+		t.Fatalf("Error getting record %s", err)
+	}
+	if resolved.State != Resolved || len(resolved.Transitions) != 2 {
+		t.Errorf("Unexpected resolved record %+v", resolved)
+	}
+	if _, err := store.Transition(record.ID, Acknowledged, "jdoe", ""); errors.Cause(err) != ErrInvalidTransition {
+		t.Errorf("Expected ErrInvalidTransition acknowledging a resolved alert, got %v", err)
+	}
+
+	if records, total, _ := store.Query(Filter{State: Resolved}); total != 1 || records[0].ID != record.ID {
+		t.Errorf("Expected resolved record to match state filter, got %d", total)
+	}
+}
+
+func TestResolveOpen(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	records := []Record{
+		{Alert: models.Alert{AlertNumber: 322, DeviceID: "rrs-gateway"}, GatewayID: "rrs-gateway"},
+		{Alert: models.Alert{AlertNumber: 322, DeviceID: "rrs-gateway"}, GatewayID: "rrs-gateway", State: Acknowledged},
+		{Alert: models.Alert{AlertNumber: 322, DeviceID: "other-gateway"}, GatewayID: "other-gateway"},
+		{Alert: models.Alert{AlertNumber: 321, DeviceID: "rrs-gateway"}, GatewayID: "rrs-gateway"},
+	}
+	for _, record := range records {
+		if _, err := store.Add(record); err != nil {
+			t.Fatalf("Error adding record %s", err)
+		}
+	}
+
+	resolved, err := store.ResolveOpen(Filter{AlertNumber: 322, DeviceID: "rrs-gateway"}, "watchdog", "registered again")
+	if err != nil {
+		t.Fatalf("Error resolving records %s", err)
+	}
+	if len(resolved) != 2 {
+		t.Fatalf("Expected 2 resolved records, got %d", len(resolved))
+	}
+	if _, total, _ := store.Query(Filter{State: Open}); total != 2 {
+		t.Errorf("Expected the other gateway and the missed heartbeat to stay open, got %d open", total)
+	}
+
+	resolved, err = store.ResolveOpen(Filter{AlertNumber: 322, DeviceID: "rrs-gateway"}, "watchdog", "registered again")
+	if err != nil || len(resolved) != 0 {
+		t.Errorf("Expected nothing left to resolve, got %d %v", len(resolved), err)
+	}
+}
+
+func TestUpdateDelivery(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+
+	record, err := store.Add(Record{
+		Alert: models.Alert{AlertNumber: 22, Severity: "critical"},
+		Deliveries: []Delivery{
+			{Destination: "store-ops", Outcome: Queued},
+			{Destination: "it", Outcome: Queued},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error adding record %s", err)
+	}
+	if record.Outcome != Queued {
+		t.Fatalf("Expected queued record, got %s", record.Outcome)
+	}
+
+	steps := []struct {
+		destination string
+		outcome     string
+		err         string
+		statusCode  int
+		response    string
+		expected    string
+	}{
+		{"store-ops", Delivered, "", 200, "ok", Queued},
+		{"it", Failed, "rejected", 400, `{"error":"invalid"}`, Failed},
+		{"it", Delivered, "", 202, "", Delivered},
+	}
+	for _, step := range steps {
+		delivered := Delivery{Destination: step.destination, Outcome: step.outcome, Error: step.err, StatusCode: step.statusCode, Response: step.response}
+		if err := store.UpdateDelivery(record.ID, delivered); err != nil {
+			t.Fatalf("Error updating delivery %s", err)
+		}
+		updated, err := store.Get(record.ID)
+		if err != nil {
+			t.Fatalf("Error getting record %s", err)
+		}
+		if updated.Outcome != step.expected {
+			t.Errorf("Expected outcome %s after %s %s, got %s", step.expected, step.destination, step.outcome, updated.Outcome)
+		}
+		if step.expected == Failed && updated.Error != "it: rejected" {
+			t.Errorf("Expected error of the failed destination, got %s", updated.Error)
+		}
+		if step.destination == "it" && updated.Deliveries[1].StatusCode != step.statusCode {
+			t.Errorf("Expected status code %d of the destination, got %d", step.statusCode, updated.Deliveries[1].StatusCode)
+		}
+		if step.destination == "it" && updated.Deliveries[1].Response != step.response {
+			t.Errorf("Expected response %q of the destination, got %q", step.response, updated.Deliveries[1].Response)
+		}
+	}
+}
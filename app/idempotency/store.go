@@ -0,0 +1,150 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package idempotency
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// purgeInterval is how often the expired keys are deleted when saving new ones
+const purgeInterval = time.Minute
+
+var (
+	keysBucket = []byte("idempotency_keys")
+
+	defaultStore *Store
+	defaultMutex sync.RWMutex
+)
+
+// entry is a saved response along with when it expires
+type entry struct {
+	Response  middlewares.IdempotentResponse `json:"response"`
+	ExpiresAt time.Time                      `json:"expires_at"`
+}
+
+// Store keeps the responses to requests sent with an idempotency key in a bolt database until they expire
+type Store struct {
+	db  *bolt.DB
+	now func() time.Time
+
+	mutex     sync.Mutex
+	lastPurge time.Time
+}
+
+// NewStore creates the idempotency key bucket in the database if it doesn't exist yet
+func NewStore(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(keysBucket)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create idempotency key bucket")
+	}
+
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// SetDefaultStore sets the store used for the requests sent with an idempotency key
+func SetDefaultStore(store *Store) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultStore = store
+}
+
+// DefaultStore returns the store used for the requests sent with an idempotency key, or nil if there is none
+func DefaultStore() *Store {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultStore
+}
+
+// Lookup returns the response saved for the key, if it has not expired
+func (store *Store) Lookup(key string) (middlewares.IdempotentResponse, bool, error) {
+	var saved entry
+	var found bool
+	err := store.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(keysBucket).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &saved)
+	})
+	if err != nil {
+		return middlewares.IdempotentResponse{}, false, errors.Wrapf(err, "unable to read idempotency key %s", key)
+	}
+	if !found || !store.now().Before(saved.ExpiresAt) {
+		return middlewares.IdempotentResponse{}, false, nil
+	}
+	return saved.Response, true, nil
+}
+
+// Save keeps the response for the key for ttl, deleting the keys that have expired once in a while
+func (store *Store) Save(key string, response middlewares.IdempotentResponse, ttl time.Duration) error {
+	now := store.now()
+	value, err := json.Marshal(entry{Response: response, ExpiresAt: now.Add(ttl)})
+	if err != nil {
+		return errors.Wrapf(err, "unable to save idempotency key %s", key)
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).Put([]byte(key), value)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to save idempotency key %s", key)
+	}
+
+	store.mutex.Lock()
+	purge := now.Sub(store.lastPurge) >= purgeInterval
+	if purge {
+		store.lastPurge = now
+	}
+	store.mutex.Unlock()
+	if purge {
+		_, err = store.Purge(now)
+	}
+	return err
+}
+
+// Purge deletes the keys that have expired at now, returning how many were deleted
+func (store *Store) Purge(now time.Time) (int, error) {
+	var purged int
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucket)
+		var expired [][]byte
+		err := keys.ForEach(func(key, value []byte) error {
+			var saved entry
+			if err := json.Unmarshal(value, &saved); err != nil {
+				return err
+			}
+			if !now.Before(saved.ExpiresAt) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := keys.Delete(key); err != nil {
+				return err
+			}
+		}
+		purged = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to purge expired idempotency keys")
+	}
+	return purged, nil
+}
@@ -0,0 +1,76 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package idempotency
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create store %s", err)
+	}
+	return store, func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestStore(t *testing.T) {
+	store, cleanup := newTestStore(t)
+	defer cleanup()
+	now := time.Unix(1546300800, 0)
+	store.now = func() time.Time { return now }
+
+	if _, found, err := store.Lookup("retry-1"); found || err != nil {
+		t.Fatalf("Expected no response for an unknown key, got %v %v", found, err)
+	}
+
+	response := middlewares.IdempotentResponse{RequestHash: "abc", StatusCode: 202, Body: []byte(`{"id":"1"}`)}
+	if err := store.Save("retry-1", response, time.Hour); err != nil {
+		t.Fatalf("Error saving response %s", err)
+	}
+	saved, found, err := store.Lookup("retry-1")
+	if err != nil || !found {
+		t.Fatalf("Expected the saved response, got %v %v", found, err)
+	}
+	if saved.RequestHash != "abc" || saved.StatusCode != 202 || string(saved.Body) != `{"id":"1"}` {
+		t.Errorf("Expected the response as saved, got %+v", saved)
+	}
+
+	if err := store.Save("retry-2", response, 2*time.Hour); err != nil {
+		t.Fatalf("Error saving response %s", err)
+	}
+	now = now.Add(time.Hour)
+	if _, found, _ := store.Lookup("retry-1"); found {
+		t.Error("Expected the response to expire after its ttl")
+	}
+
+	purged, err := store.Purge(now)
+	if err != nil || purged != 1 {
+		t.Errorf("Expected the expired key to be purged, got %d %v", purged, err)
+	}
+	if _, found, _ := store.Lookup("retry-2"); !found {
+		t.Error("Expected the key that has not expired to be kept")
+	}
+}
@@ -7,6 +7,7 @@
 package models
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -19,15 +20,37 @@ const (
 	Deregistered
 )
 
+// String returns the readable name of the registration status
+func (status Status) String() string {
+	switch status {
+	case Pending:
+		return "pending"
+	case Registered:
+		return "registered"
+	case Deregistered:
+		return "deregistered"
+	default:
+		return "unknown"
+	}
+}
+
 var (
-	gateway     *gatewayStatus
+	registry    *gatewayRegistry
 	once        sync.Once
 	defaultTime time.Time
 )
 
+// gatewayRegistry keeps track of the current known status for every Gateway, keyed by the
+// device id reported in its heartbeats.
+type gatewayRegistry struct {
+	registryMutex sync.RWMutex
+	gateways      map[string]*gatewayStatus
+}
+
 // gatewayStatus keeps track of the current known status for the Gateway.
 type gatewayStatus struct {
 	gatewayMutex       sync.RWMutex
+	DeviceID           string
 	FirstHeartbeatSeen time.Time
 	LastHeartbeatSeen  time.Time
 	LastHeartbeat      Heartbeat
@@ -35,17 +58,80 @@ type gatewayStatus struct {
 	RegistrationStatus Status
 }
 
-// GetInstanceGateway registers the gateway with default values and ensures that only once instance of struct is created as it is used as a global variable.
-func GetInstanceGateway() *gatewayStatus {
+// GetInstanceGatewayRegistry ensures that only once instance of the gateway registry is created as it is used as a global variable.
+func GetInstanceGatewayRegistry() *gatewayRegistry {
 	once.Do(func() {
+		registry = &gatewayRegistry{
+			gateways: make(map[string]*gatewayStatus),
+		}
+	})
+
+	return registry
+}
+
+// GetGateway returns the gateway with the given device id, if it has been seen
+func (registry *gatewayRegistry) GetGateway(deviceID string) (*gatewayStatus, bool) {
+	registry.registryMutex.RLock()
+	defer registry.registryMutex.RUnlock()
+	gateway, ok := registry.gateways[deviceID]
+	return gateway, ok
+}
+
+// GetOrAddGateway returns the gateway with the given device id, registering it with default values the first time it is seen
+func (registry *gatewayRegistry) GetOrAddGateway(deviceID string) *gatewayStatus {
+	registry.registryMutex.Lock()
+	defer registry.registryMutex.Unlock()
+	gateway, ok := registry.gateways[deviceID]
+	if !ok {
 		gateway = &gatewayStatus{
+			DeviceID:           deviceID,
 			RegistrationStatus: Pending,
 			MissedHeartBeats:   0,
 			LastHeartbeatSeen:  defaultTime,
 		}
+		registry.gateways[deviceID] = gateway
+	}
+	return gateway
+}
+
+// GetGateways returns every known gateway ordered by device id
+func (registry *gatewayRegistry) GetGateways() []*gatewayStatus {
+	registry.registryMutex.RLock()
+	gateways := make([]*gatewayStatus, 0, len(registry.gateways))
+	for _, gateway := range registry.gateways {
+		gateways = append(gateways, gateway)
+	}
+	registry.registryMutex.RUnlock()
+
+	sort.Slice(gateways, func(i, j int) bool {
+		return gateways[i].DeviceID < gateways[j].DeviceID
 	})
+	return gateways
+}
 
-	return gateway
+// GatewayInfo is a point in time copy of the status of a Gateway
+// swagger:model GatewayInfo
+type GatewayInfo struct {
+	DeviceID           string    `json:"device_id"`
+	FirstHeartbeatSeen time.Time `json:"first_heartbeat_seen"`
+	LastHeartbeatSeen  time.Time `json:"last_heartbeat_seen"`
+	MissedHeartBeats   int       `json:"missed_heartbeats"`
+	RegistrationStatus string    `json:"registration_status"`
+	LastHeartbeat      Heartbeat `json:"last_heartbeat"`
+}
+
+// GetGatewayInfo returns a copy of the current status of the gateway
+func (gateway *gatewayStatus) GetGatewayInfo() GatewayInfo {
+	gateway.gatewayMutex.RLock()
+	defer gateway.gatewayMutex.RUnlock()
+	return GatewayInfo{
+		DeviceID:           gateway.DeviceID,
+		FirstHeartbeatSeen: gateway.FirstHeartbeatSeen,
+		LastHeartbeatSeen:  gateway.LastHeartbeatSeen,
+		MissedHeartBeats:   gateway.MissedHeartBeats,
+		RegistrationStatus: gateway.RegistrationStatus.String(),
+		LastHeartbeat:      gateway.LastHeartbeat,
+	}
 }
 
 func (gateway *gatewayStatus) UpdateGatewayStatus(lastHeartBeatSeen time.Time, missedHeartBeats int, hb Heartbeat) bool {
@@ -9,10 +9,13 @@ package models
 import (
 	"time"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 )
 
 type Alert struct {
+	// ID identifies the alert in the alert history and in the acknowledge and resolve endpoints
+	ID         string   `json:"id,omitempty"`
 	SentOn     int64    `json:"sent_on"`
 	Facilities []string `json:"facilities"`
 	// DeviceID is sensor id
@@ -22,6 +25,13 @@ type Alert struct {
 	Severity         string      `json:"severity"`
 	ControllerID     string      `json:"controller_id"`
 	Optional         interface{} `json:"optional"`
+	// Occurrences is the number of times the alert was seen since FirstSeen when deduplication is enabled
+	Occurrences int   `json:"occurrences,omitempty"`
+	FirstSeen   int64 `json:"first_seen,omitempty"`
+	LastSeen    int64 `json:"last_seen,omitempty"`
+	// AlertName and Remediation come from the alert catalog entry of the alert number
+	AlertName   string `json:"alert_name,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
 }
 
 // Alert message from SAF
@@ -36,13 +46,40 @@ type AlertMessage struct {
 // UndefinedFacility is the place holder value for unused facility
 const UndefinedFacility = "UNDEFINED_FACILITY"
 
+const (
+	// GatewayRegisteredAlertNumber is the alert number of GatewayRegisteredAlert
+	GatewayRegisteredAlertNumber = catalog.GatewayRegistered
+	// GatewayMissedHeartbeatAlertNumber is the alert number of GatewayMissedHeartbeatAlert
+	GatewayMissedHeartbeatAlertNumber = catalog.GatewayMissedHeartbeat
+	// GatewayDeregisteredAlertNumber is the alert number of GatewayDeregisteredAlert
+	GatewayDeregisteredAlertNumber = catalog.GatewayDeregistered
+)
+
+// EnrichAlert fills in the severity and description the alert is sent without from the entry of its alert number
+// in the alert catalog, along with the name and remediation of the entry
+func EnrichAlert(alert Alert) Alert {
+	current := catalog.Default()
+	alertType, found := current.Lookup(alert.AlertNumber)
+	if !found {
+		return alert
+	}
+
+	alert.AlertName = alertType.Name
+	alert.Remediation = alertType.Remediation
+	if alert.Severity == "" {
+		alert.Severity = alertType.Severity
+	}
+	if alert.AlertDescription == "" {
+		alert.AlertDescription, _ = current.Describe(alert.AlertNumber, alert)
+	}
+	return alert
+}
+
 // GatewayRegisteredAlert generated when a new gateway is seen in a heartbeat
 func GatewayRegisteredAlert(heartbeat Heartbeat) (Alert, string) {
 	var register Alert
 
-	register.AlertNumber = 320
-	register.AlertDescription = "Gateway " + heartbeat.DeviceID + " registered"
-	register.Severity = "info"
+	register.AlertNumber = GatewayRegisteredAlertNumber
 	register.SentOn = helper.UnixMilliNow()
 	register.Facilities = defineFacilities(heartbeat, register)
 	register.ControllerID = heartbeat.DeviceID
@@ -50,17 +87,14 @@ func GatewayRegisteredAlert(heartbeat Heartbeat) (Alert, string) {
 	// available in a heartbeat
 	register.DeviceID = heartbeat.DeviceID
 
-	return register, heartbeat.DeviceID
+	return EnrichAlert(register), heartbeat.DeviceID
 }
 
 // GatewayDeregisteredAlert generated when maximum number of gateway heartbeats are missed
 func GatewayDeregisteredAlert(heartbeat Heartbeat) (Alert, string) {
 	var deregister Alert
 
-	deregister.AlertNumber = 322
-	deregister.AlertDescription = "Gateway " + heartbeat.DeviceID + " deregistered"
-	deregister.Severity = "urgent"
-
+	deregister.AlertNumber = GatewayDeregisteredAlertNumber
 	deregister.SentOn = helper.UnixMilliNow()
 	deregister.Facilities = defineFacilities(heartbeat, deregister)
 	deregister.ControllerID = heartbeat.DeviceID
@@ -68,16 +102,14 @@ func GatewayDeregisteredAlert(heartbeat Heartbeat) (Alert, string) {
 	// available in a heartbeat
 	deregister.DeviceID = heartbeat.DeviceID
 
-	return deregister, heartbeat.DeviceID
+	return EnrichAlert(deregister), heartbeat.DeviceID
 }
 
 // GatewayMissedHeartbeatAlert generated when a gateway heartbeat is missed
 func GatewayMissedHeartbeatAlert(heartbeat Heartbeat) (Alert, string) {
 	var heartbeatMissed Alert
 
-	heartbeatMissed.AlertNumber = 321
-	heartbeatMissed.AlertDescription = "Gateway " + heartbeat.DeviceID + " missed heartbeat"
-	heartbeatMissed.Severity = "critical"
+	heartbeatMissed.AlertNumber = GatewayMissedHeartbeatAlertNumber
 	heartbeatMissed.SentOn = helper.UnixMilliNow()
 	heartbeatMissed.Facilities = defineFacilities(heartbeat, heartbeatMissed)
 	heartbeatMissed.ControllerID = heartbeat.DeviceID
@@ -85,7 +117,7 @@ func GatewayMissedHeartbeatAlert(heartbeat Heartbeat) (Alert, string) {
 	// available in a heartbeat
 	heartbeatMissed.DeviceID = heartbeat.DeviceID
 
-	return heartbeatMissed, heartbeat.DeviceID
+	return EnrichAlert(heartbeatMissed), heartbeat.DeviceID
 }
 
 func defineFacilities(heartbeat Heartbeat, alert Alert) []string {
@@ -0,0 +1,299 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package prometheus exposes the go-metrics registry in the Prometheus text exposition format
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ContentType is the content type of the Prometheus text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// namespace prefixes every metric name, keeping them apart from the metrics of other services
+	namespace = "alert_service_"
+)
+
+// quantiles are the quantiles reported for timers and histograms
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+var (
+	collectors      []Collector
+	collectorsMutex sync.RWMutex
+)
+
+// Sample is a gauge value read when the metrics are scraped, for values kept outside the registry
+// such as the depth of the delivery queue
+type Sample struct {
+	Name   string
+	Help   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector returns the samples to add to the metrics each time they are scraped
+type Collector func() []Sample
+
+// RegisterCollector adds the samples of the collector to every scrape of the metrics
+func RegisterCollector(collector Collector) {
+	collectorsMutex.Lock()
+	defer collectorsMutex.Unlock()
+	collectors = append(collectors, collector)
+}
+
+// family is a metric with its type and every sample of it
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+type sample struct {
+	suffix string
+	labels map[string]string
+	value  float64
+}
+
+// Write writes every metric of the registry and of the registered collectors in the Prometheus text format.
+// Gauges that have not been set are left out, as are metrics whose sanitised name is already taken.
+func Write(writer io.Writer, registry metrics.Registry) error {
+	var families []family
+	registry.Each(func(name string, metric interface{}) {
+		if metricFamilies := registryFamilies(Sanitize(name), name, metric); metricFamilies != nil {
+			families = append(families, metricFamilies...)
+		}
+	})
+
+	collectorsMutex.RLock()
+	for _, collector := range collectors {
+		families = append(families, collectorFamilies(collector())...)
+	}
+	collectorsMutex.RUnlock()
+
+	sort.SliceStable(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	buffered := bufio.NewWriter(writer)
+	seen := make(map[string]bool)
+	for _, metricFamily := range families {
+		if seen[metricFamily.name] {
+			log.Debugf("Metric %s left out of the prometheus metrics as its name is taken", metricFamily.name)
+			continue
+		}
+		seen[metricFamily.name] = true
+		writeFamily(buffered, metricFamily)
+	}
+	return buffered.Flush()
+}
+
+// Sanitize turns a go-metrics name such as Alert.DeliverWebhook.Notify-Error into a valid Prometheus
+// metric name such as alert_service_alert_deliver_webhook_notify_error
+func Sanitize(name string) string {
+	return namespace + sanitize(name)
+}
+
+// sanitize turns a name into lower case words of letters and digits separated by underscores
+func sanitize(name string) string {
+	var sanitized strings.Builder
+	runes := []rune(name)
+	underscore := true
+	for i, r := range runes {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			// start a new word at each upper case letter following a lower case letter or digit,
+			// and at the last upper case letter of an acronym followed by a lower case letter
+			if unicode.IsUpper(r) && i > 0 && !underscore {
+				previous := runes[i-1]
+				if unicode.IsLower(previous) || unicode.IsDigit(previous) ||
+					(unicode.IsUpper(previous) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+					sanitized.WriteRune('_')
+				}
+			}
+			sanitized.WriteRune(unicode.ToLower(r))
+			underscore = false
+		case !underscore:
+			sanitized.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(sanitized.String(), "_")
+}
+
+// registryFamilies converts a metric of the registry, returning nil for gauges that are not set
+// and for metric types that are not supported
+func registryFamilies(name string, originalName string, metric interface{}) []family {
+	help := "go-metrics " + originalName
+	switch value := metric.(type) {
+	case metrics.Counter:
+		return []family{{name: name + "_total", help: help, kind: "counter", samples: []sample{
+			{value: float64(value.Snapshot().Count())},
+		}}}
+
+	case metrics.Gauge:
+		snapshot := value.Snapshot()
+		if !snapshot.IsSet() {
+			return nil
+		}
+		return []family{{name: name, help: help, kind: "gauge", samples: []sample{
+			{labels: tagLabels(snapshot.Tag()), value: float64(snapshot.Value())},
+		}}}
+
+	case metrics.GaugeFloat64:
+		snapshot := value.Snapshot()
+		if !snapshot.IsSet() {
+			return nil
+		}
+		return []family{{name: name, help: help, kind: "gauge", samples: []sample{
+			{labels: tagLabels(snapshot.Tag()), value: snapshot.Value()},
+		}}}
+
+	case metrics.GaugeCollection:
+		// the latest reading of each tag is the current value of the gauge for that tag
+		readings := value.Snapshot().Readings()
+		if len(readings) == 0 {
+			return nil
+		}
+		latest := make(map[metrics.Tag]metrics.GaugeReading)
+		var tags []metrics.Tag
+		for _, reading := range readings {
+			var tag metrics.Tag
+			if reading.Tag != nil {
+				tag = *reading.Tag
+			}
+			if current, found := latest[tag]; !found || !reading.Time.Before(current.Time) {
+				if !found {
+					tags = append(tags, tag)
+				}
+				latest[tag] = reading
+			}
+		}
+		samples := make([]sample, 0, len(tags))
+		for _, tag := range tags {
+			reading := latest[tag]
+			samples = append(samples, sample{labels: tagLabels(reading.Tag), value: float64(reading.Reading)})
+		}
+		return []family{{name: name, help: help, kind: "gauge", samples: samples}}
+
+	case metrics.Meter:
+		snapshot := value.Snapshot()
+		return []family{
+			{name: name + "_total", help: help, kind: "counter", samples: []sample{{value: float64(snapshot.Count())}}},
+			{name: name + "_rate", help: help + " events per second", kind: "gauge", samples: rateSamples(
+				snapshot.Rate1(), snapshot.Rate5(), snapshot.Rate15(), snapshot.RateMean(),
+			)},
+		}
+
+	case metrics.Timer:
+		// timers measure nanoseconds, Prometheus expects seconds
+		snapshot := value.Snapshot()
+		return []family{{name: name + "_seconds", help: help, kind: "summary", samples: summarySamples(
+			snapshot.Percentiles(quantiles), float64(snapshot.Sum()), snapshot.Count(), float64(time.Second),
+		)}}
+
+	case metrics.Histogram:
+		snapshot := value.Snapshot()
+		return []family{{name: name, help: help, kind: "summary", samples: summarySamples(
+			snapshot.Percentiles(quantiles), float64(snapshot.Sum()), snapshot.Count(), 1,
+		)}}
+	}
+	return nil
+}
+
+// collectorFamilies groups the samples of a collector into gauges by name
+func collectorFamilies(collected []Sample) []family {
+	var families []family
+	index := make(map[string]int)
+	for _, collectedSample := range collected {
+		name := Sanitize(collectedSample.Name)
+		i, found := index[name]
+		if !found {
+			i = len(families)
+			index[name] = i
+			families = append(families, family{name: name, help: collectedSample.Help, kind: "gauge"})
+		}
+		families[i].samples = append(families[i].samples, sample{labels: collectedSample.Labels, value: collectedSample.Value})
+	}
+	return families
+}
+
+func rateSamples(rate1 float64, rate5 float64, rate15 float64, rateMean float64) []sample {
+	return []sample{
+		{labels: map[string]string{"window": "1m"}, value: rate1},
+		{labels: map[string]string{"window": "5m"}, value: rate5},
+		{labels: map[string]string{"window": "15m"}, value: rate15},
+		{labels: map[string]string{"window": "mean"}, value: rateMean},
+	}
+}
+
+func summarySamples(percentiles []float64, sum float64, count int64, unit float64) []sample {
+	samples := make([]sample, 0, len(quantiles)+2)
+	for i, quantile := range quantiles {
+		samples = append(samples, sample{
+			labels: map[string]string{"quantile": strconv.FormatFloat(quantile, 'g', -1, 64)},
+			value:  percentiles[i] / unit,
+		})
+	}
+	return append(samples,
+		sample{suffix: "_sum", value: sum / unit},
+		sample{suffix: "_count", value: float64(count)},
+	)
+}
+
+func tagLabels(tag *metrics.Tag) map[string]string {
+	if tag == nil || tag.Name == "" {
+		return nil
+	}
+	return map[string]string{sanitize(tag.Name): tag.Value}
+}
+
+func writeFamily(writer *bufio.Writer, metricFamily family) {
+	writer.WriteString("# HELP " + metricFamily.name + " " + escapeHelp(metricFamily.help) + "\n")
+	writer.WriteString("# TYPE " + metricFamily.name + " " + metricFamily.kind + "\n")
+	for _, metricSample := range metricFamily.samples {
+		writer.WriteString(metricFamily.name + metricSample.suffix + formatLabels(metricSample.labels) + " ")
+		writer.WriteString(strconv.FormatFloat(metricSample.value, 'g', -1, 64) + "\n")
+	}
+}
+
+// formatLabels formats the labels sorted by name, so every scrape lists them the same way
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name + `="` + escapeLabel(labels[name]) + `"`
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
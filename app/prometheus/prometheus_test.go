@@ -0,0 +1,83 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"Alert.DeliverWebhook.Notify-Error": "alert_service_alert_deliver_webhook_notify_error",
+		"Alert.PublishMQTT.Latency":         "alert_service_alert_publish_mqtt_latency",
+		"HTTPServer.ReadAlertMessage":       "alert_service_http_server_read_alert_message",
+		"Alert.Dedup.Suppressed":            "alert_service_alert_dedup_suppressed",
+		"queue depth (total)":               "alert_service_queue_depth_total",
+		"Gateway.Status.rrs-gateway2":       "alert_service_gateway_status_rrs_gateway2",
+	}
+	for name, expected := range tests {
+		if sanitized := Sanitize(name); sanitized != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, name, sanitized)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("Alert.Counter", registry).Inc(3)
+	metrics.GetOrRegisterGauge("Alert.Unset", registry)
+	metrics.GetOrRegisterGauge("Alert.Attempt", registry).UpdateWithTag(1, metrics.Tag{Name: "DeviceID", Value: `rrs "1"`})
+	collection := metrics.GetOrRegisterGaugeCollection("Alert.Gateways", registry)
+	collection.AddWithTag(1, metrics.Tag{Name: "gateway", Value: "a"})
+	collection.AddWithTag(2, metrics.Tag{Name: "gateway", Value: "b"})
+	collection.AddWithTag(3, metrics.Tag{Name: "gateway", Value: "a"})
+	metrics.GetOrRegisterMeter("Alert.Suppressed", registry).Mark(2)
+	metrics.GetOrRegisterTimer("Alert.Latency", registry).Update(2 * time.Second)
+
+	RegisterCollector(func() []Sample {
+		return []Sample{
+			{Name: "Delivery.Queue.Depth", Help: "Notifications waiting in the delivery queue", Value: 5},
+			{Name: "Alert.Counter.Total", Help: "Taken name", Value: 1},
+		}
+	})
+	defer func() {
+		collectors = nil
+	}()
+
+	var exposition bytes.Buffer
+	if err := Write(&exposition, registry); err != nil {
+		t.Fatalf("Error writing metrics %s", err)
+	}
+	written := exposition.String()
+
+	expected := []string{
+		"# TYPE alert_service_alert_counter_total counter\nalert_service_alert_counter_total 3\n",
+		"# TYPE alert_service_alert_attempt gauge\nalert_service_alert_attempt{device_id=\"rrs \\\"1\\\"\"} 1\n",
+		"alert_service_alert_gateways{gateway=\"a\"} 3\nalert_service_alert_gateways{gateway=\"b\"} 2\n",
+		"# TYPE alert_service_alert_suppressed_total counter\nalert_service_alert_suppressed_total 2\n",
+		"# TYPE alert_service_alert_suppressed_rate gauge\n",
+		"# TYPE alert_service_alert_latency_seconds summary\nalert_service_alert_latency_seconds{quantile=\"0.5\"} 2\n",
+		"alert_service_alert_latency_seconds_sum 2\nalert_service_alert_latency_seconds_count 1\n",
+		"# HELP alert_service_delivery_queue_depth Notifications waiting in the delivery queue\n# TYPE alert_service_delivery_queue_depth gauge\nalert_service_delivery_queue_depth 5\n",
+	}
+	for _, metric := range expected {
+		if !strings.Contains(written, metric) {
+			t.Errorf("Expected metrics to contain %q, got\n%s", metric, written)
+		}
+	}
+	if strings.Contains(written, "alert_service_alert_unset") {
+		t.Errorf("Expected unset gauges to be left out, got\n%s", written)
+	}
+	if strings.Contains(written, "Taken name") || strings.Count(written, "\nalert_service_alert_counter_total ") != 1 {
+		t.Errorf("Expected the registry counter to keep its name, got\n%s", written)
+	}
+}
@@ -0,0 +1,22 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+)
+
+// GetAlertTypes returns the alert types of the alert catalog by alert number
+// nolint :unparam
+func (alerts *Alerts) GetAlertTypes(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	web.Respond(ctx, writer, catalog.Default().Types(), http.StatusOK)
+	return nil
+}
@@ -0,0 +1,43 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+)
+
+func TestGetAlertTypes(t *testing.T) {
+	alertCatalog, err := catalog.New([]catalog.AlertType{
+		{Number: 22, Name: "sensor_offline", Severity: "critical", Description: "Sensor {{.DeviceID}} is offline"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create alert catalog %s", err)
+	}
+	catalog.SetDefault(alertCatalog)
+	defer catalog.SetDefault(nil)
+
+	alerts := Alerts{}
+	recorder := httptest.NewRecorder()
+	web.Handler(alerts.GetAlertTypes).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alert-types", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	var alertTypes []catalog.AlertType
+	if err := json.Unmarshal(recorder.Body.Bytes(), &alertTypes); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if len(alertTypes) != 6 || alertTypes[0].Number != 22 || alertTypes[1].Number != catalog.GatewayRegistered {
+		t.Errorf("Expected the configured alert type before the built-in ones, got %+v", alertTypes)
+	}
+}
@@ -0,0 +1,32 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// Config represents the configuration API method handler set.
+type Config struct {
+}
+
+// Reload reads the configuration again and applies it, answering with the settings that changed
+// nolint :unparam
+func (configHandler *Config) Reload(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	changes, err := config.Reload()
+	if err != nil {
+		return errors.Wrap(web.ErrValidation, err.Error())
+	}
+
+	web.Respond(ctx, writer, changes, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,59 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+func TestReloadConfig(t *testing.T) {
+	if err := config.InitConfig("", ""); err != nil {
+		t.Fatalf("Unable to load configuration %s", err)
+	}
+	loaded := config.Current()
+	defer func() {
+		config.Set(loaded)
+		config.SetReloadHandler(nil)
+	}()
+	configHandler := Config{}
+
+	changed := loaded
+	changed.MaxMissedHeartbeats = loaded.MaxMissedHeartbeats + 1
+	config.Set(changed)
+	config.SetReloadHandler(func(previous config.Variables, next config.Variables) error {
+		return errors.New("route urgent sends to unknown destination")
+	})
+	recorder := httptest.NewRecorder()
+	web.Handler(configHandler.Reload).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Bad request expected: %d Actual: %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	config.SetReloadHandler(nil)
+	recorder = httptest.NewRecorder()
+	web.Handler(configHandler.Reload).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	var changes []config.Change
+	if err := json.Unmarshal(recorder.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("Unable to read changes %s", err)
+	}
+	if len(changes) != 1 || changes[0].Setting != "maxMissedHeartbeats" || !changes[0].Applied {
+		t.Errorf("Expected the maxMissedHeartbeats change, got %+v", changes)
+	}
+	if config.Current().MaxMissedHeartbeats != loaded.MaxMissedHeartbeats {
+		t.Errorf("Expected maxMissedHeartbeats to be reloaded, got %d", config.Current().MaxMissedHeartbeats)
+	}
+}
@@ -0,0 +1,79 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// DeadLetters represents the dead letter API method handler set.
+type DeadLetters struct {
+}
+
+// ReplayResponse lists the dead letters put back in the delivery queue
+// swagger:model ReplayResponse
+type ReplayResponse struct {
+	Replayed int                `json:"replayed"`
+	Messages []delivery.Message `json:"messages"`
+}
+
+// GetDeadLetters returns every notification that could not be delivered
+func (deadLetters *DeadLetters) GetDeadLetters(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	store := delivery.DefaultDeadLetters()
+	if store == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, list, http.StatusOK)
+	return nil
+}
+
+// ReplayDeadLetter puts the dead letter with the id in the request path back in the delivery queue
+func (deadLetters *DeadLetters) ReplayDeadLetter(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	if delivery.DefaultDeadLetters() == nil || delivery.DefaultQueue() == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	id := mux.Vars(request)["id"]
+	message, err := alert.ReplayDeadLetter(id)
+	if err != nil {
+		if errors.Cause(err) == delivery.ErrDeadLetterNotFound {
+			return errors.Wrapf(web.ErrNotFound, "dead letter %s", id)
+		}
+		return err
+	}
+
+	web.Respond(ctx, writer, ReplayResponse{Replayed: 1, Messages: []delivery.Message{message}}, http.StatusAccepted)
+	return nil
+}
+
+// ReplayAllDeadLetters puts every dead letter back in the delivery queue
+func (deadLetters *DeadLetters) ReplayAllDeadLetters(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	if delivery.DefaultDeadLetters() == nil || delivery.DefaultQueue() == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	messages, err := alert.ReplayAllDeadLetters()
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, ReplayResponse{Replayed: len(messages), Messages: messages}, http.StatusAccepted)
+	return nil
+}
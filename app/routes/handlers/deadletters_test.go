@@ -0,0 +1,112 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDeadLetters(t *testing.T) {
+	deadLetters := DeadLetters{}
+	router := mux.NewRouter()
+	router.Handle("/deadletters", web.Handler(deadLetters.GetDeadLetters)).Methods(http.MethodGet)
+	router.Handle("/deadletters/replay", web.Handler(deadLetters.ReplayAllDeadLetters)).Methods(http.MethodPost)
+	router.Handle("/deadletters/{id}/replay", web.Handler(deadLetters.ReplayDeadLetter)).Methods(http.MethodPost)
+
+	delivery.SetDefaultDeadLetters(nil)
+	recorder := serveDeadLetters(t, router, http.MethodGet, "/deadletters")
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Service unavailable expected without database: %d Actual: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	dir, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+	queue, err := delivery.NewQueue(db)
+	if err != nil {
+		t.Fatalf("Unable to create queue %s", err)
+	}
+	store, err := delivery.NewDeadLetters(db)
+	if err != nil {
+		t.Fatalf("Unable to create dead letters %s", err)
+	}
+	delivery.SetDefaultQueue(queue)
+	delivery.SetDefaultDeadLetters(store)
+	defer delivery.SetDefaultQueue(nil)
+	defer delivery.SetDefaultDeadLetters(nil)
+
+	for _, id := range []string{"first", "second"} {
+		if _, err := store.Add(delivery.Message{ID: id, Attempts: 10}, "maximum delivery attempts reached"); err != nil {
+			t.Fatalf("Unable to add dead letter %s", err)
+		}
+	}
+
+	recorder = serveDeadLetters(t, router, http.MethodGet, "/deadletters")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	var list []delivery.DeadLetter
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Unable to unmarshal response: %s", err.Error())
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %d", len(list))
+	}
+
+	recorder = serveDeadLetters(t, router, http.MethodPost, "/deadletters/unknown/replay")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Not found expected: %d Actual: %d", http.StatusNotFound, recorder.Code)
+	}
+
+	recorder = serveDeadLetters(t, router, http.MethodPost, "/deadletters/first/replay")
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Accepted expected: %d Actual: %d", http.StatusAccepted, recorder.Code)
+	}
+
+	recorder = serveDeadLetters(t, router, http.MethodPost, "/deadletters/replay")
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Accepted expected: %d Actual: %d", http.StatusAccepted, recorder.Code)
+	}
+	var response ReplayResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response: %s", err.Error())
+	}
+	if response.Replayed != 1 || response.Messages[0].ID != "second" {
+		t.Errorf("Unexpected replay response %v", response)
+	}
+	if store.Count() != 0 || queue.Depth() != 2 {
+		t.Errorf("Expected all dead letters to be queued, got %d dead letters and %d queued", store.Count(), queue.Depth())
+	}
+}
+
+func serveDeadLetters(t *testing.T, router *mux.Router, method string, url string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
@@ -0,0 +1,48 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// Gateways represents the Gateway status API method handler set.
+type Gateways struct {
+}
+
+// GetGateways returns the current known status of every gateway
+// nolint :unparam
+func (gateways *Gateways) GetGateways(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	registry := models.GetInstanceGatewayRegistry()
+
+	gatewayInfos := make([]models.GatewayInfo, 0)
+	for _, gateway := range registry.GetGateways() {
+		gatewayInfos = append(gatewayInfos, gateway.GetGatewayInfo())
+	}
+
+	web.Respond(ctx, writer, gatewayInfos, http.StatusOK)
+	return nil
+}
+
+// GetGateway returns the current known status of the gateway with the device id in the request path
+func (gateways *Gateways) GetGateway(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	deviceID := mux.Vars(request)["deviceId"]
+
+	gateway, ok := models.GetInstanceGatewayRegistry().GetGateway(deviceID)
+	if !ok {
+		return errors.Wrapf(web.ErrNotFound, "gateway %s", deviceID)
+	}
+
+	web.Respond(ctx, writer, gateway.GetGatewayInfo(), http.StatusOK)
+	return nil
+}
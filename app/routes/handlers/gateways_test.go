@@ -0,0 +1,89 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+)
+
+func TestGetGateways(t *testing.T) {
+	gateway := models.GetInstanceGatewayRegistry().GetOrAddGateway("rrs-gateway-api")
+	gateway.UpdateGatewayStatus(time.Now(), 0, models.Heartbeat{DeviceID: "rrs-gateway-api"})
+	gateway.RegisterGateway()
+
+	request, err := http.NewRequest(http.MethodGet, "/gateways", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	gateways := Gateways{}
+	handler := web.Handler(gateways.GetGateways)
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+
+	var gatewayInfos []models.GatewayInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &gatewayInfos); err != nil {
+		t.Fatalf("Unable to unmarshal response: %s", err.Error())
+	}
+	found := false
+	for _, info := range gatewayInfos {
+		if info.DeviceID == "rrs-gateway-api" {
+			found = true
+			if info.RegistrationStatus != "registered" {
+				t.Errorf("Expected registration status registered, got %s", info.RegistrationStatus)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected gateway rrs-gateway-api in response")
+	}
+}
+
+func TestGetGateway(t *testing.T) {
+	models.GetInstanceGatewayRegistry().GetOrAddGateway("rrs-gateway-pending")
+
+	router := mux.NewRouter()
+	gateways := Gateways{}
+	router.Handle("/gateways/{deviceId}", web.Handler(gateways.GetGateway))
+
+	request, err := http.NewRequest(http.MethodGet, "/gateways/rrs-gateway-pending", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	var info models.GatewayInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Unable to unmarshal response: %s", err.Error())
+	}
+	if info.RegistrationStatus != "pending" {
+		t.Errorf("Expected registration status pending, got %s", info.RegistrationStatus)
+	}
+
+	request, err = http.NewRequest(http.MethodGet, "/gateways/unknown", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Not found expected: %d Actual: %d", http.StatusNotFound, recorder.Code)
+	}
+}
@@ -10,20 +10,37 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
-	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routes/schemas"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
 	metrics "github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/pkg/errors"
 )
 
+const (
+	// MaxAlertMessageBytes is the largest request body an alert message can have
+	MaxAlertMessageBytes = 1 << 20
+	// MaxAlertBatchBytes is the largest request body a batch of alert messages can have
+	MaxAlertBatchBytes = 4 << 20
+
+	// maxAlertBatchSize is the most alert messages a batch can have
+	maxAlertBatchSize = 500
+	// rejected is the status of the alert messages of a batch that were not accepted
+	rejected = "rejected"
+)
+
 // Alerts represents the User API method handler set.
 type Alerts struct {
+	// RateLimiter, if set, charges every alert message of a batch to its caller
+	RateLimiter *middlewares.RateLimiter
 }
 
 // GetIndex verifies check health
@@ -33,12 +50,41 @@ func (alerts *Alerts) GetIndex(ctx context.Context, writer http.ResponseWriter,
 	return nil
 }
 
-// SendAlertMessageToCloudConnector post the alert message in the request JSON payload to cloud connector
+// AlertStatus is where an alert sent through the API is on its way to its destinations
+// swagger:model AlertStatus
+type AlertStatus struct {
+	ID         string             `json:"id,omitempty"`
+	Status     string             `json:"status"`
+	Error      string             `json:"error,omitempty"`
+	Deliveries []history.Delivery `json:"deliveries,omitempty"`
+}
+
+// AlertBatchResponse is how many of the alert messages of a batch were accepted and rejected, and why
+// swagger:model AlertBatchResponse
+type AlertBatchResponse struct {
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+	Results  []AlertBatchResult `json:"results"`
+}
+
+// AlertBatchResult is the outcome of one alert message of a batch, in the order they were sent.
+// Status is queued or suppressed for accepted alert messages, and rejected along with the errors otherwise.
+// swagger:model AlertBatchResult
+type AlertBatchResult struct {
+	Index  int                 `json:"index"`
+	ID     string              `json:"id,omitempty"`
+	Status string              `json:"status"`
+	Error  string              `json:"error,omitempty"`
+	Errors []schemas.ErrReport `json:"errors,omitempty"`
+}
+
+// SendAlertMessageToCloudConnector submits the alert message in the request JSON payload to the notifier, which
+// delivers it to its destinations, and responds with the id its status can be followed by
 func (alerts *Alerts) SendAlertMessageToCloudConnector(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 	// Metrics
 	metrics.GetOrRegisterGauge("Alerts.SendAlertMessageToCloudConnector.Attempt", nil).Update(1)
 	startTime := time.Now()
-	defer metrics.GetOrRegisterTimer("Alerts.SendAlertMessageToCloudConnector.Latency", nil).Update(time.Since(startTime))
+	defer metrics.GetOrRegisterTimer("Alerts.SendAlertMessageToCloudConnector.Latency", nil).UpdateSince(startTime)
 
 	mSendAlertLatency := metrics.GetOrRegisterTimer("Alerts.SendAlertMessageToCloudConnector.SendAlert-Latency", nil)
 
@@ -60,31 +106,135 @@ func (alerts *Alerts) SendAlertMessageToCloudConnector(ctx context.Context, writ
 	}
 
 	sentCloudConnectorTimer := time.Now()
-	populateAlertNotificationPayload(&payload)
-	alertBytes, marshalErr := json.Marshal(payload)
-	if marshalErr != nil {
-		web.Respond(ctx, writer, inputValErrs, http.StatusBadRequest)
-		return errors.New("could not marshal the payload json bytes")
-	}
-
-	notificationChan := make(chan alert.Notification, config.AppConfig.NotificationChanSize)
-	processAlertErr := alert.ProcessAlert(&alertBytes, notificationChan)
-
-	if processAlertErr != nil {
+	status, submitErr := submitAlertMessage(payload)
+	if submitErr != nil {
 		mSendCloudConnectorErr.Update(1)
-		web.Respond(ctx, writer, inputValErrs, http.StatusInternalServerError)
-		return errors.New("process alert error")
+		if errors.Cause(submitErr) == alert.ErrNotAccepted {
+			return errors.Wrap(web.ErrServiceUnavailable, submitErr.Error())
+		}
+		return errors.Wrap(submitErr, "process alert error")
 	}
-	go alert.NotifyChannel(notificationChan)
 
 	mSendAlertLatency.Update(time.Since(sentCloudConnectorTimer))
 	mSuccess.Update(1)
 
-	responseData := "Alert Service has successfully process alertMessage to cloud connector"
-	web.Respond(ctx, writer, responseData, http.StatusOK)
+	web.Respond(ctx, writer, status, http.StatusAccepted)
+	return nil
+}
+
+// SendAlertMessages submits each alert message in the request JSON array to the notifier, responding with
+// the id of every accepted alert and the reasons every other one was rejected
+func (alerts *Alerts) SendAlertMessages(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	// Metrics
+	metrics.GetOrRegisterGauge("Alerts.SendAlertMessages.Attempt", nil).Update(1)
+	startTime := time.Now()
+	defer metrics.GetOrRegisterTimer("Alerts.SendAlertMessages.Latency", nil).UpdateSince(startTime)
+	mAccepted := metrics.GetOrRegisterCounter("Alerts.SendAlertMessages.Accepted", nil)
+	mRejected := metrics.GetOrRegisterCounter("Alerts.SendAlertMessages.Rejected", nil)
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		if errors.Cause(err) == web.ErrTooLarge {
+			return err
+		}
+		return errors.Wrap(web.ErrValidation, err.Error())
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return errors.Wrap(web.ErrValidation, "request body must be an array of alert messages: "+err.Error())
+	}
+	if len(items) == 0 || len(items) > maxAlertBatchSize {
+		return errors.Wrapf(web.ErrInvalidInput, "request body must have between 1 and %d alert messages, got %d",
+			maxAlertBatchSize, len(items))
+	}
+
+	response := AlertBatchResponse{Results: make([]AlertBatchResult, 0, len(items))}
+	limited := 0
+	var retryAfter time.Duration
+	for index, item := range items {
+		var result AlertBatchResult
+		if allowed, wait := alerts.allowItem(ctx, request, item); allowed {
+			result = submitBatchItem(item)
+		} else {
+			result = AlertBatchResult{Status: rejected, Error: "rate limit exceeded"}
+			limited++
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+		result.Index = index
+		if result.Status == rejected {
+			response.Rejected++
+		} else {
+			response.Accepted++
+		}
+		response.Results = append(response.Results, result)
+	}
+	mAccepted.Inc(int64(response.Accepted))
+	mRejected.Inc(int64(response.Rejected))
+
+	if limited > 0 {
+		middlewares.RetryAfter(writer, retryAfter)
+	}
+	if limited == len(items) {
+		return errors.Wrapf(web.ErrTooManyRequests, "rate limit exceeded for all %d alert messages", len(items))
+	}
+	web.Respond(ctx, writer, response, http.StatusAccepted)
 	return nil
 }
 
+// allowItem takes a token from the rate limit of the caller for an alert message of a batch
+func (alerts *Alerts) allowItem(ctx context.Context, request *http.Request, item json.RawMessage) (bool, time.Duration) {
+	if alerts.RateLimiter == nil {
+		return true, 0
+	}
+	var fields struct {
+		Application string `json:"application"`
+	}
+	_ = json.Unmarshal(item, &fields)
+	return alerts.RateLimiter.AllowItem(ctx, request, fields.Application)
+}
+
+// submitBatchItem validates one alert message of a batch against the alert message schema and submits it
+func submitBatchItem(item json.RawMessage) AlertBatchResult {
+	validatorResult, err := schemas.ValidateSchemaRequest(item, schemas.AlertMessageSchema)
+	if err != nil {
+		return AlertBatchResult{Status: rejected, Error: err.Error()}
+	}
+	if !validatorResult.Valid() {
+		errorList, _ := schemas.BuildErrorsString(validatorResult.Errors()).(schemas.ErrorList)
+		return AlertBatchResult{Status: rejected, Error: "could not validate alertmessage schema", Errors: errorList.Errors}
+	}
+
+	var payload models.AlertMessage
+	if err := json.Unmarshal(item, &payload); err != nil {
+		return AlertBatchResult{Status: rejected, Error: err.Error()}
+	}
+	status, err := submitAlertMessage(payload)
+	if err != nil {
+		return AlertBatchResult{Status: rejected, Error: err.Error()}
+	}
+	return AlertBatchResult{ID: status.ID, Status: status.Status}
+}
+
+// submitAlertMessage hands a validated alert message to the notifier and returns the status of its alert
+func submitAlertMessage(payload models.AlertMessage) (AlertStatus, error) {
+	populateAlertNotificationPayload(&payload)
+	alertBytes, err := json.Marshal(payload.Value)
+	if err != nil {
+		return AlertStatus{}, errors.Wrap(err, "could not marshal the payload json bytes")
+	}
+
+	id, err := alert.SubmitAlert(alertBytes)
+	if err != nil {
+		return AlertStatus{}, err
+	}
+	if id == "" {
+		return AlertStatus{Status: alert.Suppressed}, nil
+	}
+	return AlertStatus{ID: id, Status: history.Queued}, nil
+}
+
 // nolint: unparam
 func readAndValidateRequest(request *http.Request, schema string, v interface{}) (interface{}, error) {
 	// Reading request
@@ -117,6 +267,6 @@ func populateAlertNotificationPayload(alertPayload *models.AlertMessage) {
 	alertPayload.Datetime = time.Now()
 	// override 0
 	if alertPayload.Value.AlertNumber == 0 {
-		alertPayload.Value.AlertNumber = 686
+		alertPayload.Value.AlertNumber = catalog.ApplicationAlert
 	}
 }
@@ -8,12 +8,18 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"log"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
 )
 
@@ -50,13 +56,26 @@ func TestSendResetBaselineCompletionAlertMessageOk(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
 	}
+	notificationChan := make(chan alert.Notification, 1)
+	alert.SetDefaultChannel(notificationChan)
+	defer alert.SetDefaultChannel(nil)
 	recorder := httptest.NewRecorder()
-	alert := Alerts{}
-	handler := web.Handler(alert.SendAlertMessageToCloudConnector)
+	alerts := Alerts{}
+	handler := web.Handler(alerts.SendAlertMessageToCloudConnector)
 	handler.ServeHTTP(recorder, request)
 
-	if recorder.Code != http.StatusOK {
-		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Accepted expected: %d Actual: %d", http.StatusAccepted, recorder.Code)
+	}
+	var response AlertStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if response.ID == "" || response.Status != history.Queued {
+		t.Errorf("Expected a queued alert with its id, got %+v", response)
+	}
+	if notification := <-notificationChan; notification.Data.(models.Alert).ID != response.ID {
+		t.Errorf("Expected the alert sent to the notifier to have the id %s", response.ID)
 	}
 }
 
@@ -74,13 +93,26 @@ func TestSendResetBaselineCompletionAlertMessageWithNoAlertNumber(t *testing.T)
 	if err != nil {
 		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
 	}
+	notificationChan := make(chan alert.Notification, 1)
+	alert.SetDefaultChannel(notificationChan)
+	defer alert.SetDefaultChannel(nil)
 	recorder := httptest.NewRecorder()
-	alert := Alerts{}
-	handler := web.Handler(alert.SendAlertMessageToCloudConnector)
+	alerts := Alerts{}
+	handler := web.Handler(alerts.SendAlertMessageToCloudConnector)
 	handler.ServeHTTP(recorder, request)
 
-	if recorder.Code != http.StatusOK {
-		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Accepted expected: %d Actual: %d", http.StatusAccepted, recorder.Code)
+	}
+	var response AlertStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if response.ID == "" || response.Status != history.Queued {
+		t.Errorf("Expected a queued alert with its id, got %+v", response)
+	}
+	if notification := <-notificationChan; notification.Data.(models.Alert).ID != response.ID {
+		t.Errorf("Expected the alert sent to the notifier to have the id %s", response.ID)
 	}
 }
 
@@ -96,8 +128,8 @@ func TestSendAlertMessageBadInputs(t *testing.T) {
 		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
 	}
 	recorder := httptest.NewRecorder()
-	alert := Alerts{}
-	handler := web.Handler(alert.SendAlertMessageToCloudConnector)
+	alerts := Alerts{}
+	handler := web.Handler(alerts.SendAlertMessageToCloudConnector)
 	handler.ServeHTTP(recorder, request)
 
 	if recorder.Code != http.StatusBadRequest {
@@ -121,3 +153,143 @@ func TestSendAlertMessageBadInputs(t *testing.T) {
 		t.Fatalf("Bad Request for corrupted json input expected: %d Actual: %d", http.StatusBadRequest, recorder.Code)
 	}
 }
+
+func TestSendAlertMessageNotAccepted(t *testing.T) {
+	alertMessage := []byte(`{
+			"application": "test app",
+			"value": {
+				"sent_on": 1531522680000,
+				"alert_number": 260,
+				"alert_description": "reset baseline test alert message",
+				"severity": "warning"
+			}
+		}`)
+	alert.SetDefaultChannel(make(chan alert.Notification))
+	defer alert.SetDefaultChannel(nil)
+
+	request, err := http.NewRequest(http.MethodPost, "/alertmessage", bytes.NewBuffer(alertMessage))
+	if err != nil {
+		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	alerts := Alerts{}
+	web.Handler(alerts.SendAlertMessageToCloudConnector).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Service unavailable expected while the notifier is busy: %d Actual: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+func TestSendAlertMessages(t *testing.T) {
+	notificationChan := make(chan alert.Notification, 2)
+	alert.SetDefaultChannel(notificationChan)
+	defer alert.SetDefaultChannel(nil)
+
+	batch := []byte(`[
+		{"application": "test app", "value": {"sent_on": 1531522680000, "alert_number": 260, "alert_description": "first", "severity": "warning"}},
+		{"application": "test app", "value": {"sent_on": 1531522680000}},
+		{"application": "test app", "value": {"sent_on": 1531522680000, "alert_number": 261, "alert_description": "second", "severity": "critical"}},
+		{"application": "test app", "value": {"sent_on": 1531522680000, "alert_number": 262, "alert_description": "third", "severity": "info"}}
+	]`)
+	request, err := http.NewRequest(http.MethodPost, "/alert/alertmessages", bytes.NewBuffer(batch))
+	if err != nil {
+		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	alerts := Alerts{}
+	handler := web.Handler(alerts.SendAlertMessages)
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Accepted expected: %d Actual: %d", http.StatusAccepted, recorder.Code)
+	}
+	var response AlertBatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if response.Accepted != 2 || response.Rejected != 2 || len(response.Results) != 4 {
+		t.Fatalf("Expected 2 accepted and 2 rejected alert messages, got %+v", response)
+	}
+	if result := response.Results[0]; result.ID == "" || result.Status != history.Queued {
+		t.Errorf("Expected the first alert message to be queued, got %+v", result)
+	}
+	if result := response.Results[1]; result.Index != 1 || result.Status != rejected || len(result.Errors) == 0 {
+		t.Errorf("Expected the invalid alert message to be rejected with its schema errors, got %+v", result)
+	}
+	// the notification channel is full by the last alert message
+	if result := response.Results[3]; result.Status != rejected || result.Error == "" || len(result.Errors) != 0 {
+		t.Errorf("Expected the alert message over the channel size to be rejected, got %+v", result)
+	}
+
+	for _, body := range []string{`{"application": "test app"}`, `[]`} {
+		request, err := http.NewRequest(http.MethodPost, "/alert/alertmessages", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Bad Request expected for %s: %d Actual: %d", body, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+func TestSendAlertMessagesRateLimit(t *testing.T) {
+	notificationChan := make(chan alert.Notification, 10)
+	alert.SetDefaultChannel(notificationChan)
+	defer alert.SetDefaultChannel(nil)
+
+	limit := middlewares.RateLimit{PerSecond: 0.01, Burst: 2, Key: middlewares.RateLimitByApplication}
+	alerts := Alerts{RateLimiter: middlewares.NewRateLimiter(func() middlewares.RateLimit { return limit })}
+	handler := web.Handler(alerts.SendAlertMessages)
+	send := func(body []byte) *httptest.ResponseRecorder {
+		request, err := http.NewRequest(http.MethodPost, "/alert/alertmessages", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// every alert message is charged to its own application
+	recorder := send([]byte(`[
+		{"application": "app1", "value": {"sent_on": 1531522680000, "alert_number": 270, "alert_description": "first", "severity": "info"}},
+		{"application": "app1", "value": {"sent_on": 1531522680000, "alert_number": 271, "alert_description": "second", "severity": "info"}},
+		{"application": "app1", "value": {"sent_on": 1531522680000, "alert_number": 272, "alert_description": "third", "severity": "info"}},
+		{"application": "app2", "value": {"sent_on": 1531522680000, "alert_number": 273, "alert_description": "fourth", "severity": "info"}}
+	]`))
+	if recorder.Code != http.StatusAccepted || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("Accepted with a Retry-After header expected, got %d %v", recorder.Code, recorder.Header())
+	}
+	var response AlertBatchResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if response.Accepted != 3 || response.Rejected != 1 || response.Results[2].Status != rejected {
+		t.Errorf("Expected the third alert message of app1 to be over the limit, got %+v", response)
+	}
+
+	recorder = send([]byte(`[{"application": "app1", "value": {"sent_on": 1531522680000, "alert_number": 274, "alert_description": "fifth", "severity": "info"}}]`))
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("Too Many Requests with a Retry-After header expected, got %d %v", recorder.Code, recorder.Header())
+	}
+
+}
+
+func TestSendAlertMessagesTooLarge(t *testing.T) {
+	alerts := Alerts{}
+	handler := middlewares.LimitBody(MaxAlertBatchBytes)(alerts.SendAlertMessages)
+
+	// without a Content-Length the body is cut off as it is read
+	request, err := http.NewRequest(http.MethodPost, "/alert/alertmessages",
+		ioutil.NopCloser(bytes.NewReader(bytes.Repeat([]byte(" "), MaxAlertBatchBytes+1))))
+	if err != nil {
+		t.Fatalf("Unable to create a new HTTP request: %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	web.Handler(handler).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Request Entity Too Large expected for a body over %d bytes, got %d", MaxAlertBatchBytes, recorder.Code)
+	}
+}
@@ -0,0 +1,40 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/health"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+)
+
+// Health represents the liveness and readiness API method handler set.
+type Health struct {
+}
+
+// GetLive reports that the service is running and able to answer requests
+// nolint :unparam
+func (healthHandler *Health) GetLive(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	web.Respond(ctx, writer, health.Report{Status: health.StatusUp}, http.StatusOK)
+	return nil
+}
+
+// GetReady reports whether the service and the dependencies it needs are usable,
+// answering 503 when any of the checks fails
+// nolint :unparam
+func (healthHandler *Health) GetReady(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	report := health.Ready()
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+
+	web.Respond(ctx, writer, report, code)
+	return nil
+}
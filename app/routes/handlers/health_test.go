@@ -0,0 +1,58 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/health"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+func TestHealth(t *testing.T) {
+	healthHandler := Health{}
+
+	recorder := httptest.NewRecorder()
+	web.Handler(healthHandler.GetLive).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+
+	healthy := true
+	health.RegisterCheck("dependency", func() health.Result {
+		if healthy {
+			return health.Up(nil)
+		}
+		return health.Down(errors.New("unreachable"), "http://dependency")
+	})
+	defer health.UnregisterCheck("dependency")
+
+	recorder = httptest.NewRecorder()
+	web.Handler(healthHandler.GetReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+
+	healthy = false
+	recorder = httptest.NewRecorder()
+	web.Handler(healthHandler.GetReady).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Service unavailable expected: %d Actual: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	var report health.Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Unable to read report %s", err)
+	}
+	check := report.Checks["dependency"]
+	if report.Status != health.StatusDown || check.Status != health.StatusDown || check.Error != "unreachable" || check.Detail != "http://dependency" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+}
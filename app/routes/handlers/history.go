@@ -0,0 +1,225 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routes/schemas"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// AlertHistoryResponse is a page of the alert history
+// swagger:model AlertHistoryResponse
+type AlertHistoryResponse struct {
+	Total  int              `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	Alerts []history.Record `json:"alerts"`
+}
+
+// AlertTransitionRequest is who acknowledges or resolves an alert and why
+// swagger:model AlertTransitionRequest
+type AlertTransitionRequest struct {
+	User string `json:"user"`
+	Note string `json:"note"`
+}
+
+// GetAlerts returns the alerts processed by the service matching the query filters
+func (alerts *Alerts) GetAlerts(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	store := history.DefaultStore()
+	if store == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	filter, err := parseHistoryFilter(request.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	records, total, err := store.Query(filter)
+	if err != nil {
+		return err
+	}
+
+	web.Respond(ctx, writer, AlertHistoryResponse{
+		Total:  total,
+		Offset: filter.Offset,
+		Limit:  filter.Limit,
+		Alerts: records,
+	}, http.StatusOK)
+	return nil
+}
+
+// GetAlert returns the alert with the id in the request path along with its state
+func (alerts *Alerts) GetAlert(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	store := history.DefaultStore()
+	if store == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	id := mux.Vars(request)["id"]
+	record, err := store.Get(id)
+	if err != nil {
+		return historyError(err, id)
+	}
+
+	web.Respond(ctx, writer, record, http.StatusOK)
+	return nil
+}
+
+// GetAlertStatus returns whether the alert sent through the API with the id in the request path is still queued,
+// was delivered or failed, along with the response of each of its destinations
+func (alerts *Alerts) GetAlertStatus(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	id := mux.Vars(request)["id"]
+	store := history.DefaultStore()
+	if store != nil {
+		record, err := store.Get(id)
+		if err == nil {
+			web.Respond(ctx, writer, AlertStatus{
+				ID:         record.ID,
+				Status:     record.Outcome,
+				Error:      record.Error,
+				Deliveries: record.Deliveries,
+			}, http.StatusOK)
+			return nil
+		}
+		if errors.Cause(err) != history.ErrRecordNotFound {
+			return err
+		}
+	}
+
+	// alerts still waiting for the notifier are not recorded yet
+	if alert.Submitted(id) {
+		web.Respond(ctx, writer, AlertStatus{ID: id, Status: history.Queued}, http.StatusOK)
+		return nil
+	}
+	if store == nil {
+		return web.ErrDBNotConfigured
+	}
+	return errors.Wrapf(web.ErrNotFound, "alert %s", id)
+}
+
+// AcknowledgeAlert marks the alert with the id in the request path as being taken care of
+func (alerts *Alerts) AcknowledgeAlert(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	return transitionAlert(ctx, writer, request, history.Acknowledged)
+}
+
+// ResolveAlert marks the alert with the id in the request path as dealt with
+func (alerts *Alerts) ResolveAlert(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	return transitionAlert(ctx, writer, request, history.Resolved)
+}
+
+func transitionAlert(ctx context.Context, writer http.ResponseWriter, request *http.Request, state string) error {
+	store := history.DefaultStore()
+	if store == nil {
+		return web.ErrDBNotConfigured
+	}
+
+	var payload AlertTransitionRequest
+	inputValErrs, err := readAndValidateRequest(request, schemas.AlertTransitionSchema, &payload)
+	if err != nil {
+		return err
+	}
+	if inputValErrs != nil {
+		web.Respond(ctx, writer, inputValErrs, http.StatusBadRequest)
+		return errors.New("could not validate request alert transition schema")
+	}
+
+	id := mux.Vars(request)["id"]
+	record, err := store.Transition(id, state, payload.User, payload.Note)
+	if err != nil {
+		return historyError(err, id)
+	}
+
+	web.Respond(ctx, writer, record, http.StatusOK)
+	return nil
+}
+
+// historyError maps alert history errors to the API errors they are reported as
+func historyError(err error, id string) error {
+	switch errors.Cause(err) {
+	case history.ErrRecordNotFound:
+		return errors.Wrapf(web.ErrNotFound, "alert %s", id)
+	case history.ErrInvalidTransition:
+		return errors.Wrap(web.ErrConflict, err.Error())
+	}
+	return err
+}
+
+func parseHistoryFilter(query url.Values) (history.Filter, error) {
+	filter := history.Filter{
+		Severity: query.Get("severity"),
+		DeviceID: query.Get("device_id"),
+		Facility: query.Get("facility"),
+		State:    query.Get("state"),
+		Limit:    defaultHistoryLimit,
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.AlertNumber, err = parseIntParam(query, "alert_number", 0); err != nil {
+		return filter, err
+	}
+	if filter.Offset, err = parseIntParam(query, "offset", 0); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntParam(query, "limit", defaultHistoryLimit); err != nil {
+		return filter, err
+	}
+	if filter.Offset < 0 || filter.Limit <= 0 || filter.Limit > maxHistoryLimit {
+		return filter, errors.Wrapf(web.ErrInvalidInput, "offset must be positive and limit between 1 and %d", maxHistoryLimit)
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam accepts either a millisecond epoch, like sent_on, or an RFC3339 timestamp
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(web.ErrInvalidInput, "%s must be a millisecond epoch or RFC3339 time", name)
+	}
+	return parsed, nil
+}
+
+func parseIntParam(query url.Values, name string, defaultValue int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrapf(web.ErrInvalidInput, "%s must be an integer", name)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,238 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestGetAlerts(t *testing.T) {
+	alerts := Alerts{}
+	handler := web.Handler(alerts.GetAlerts)
+
+	history.SetDefaultStore(nil)
+	request, err := http.NewRequest(http.MethodGet, "/alerts", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Service unavailable expected without history: %d Actual: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	dir, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create store %s", err)
+	}
+	history.SetDefaultStore(store)
+	defer history.SetDefaultStore(nil)
+
+	for _, severity := range []string{"info", "critical", "critical"} {
+		if _, err := store.Add(history.Record{Alert: models.Alert{AlertNumber: 22, Severity: severity}}); err != nil {
+			t.Fatalf("Unable to add record %s", err)
+		}
+	}
+
+	request, err = http.NewRequest(http.MethodGet, "/alerts?severity=critical&limit=1", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	var response AlertHistoryResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal response %s", err)
+	}
+	if response.Total != 2 || len(response.Alerts) != 1 {
+		t.Errorf("Expected 1 of 2 critical alerts, got %d of %d", len(response.Alerts), response.Total)
+	}
+
+	request, err = http.NewRequest(http.MethodGet, "/alerts?alert_number=abc", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("Bad request expected: %d Actual: %d", http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestAlertTransitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create store %s", err)
+	}
+	history.SetDefaultStore(store)
+	defer history.SetDefaultStore(nil)
+
+	record, err := store.Add(history.Record{Alert: models.Alert{AlertNumber: 22, Severity: "critical"}})
+	if err != nil {
+		t.Fatalf("Unable to add record %s", err)
+	}
+
+	alerts := Alerts{}
+	router := mux.NewRouter()
+	router.Handle("/alerts/{id}", web.Handler(alerts.GetAlert)).Methods(http.MethodGet)
+	router.Handle("/alerts/{id}/acknowledge", web.Handler(alerts.AcknowledgeAlert)).Methods(http.MethodPost)
+	router.Handle("/alerts/{id}/resolve", web.Handler(alerts.ResolveAlert)).Methods(http.MethodPost)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		code   int
+		state  string
+	}{
+		{"get", http.MethodGet, "/alerts/" + record.ID, "", http.StatusOK, history.Open},
+		{"get unknown", http.MethodGet, "/alerts/unknown", "", http.StatusNotFound, ""},
+		{"missing user", http.MethodPost, "/alerts/" + record.ID + "/acknowledge", `{"note":"on my way"}`, http.StatusBadRequest, ""},
+		{"acknowledge unknown", http.MethodPost, "/alerts/unknown/acknowledge", `{"user":"jdoe"}`, http.StatusNotFound, ""},
+		{"acknowledge", http.MethodPost, "/alerts/" + record.ID + "/acknowledge", `{"user":"jdoe","note":"on my way"}`, http.StatusOK, history.Acknowledged},
+		{"resolve", http.MethodPost, "/alerts/" + record.ID + "/resolve", `{"user":"jdoe","note":"fixed"}`, http.StatusOK, history.Resolved},
+		{"acknowledge resolved", http.MethodPost, "/alerts/" + record.ID + "/acknowledge", `{"user":"jdoe"}`, http.StatusConflict, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+			if err != nil {
+				t.Fatalf("Unable to create new HTTP request %s", err.Error())
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.code {
+				t.Fatalf("Expected: %d Actual: %d %s", test.code, recorder.Code, recorder.Body.String())
+			}
+			if test.state == "" {
+				return
+			}
+			var response history.Record
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Unable to unmarshal response %s", err)
+			}
+			if response.State != test.state {
+				t.Errorf("Expected state %s, got %s", test.state, response.State)
+			}
+		})
+	}
+}
+
+func TestGetAlertStatus(t *testing.T) {
+	notificationChan := make(chan alert.Notification, 1)
+	alert.SetDefaultChannel(notificationChan)
+	defer alert.SetDefaultChannel(nil)
+
+	alerts := Alerts{}
+	router := mux.NewRouter()
+	router.Handle("/alert/alertmessage", web.Handler(alerts.SendAlertMessageToCloudConnector)).Methods(http.MethodPost)
+	router.Handle("/alert/{id}/status", web.Handler(alerts.GetAlertStatus)).Methods(http.MethodGet)
+	getStatus := func(id string) (int, AlertStatus) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/alert/"+id+"/status", nil))
+		var status AlertStatus
+		if recorder.Code == http.StatusOK {
+			if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+				t.Fatalf("Unable to unmarshal response %s", err)
+			}
+		}
+		return recorder.Code, status
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/alert/alertmessage",
+		bytes.NewBufferString(`{"application":"test app","value":{"sent_on":1531522680000,"alert_number":22,"alert_description":"test","severity":"critical"}}`)))
+	var accepted AlertStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &accepted); err != nil || recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected the alert to be accepted, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if code, status := getStatus(accepted.ID); code != http.StatusOK || status.Status != history.Queued {
+		t.Errorf("Expected the alert to be queued while waiting for the notifier, got %d %+v", code, status)
+	}
+
+	history.SetDefaultStore(nil)
+	if code, _ := getStatus("unknown"); code != http.StatusServiceUnavailable {
+		t.Errorf("Service unavailable expected without history: %d Actual: %d", http.StatusServiceUnavailable, code)
+	}
+
+	dir, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database %s", err)
+	}
+	defer db.Close()
+	store, err := history.NewStore(db)
+	if err != nil {
+		t.Fatalf("Unable to create store %s", err)
+	}
+	history.SetDefaultStore(store)
+	defer history.SetDefaultStore(nil)
+
+	submitted := (<-notificationChan).Data.(models.Alert)
+	record, err := store.Add(history.Record{
+		ID:    submitted.ID,
+		Alert: submitted,
+		Deliveries: []history.Delivery{
+			{Destination: "store-ops", Outcome: history.Delivered, StatusCode: http.StatusAccepted, Response: "queued"},
+			{Destination: "it", Outcome: history.Failed, Error: "rejected", StatusCode: http.StatusBadRequest, Response: "unknown severity"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to add record %s", err)
+	}
+	code, status := getStatus(record.ID)
+	if code != http.StatusOK || status.Status != history.Failed || len(status.Deliveries) != 2 ||
+		status.Deliveries[0].StatusCode != http.StatusAccepted || status.Deliveries[0].Response != "queued" ||
+		status.Deliveries[1].StatusCode != http.StatusBadRequest || status.Deliveries[1].Response != "unknown severity" {
+		t.Errorf("Expected the failed delivery with its response, got %d %+v", code, status)
+	}
+	if code, _ := getStatus("unknown"); code != http.StatusNotFound {
+		t.Errorf("Not found expected: %d Actual: %d", http.StatusNotFound, code)
+	}
+}
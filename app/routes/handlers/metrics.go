@@ -0,0 +1,35 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/prometheus"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+// Metrics represents the Prometheus metrics API method handler set.
+type Metrics struct {
+}
+
+// GetMetrics returns the metrics of the service in the Prometheus text format
+// nolint :unparam
+func (metricsHandler *Metrics) GetMetrics(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	// write to a buffer first, so a failure still gets an error response
+	var exposition bytes.Buffer
+	if err := prometheus.Write(&exposition, metrics.DefaultRegistry); err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", prometheus.ContentType)
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(exposition.Bytes())
+	return nil
+}
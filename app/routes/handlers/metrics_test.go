@@ -0,0 +1,38 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/prometheus"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+func TestGetMetrics(t *testing.T) {
+	metrics.GetOrRegisterGauge("HandlersTest.Metrics.Gauge", nil).Update(7)
+	defer metrics.Unregister("HandlersTest.Metrics.Gauge")
+
+	metricsHandler := Metrics{}
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	recorder := httptest.NewRecorder()
+	web.Handler(metricsHandler.GetMetrics).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d Actual: %d", http.StatusOK, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != prometheus.ContentType {
+		t.Errorf("Expected content type %s, got %s", prometheus.ContentType, contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "\nalert_service_handlers_test_metrics_gauge 7\n") {
+		t.Errorf("Expected the gauge in the metrics, got\n%s", recorder.Body.String())
+	}
+}
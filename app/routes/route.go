@@ -7,8 +7,12 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gorilla/mux"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/idempotency"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routes/handlers"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
@@ -20,12 +24,22 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc web.Handler
+	// Role is the role callers need, RolePublic for routes open to every caller
+	Role middlewares.Role
 }
 
 // NewRouter creates the routes for GET and POST
 func NewRouter() *mux.Router {
 
-	alerts := handlers.Alerts{}
+	limiter := middlewares.NewRateLimiter(rateLimit)
+	idempotent := middlewares.NewIdempotency(idempotencyStore, idempotencyKeyTTL)
+
+	alerts := handlers.Alerts{RateLimiter: limiter}
+	gateways := handlers.Gateways{}
+	deadLetters := handlers.DeadLetters{}
+	metrics := handlers.Metrics{}
+	healthChecks := handlers.Health{}
+	configuration := handlers.Config{}
 
 	var routes = []Route{
 		// swagger:operation GET / default Healthcheck
@@ -53,6 +67,40 @@ func NewRouter() *mux.Router {
 			"GET",
 			"/",
 			alerts.GetIndex,
+			middlewares.RolePublic,
+		},
+		// swagger:route GET /alert-types getAlertTypes
+		//
+		// Retrieves the alert catalog
+		//
+		// The alert catalog describes the alerts with each alert number. Alerts are sent with the name and remediation
+		// of their alert type, and with its severity and description when they have none.<br><br>
+		//
+		// + number  - the alert number
+		// + name  - the name of the alert type
+		// + severity  - the severity of alerts sent without one
+		// + description  - the Go template the description of alerts sent without one is rendered with, such as Gateway {{.DeviceID}} registered
+		// + remediation  - how to deal with the alerts
+		//
+		// The built-in alert types of the alerts raised by the service can be replaced, and alert types added, with alertTypes.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:[]AlertType
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//
+		{
+			"GetAlertTypes",
+			"GET",
+			"/alert-types",
+			alerts.GetAlertTypes,
+			middlewares.RoleReadOnly,
 		},
 		// swagger:route POST /alert/alertmessage sendAlertMessage
 		//
@@ -82,7 +130,15 @@ func NewRouter() *mux.Router {
 		//
 		//
 		//
-		// Response will be either Ok or error messages when posting to cloud connector fails.
+		// The alert is handed to the same notifier as the alerts received from EdgeX, which delivers it to its
+		// destinations. Response is 202 with the id of the alert, to follow its delivery at /alert/{id}/status,
+		// and the status queued, or suppressed without an id when it is a duplicate of an alert sent shortly before.
+		// Response is 503 when the notifier cannot take more alerts.
+		// Request body can be at most 1 MiB, larger requests are answered with 413.
+		// Callers sending more alerts than rateLimitPerSecond allows are answered with 429 and a Retry-After header.
+		// Retries sent with the same Idempotency-Key header and body within idempotencyKeyTTLSeconds get the original
+		// response back instead of sending the alerts again, without counting against the rate limit. Reusing the key
+		// with a different body is answered with 409.
 		//
 		//     Consumes:
 		//     - application/json
@@ -93,8 +149,13 @@ func NewRouter() *mux.Router {
 		//     Schemes: http
 		//
 		//     Responses:
-		//       200: statusOk
+		//       202: body:AlertStatus
 		//       400: schemaValidation
+		//       401: internalError
+		//       403: internalError
+		//       409: internalError
+		//       413: internalError
+		//       429: internalError
 		//       500: internalError
 		//       503: serviceUnavailable
 		//
@@ -103,13 +164,494 @@ func NewRouter() *mux.Router {
 			"POST",
 			"/alert/alertmessage",
 			alerts.SendAlertMessageToCloudConnector,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route POST /alert/alertmessages sendAlertMessages
+		//
+		// Send a batch of alert messages for events
+		//
+		// Request body is a JSON array of up to 500 alert messages, each in the format of POST /alert/alertmessage.<br><br>
+		//
+		// Each alert message is validated and handed to the notifier on its own. Response is 202 with how many
+		// alert messages were accepted and rejected, and a result for each of them in the order they were sent:
+		//
+		// + index  - the position of the alert message in the request
+		// + id  - the id of the accepted alert, to follow its delivery at /alert/{id}/status
+		// + status  - queued, suppressed when it is a duplicate of an alert sent shortly before, or rejected
+		// + error  - why the alert message was rejected
+		// + errors  - the schema validation errors of the rejected alert message
+		//
+		// Request body can be at most 4 MiB, larger requests are answered with 413. Every alert message takes one of
+		// the requests rateLimitPerSecond allows the caller, charged to its own application when rateLimitKey is
+		// application. Alert messages over the limit are rejected and the response has a Retry-After header, or is
+		// 429 when all of them are over the limit.
+		// Retries sent with the same Idempotency-Key header and body within idempotencyKeyTTLSeconds get the original
+		// response back instead of sending the alerts again, without counting against the rate limit. Reusing the key
+		// with a different body is answered with 409.
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: body:AlertBatchResponse
+		//       400: internalError
+		//       401: internalError
+		//       403: internalError
+		//       409: internalError
+		//       413: internalError
+		//       429: internalError
+		//       500: internalError
+		//
+		{
+			"SendAlertMessages",
+			"POST",
+			"/alert/alertmessages",
+			alerts.SendAlertMessages,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route GET /alert/{id}/status getAlertStatus
+		//
+		// Retrieves the delivery status of an alert sent through the API
+		//
+		// Status is queued while the alert waits for the notifier or the delivery queue, then delivered
+		// or failed, along with the outcome and error of each of its destinations, and the status code and the first
+		// 1 KiB of the body the destination responded with.<br><br>
+		//
+		// + id  - the id of the alert returned when it was sent
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AlertStatus
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"GetAlertStatus",
+			"GET",
+			"/alert/{id}/status",
+			alerts.GetAlertStatus,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route GET /alerts getAlerts
+		//
+		// Retrieves the history of alerts processed by the service
+		//
+		// Alerts are returned newest first, along with their gateway id, destination and delivery outcome.<br><br>
+		//
+		// + from  - only alerts processed at or after this time, in millisecond epoch or RFC3339
+		// + to  - only alerts processed at or before this time, in millisecond epoch or RFC3339
+		// + severity  - only alerts with this severity
+		// + alert_number  - only alerts with this alert number
+		// + device_id  - only alerts for this device or gateway
+		// + facility  - only alerts for this facility
+		// + state  - only alerts in this state: open, acknowledged or resolved
+		// + offset  - number of matching alerts to skip, defaults to 0
+		// + limit  - maximum number of alerts to return, defaults to 100 and cannot exceed 1000
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AlertHistoryResponse
+		//       400: internalError
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"GetAlerts",
+			"GET",
+			"/alerts",
+			alerts.GetAlerts,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route GET /alerts/{id} getAlert
+		//
+		// Retrieves a single alert along with its state
+		//
+		// + id  - the id of the alert
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AlertRecord
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"GetAlert",
+			"GET",
+			"/alerts/{id}",
+			alerts.GetAlert,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route POST /alerts/{id}/acknowledge acknowledgeAlert
+		//
+		// Acknowledges an open alert
+		//
+		// Marks the alert as being taken care of by the user in the request body, with an optional note.<br><br>
+		//
+		// + id  - the id of the alert
+		//
+		// Example Input:
+		// ```
+		// {
+		//	"user": "jdoe",
+		//	"note": "Technician on the way"
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AlertRecord
+		//       400: schemaValidation
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       409: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"AcknowledgeAlert",
+			"POST",
+			"/alerts/{id}/acknowledge",
+			alerts.AcknowledgeAlert,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route POST /alerts/{id}/resolve resolveAlert
+		//
+		// Resolves an open or acknowledged alert
+		//
+		// Marks the alert as dealt with by the user in the request body, with an optional note.
+		// Deregistered gateway alerts (322) are also resolved automatically when the gateway registers again.<br><br>
+		//
+		// + id  - the id of the alert
+		//
+		// Example Input:
+		// ```
+		// {
+		//	"user": "jdoe",
+		//	"note": "Replaced the power supply"
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AlertRecord
+		//       400: schemaValidation
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       409: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"ResolveAlert",
+			"POST",
+			"/alerts/{id}/resolve",
+			alerts.ResolveAlert,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route GET /gateways getGateways
+		//
+		// Retrieves the current status of every known Intel® RSP Controller
+		//
+		// The status of every gateway seen in a heartbeat is returned, including when its first and last
+		// heartbeats were seen, how many heartbeats it has missed and its registration status,
+		// which is one of pending, registered or deregistered.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:[]GatewayInfo
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//
+		{
+			"GetGateways",
+			"GET",
+			"/gateways",
+			gateways.GetGateways,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route GET /gateways/{deviceId} getGateway
+		//
+		// Retrieves the current status of a single Intel® RSP Controller
+		//
+		// + deviceId  - the device id reported by the gateway in its heartbeats
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:GatewayInfo
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       500: internalError
+		//
+		{
+			"GetGateway",
+			"GET",
+			"/gateways/{deviceId}",
+			gateways.GetGateway,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route GET /deadletters getDeadLetters
+		//
+		// Retrieves the notifications that could not be delivered
+		//
+		// A notification becomes a dead letter when it is rejected by its destination or has used up
+		// every delivery attempt. Each dead letter includes the failure reason, the number of attempts
+		// and the last HTTP status code received.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:[]DeadLetter
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"GetDeadLetters",
+			"GET",
+			"/deadletters",
+			deadLetters.GetDeadLetters,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route POST /deadletters/replay replayAllDeadLetters
+		//
+		// Puts every dead letter back in the delivery queue
+		//
+		// Use once the problem with the downstream destination has been fixed.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: body:ReplayResponse
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"ReplayAllDeadLetters",
+			"POST",
+			"/deadletters/replay",
+			deadLetters.ReplayAllDeadLetters,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route POST /deadletters/{id}/replay replayDeadLetter
+		//
+		// Puts a single dead letter back in the delivery queue
+		//
+		// + id  - the id of the dead letter
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: body:ReplayResponse
+		//       401: internalError
+		//       403: internalError
+		//       404: internalError
+		//       500: internalError
+		//       503: serviceUnavailable
+		//
+		{
+			"ReplayDeadLetter",
+			"POST",
+			"/deadletters/{id}/replay",
+			deadLetters.ReplayDeadLetter,
+			middlewares.RoleAdmin,
+		},
+		// swagger:route GET /health/live getLive
+		//
+		// Reports whether the service is running
+		//
+		// Answers as long as the service is able to take web requests, use it to decide when to restart the service.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:HealthReport
+		//
+		{
+			"GetLive",
+			"GET",
+			"/health/live",
+			healthChecks.GetLive,
+			middlewares.RolePublic,
+		},
+		// swagger:route GET /health/ready getReady
+		//
+		// Reports whether the service and the dependencies it needs are usable
+		//
+		// The service is ready when every check is up. The checks are whether the EdgeX functions pipeline is running
+		// (edgexPipeline), how full the notification channel is against notificationChanSize (notificationChannel),
+		// whether deliveries to the cloud connector keep failing (cloudConnector), down after 5 failures in a row, and,
+		// while sendNotWhitelistedAlert is on, whether the SKU mapping service is reachable (skuMapping). Each check
+		// reports its status, its details and why it failed.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:HealthReport
+		//       503: body:HealthReport
+		//
+		{
+			"GetReady",
+			"GET",
+			"/health/ready",
+			healthChecks.GetReady,
+			middlewares.RolePublic,
+		},
+		// swagger:operation GET /metrics default getMetrics
+		//
+		// Retrieves the metrics of the service in the Prometheus text format
+		//
+		// Every gauge, timer, meter and gauge collection of the service is included, named after its metric
+		// with an alert_service_ prefix in lower case words separated by underscores. Timers are reported in seconds.
+		// The depths of the notification channel and delivery queue and the status of every gateway are included too.
+		//
+		// ---
+		// produces:
+		// - text/plain
+		//
+		// schemes:
+		// - http
+		//
+		// responses:
+		//   '200':
+		//     description: Metrics in the Prometheus text format
+		//   '401':
+		//     "$ref": "#/responses/internalError"
+		//   '403':
+		//     "$ref": "#/responses/internalError"
+		//   '500':
+		//     "$ref": "#/responses/internalError"
+		//
+		{
+			"GetMetrics",
+			"GET",
+			"/metrics",
+			metrics.GetMetrics,
+			middlewares.RoleReadOnly,
+		},
+		// swagger:route POST /config/reload reloadConfig
+		//
+		// Reads the configuration again and applies the settings that changed, such as the watchdog, the routing table and the logging level
+		//
+		// Settings that only take effect when the service starts, such as port, notificationChanSize, databasePath and the
+		// delivery retry settings, are reported with applied false and keep their current values until the service is restarted.
+		// The configuration file is also reloaded automatically when it changes, and a configuration kept in Consul as it is updated.
+		// Secrets are masked in the changes.
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:[]ConfigChange
+		//       400: internalError
+		//       401: internalError
+		//       403: internalError
+		//       500: internalError
+		//
+		{
+			"ReloadConfig",
+			"POST",
+			"/config/reload",
+			configuration.Reload,
+			middlewares.RoleAdmin,
 		},
 	}
 
+	// the routes alerts are sent to are rate limited per caller, so no caller can flood the service,
+	// and honour idempotency keys, so retries get the original response instead of sending the alerts again.
+	// Retries are answered before the rate limit, so only requests that send alerts are charged.
+	// Their request bodies are capped before any of it is read.
+	sendsAlerts := map[string]int64{
+		"SendAlertMessage":  handlers.MaxAlertMessageBytes,
+		"SendAlertMessages": handlers.MaxAlertBatchBytes,
+	}
+	// batches are charged a token for each of their alert messages by the handler instead
+	limitedPerItem := map[string]bool{
+		"SendAlertMessages": true,
+	}
+
 	router := mux.NewRouter().StrictSlash(true)
 	for _, route := range routes {
 
 		var handler = route.HandlerFunc
+		if bodyLimit, found := sendsAlerts[route.Name]; found {
+			if !limitedPerItem[route.Name] {
+				handler = limiter.Limit(handler)
+			}
+			handler = idempotent.Idempotent(handler)
+			handler = middlewares.LimitBody(bodyLimit)(handler)
+		}
+		handler = middlewares.Auth(credentials, route.Role)(handler)
 		handler = middlewares.Recover(handler)
 		handler = middlewares.Logger(handler)
 
@@ -122,3 +664,36 @@ func NewRouter() *mux.Router {
 
 	return router
 }
+
+// rateLimit returns the rate limit of the current configuration
+func rateLimit() middlewares.RateLimit {
+	settings := config.Current()
+	return middlewares.RateLimit{
+		PerSecond: settings.RateLimitPerSecond,
+		Burst:     settings.RateLimitBurst,
+		Key:       settings.RateLimitKey,
+	}
+}
+
+// idempotencyStore returns the store of the responses to requests sent with an idempotency key, or nil if there is none
+func idempotencyStore() middlewares.IdempotencyStore {
+	if store := idempotency.DefaultStore(); store != nil {
+		return store
+	}
+	return nil
+}
+
+// idempotencyKeyTTL returns how long the responses to requests sent with an idempotency key are kept
+func idempotencyKeyTTL() time.Duration {
+	return time.Duration(config.Current().IdempotencyKeyTTLSeconds) * time.Second
+}
+
+// credentials returns the API keys and JWT secret of the current configuration
+func credentials() middlewares.Credentials {
+	settings := config.Current()
+	credentials := middlewares.Credentials{APIKeys: settings.APIKeys}
+	if settings.JWTSecret != "" {
+		credentials.JWTSecret = []byte(settings.JWTSecret)
+	}
+	return credentials
+}
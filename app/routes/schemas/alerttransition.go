@@ -0,0 +1,25 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// AlertTransitionSchema is the json schema for acknowledging or resolving an alert
+const AlertTransitionSchema = `{
+	"required": [
+		"user"
+	],
+	"properties": {
+		"user": {
+			"type": "string",
+			"minLength": 1
+		},
+		"note": {
+			"type": "string"
+		}
+	},
+	"additionalProperties": false,
+	"type": "object"
+}`
@@ -0,0 +1,349 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package routing
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDestinationName is the name of the destination notifications go to when no route matches them
+	DefaultDestinationName = "default"
+
+	// ModeCloudConnector delivers notifications wrapped in a payload for the cloud connector to forward
+	ModeCloudConnector = "cloudConnector"
+	// ModeWebhook posts notifications as they are straight to the destination url
+	ModeWebhook = "webhook"
+	// ModeMQTT publishes notifications to the MQTT broker at the destination url
+	ModeMQTT = "mqtt"
+	// ModeEmail emails notifications through the SMTP server at the destination url
+	ModeEmail = "email"
+	// ModeSlack posts notifications as Slack Block Kit messages to the incoming webhook at the destination url
+	ModeSlack = "slack"
+	// ModeTeams posts notifications as Microsoft Teams MessageCards to the incoming webhook at the destination url
+	ModeTeams = "teams"
+)
+
+const (
+	// AuthBasic sends the client id and secret of the destination as basic auth
+	AuthBasic = "basic"
+	// AuthBearer sends the static token of the destination as a bearer token
+	AuthBearer = "bearer"
+	// AuthOAuth2 sends a bearer token requested from the auth endpoint of the destination with its client credentials
+	AuthOAuth2 = "oauth2"
+)
+
+// authTypes lists the ways requests to a destination can be authorized
+var authTypes = map[string]bool{
+	AuthBasic:  true,
+	AuthBearer: true,
+	AuthOAuth2: true,
+}
+
+// modes lists the ways notifications can reach a destination
+var modes = map[string]bool{
+	ModeCloudConnector: true,
+	ModeWebhook:        true,
+	ModeMQTT:           true,
+	ModeEmail:          true,
+	ModeSlack:          true,
+	ModeTeams:          true,
+}
+
+var (
+	defaultTable *Table
+	defaultMutex sync.RWMutex
+)
+
+// Destination is a named place notifications are delivered to, with its own URL and auth
+type Destination struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	AuthType     string `json:"authType"`
+	AuthEndpoint string `json:"authEndpoint"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// Token is the static token sent with AuthBearer
+	Token string `json:"token"`
+	// Mode is how notifications reach the destination, ModeCloudConnector, ModeWebhook, ModeMQTT, ModeEmail,
+	// ModeSlack or ModeTeams
+	Mode string `json:"mode"`
+	// Headers are added to the requests posted to the destination in webhook, slack and teams mode
+	Headers map[string]string `json:"headers"`
+	TLS     TLS               `json:"tls"`
+	MQTT    MQTT              `json:"mqtt"`
+	Email   Email             `json:"email"`
+}
+
+// MQTT holds the settings of a destination in mqtt mode
+type MQTT struct {
+	// Topic is the template of the topic notifications are published to, such as alerts/{facility}/{severity}
+	Topic    string `json:"topic"`
+	QoS      byte   `json:"qos"`
+	Retain   bool   `json:"retain"`
+	ClientID string `json:"clientId"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Email holds the settings of a destination in email mode
+type Email struct {
+	From string `json:"from"`
+	// To receives the notifications no recipients entry matches
+	To []string `json:"to"`
+	// Recipients choose who receives a notification by its facilities and severity
+	Recipients []Recipients `json:"recipients"`
+	// Subject, TextTemplate and HTMLTemplate are Go templates the alert is rendered with,
+	// the defaults are used when they are empty and no html part is sent without an HTMLTemplate
+	Subject      string `json:"subject"`
+	TextTemplate string `json:"textTemplate"`
+	HTMLTemplate string `json:"htmlTemplate"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	// StartTLS fails the delivery when the server does not support STARTTLS, which is used whenever it does
+	StartTLS bool `json:"startTls"`
+}
+
+// Recipients are the addresses notifications matching the match are emailed to
+type Recipients struct {
+	Match Match    `json:"match"`
+	To    []string `json:"to"`
+}
+
+// TLS holds the settings of the connections to a destination in any mode but cloudConnector
+type TLS struct {
+	CACertFile         string `json:"caCertFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// Match selects the notifications a route applies to. Empty fields match everything,
+// otherwise a notification must match one of the listed values of every non-empty field.
+type Match struct {
+	NotificationTypes []string `json:"notificationTypes"`
+	Severities        []string `json:"severities"`
+	AlertNumbers      []int    `json:"alertNumbers"`
+	Facilities        []string `json:"facilities"`
+	DeviceIDs         []string `json:"deviceIds"`
+}
+
+// Route sends the notifications it matches to one or more named destinations
+type Route struct {
+	Name         string   `json:"name"`
+	Match        Match    `json:"match"`
+	Destinations []string `json:"destinations"`
+}
+
+// Attributes are the properties of a notification routes are matched against
+type Attributes struct {
+	NotificationType string
+	Severity         string
+	AlertNumber      int
+	Facilities       []string
+	DeviceID         string
+}
+
+// Table is the set of routes and the destinations they send notifications to
+type Table struct {
+	destinations map[string]Destination
+	routes       []Route
+}
+
+// NewTable creates a routing table, checking that every route sends to destinations that exist
+func NewTable(destinations map[string]Destination, routes []Route) (*Table, error) {
+	table := &Table{
+		destinations: make(map[string]Destination, len(destinations)),
+		routes:       routes,
+	}
+	for name, destination := range destinations {
+		if destination.URL == "" {
+			return nil, errors.Errorf("destination %s has no url", name)
+		}
+		if destination.Mode != "" && !modes[destination.Mode] {
+			return nil, errors.Errorf("destination %s has unknown mode %s", name, destination.Mode)
+		}
+		if destination.Mode == ModeMQTT && (destination.MQTT.Topic == "" || destination.MQTT.QoS > 2) {
+			return nil, errors.Errorf("destination %s needs an mqtt topic and a qos of 0, 1 or 2", name)
+		}
+		if destination.Mode == ModeEmail && !destination.Email.valid() {
+			return nil, errors.Errorf("destination %s needs an email from address and recipients for every entry", name)
+		}
+		if err := validateAuth(destination); err != nil {
+			return nil, errors.Wrapf(err, "destination %s", name)
+		}
+		if (destination.TLS.CertFile == "") != (destination.TLS.KeyFile == "") {
+			return nil, errors.Errorf("destination %s needs both a tls certFile and keyFile", name)
+		}
+		destination.Name = name
+		table.destinations[name] = destination
+	}
+
+	for i, route := range routes {
+		if len(route.Destinations) == 0 {
+			return nil, errors.Errorf("route %s has no destinations", routeName(route, i))
+		}
+		for _, name := range route.Destinations {
+			if _, found := table.destinations[name]; !found {
+				return nil, errors.Errorf("route %s sends to unknown destination %s", routeName(route, i), name)
+			}
+		}
+	}
+
+	return table, nil
+}
+
+// validateAuth checks the destination has the settings its authType needs
+func validateAuth(destination Destination) error {
+	authType := strings.ToLower(destination.AuthType)
+	if authType == "" {
+		return nil
+	}
+	if !authTypes[authType] {
+		return errors.Errorf("has unknown authType %s", destination.AuthType)
+	}
+	if authType == AuthBearer && destination.Token == "" {
+		return errors.New("needs a token for bearer auth")
+	}
+	if authType == AuthBasic && destination.ClientID == "" {
+		return errors.New("needs a clientId for basic auth")
+	}
+	if authType == AuthOAuth2 && (destination.AuthEndpoint == "" || destination.ClientID == "" || destination.ClientSecret == "") {
+		return errors.New("needs an authEndpoint, clientId and clientSecret for oauth2 auth")
+	}
+	return nil
+}
+
+// SetDefaultTable sets the routing table notifications are delivered with
+func SetDefaultTable(table *Table) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultTable = table
+}
+
+// DefaultTable returns the routing table notifications are delivered with, or nil if routing is not configured
+func DefaultTable() *Table {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+	return defaultTable
+}
+
+// Resolve returns the destinations of every route matching the notification, each destination once.
+// It returns no destinations when no route matches.
+func (table *Table) Resolve(attributes Attributes) []Destination {
+	var resolved []Destination
+	seen := make(map[string]bool)
+	for _, route := range table.routes {
+		if !route.Match.matches(attributes) {
+			continue
+		}
+		for _, name := range route.Destinations {
+			if !seen[name] {
+				seen[name] = true
+				resolved = append(resolved, table.destinations[name])
+			}
+		}
+	}
+	return resolved
+}
+
+// Destination returns the destination with the given name
+func (table *Table) Destination(name string) (Destination, bool) {
+	destination, found := table.destinations[name]
+	return destination, found
+}
+
+// Addresses returns the recipients of every entry matching the notification, each address once,
+// or the To addresses when no entry matches
+func (email Email) Addresses(attributes Attributes) []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, recipients := range email.Recipients {
+		if !recipients.Match.matches(attributes) {
+			continue
+		}
+		for _, address := range recipients.To {
+			if !seen[strings.ToLower(address)] {
+				seen[strings.ToLower(address)] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return email.To
+	}
+	return addresses
+}
+
+func (email Email) valid() bool {
+	if email.From == "" || (len(email.To) == 0 && len(email.Recipients) == 0) {
+		return false
+	}
+	for _, recipients := range email.Recipients {
+		if len(recipients.To) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (match Match) matches(attributes Attributes) bool {
+	if len(match.NotificationTypes) > 0 && !containsFold(match.NotificationTypes, attributes.NotificationType) {
+		return false
+	}
+	if len(match.Severities) > 0 && !containsFold(match.Severities, attributes.Severity) {
+		return false
+	}
+	if len(match.DeviceIDs) > 0 && !containsFold(match.DeviceIDs, attributes.DeviceID) {
+		return false
+	}
+	if len(match.AlertNumbers) > 0 {
+		found := false
+		for _, alertNumber := range match.AlertNumbers {
+			if alertNumber == attributes.AlertNumber {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(match.Facilities) > 0 {
+		found := false
+		for _, facility := range attributes.Facilities {
+			if containsFold(match.Facilities, facility) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeName(route Route, index int) string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return "#" + strconv.Itoa(index+1)
+}
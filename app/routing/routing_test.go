@@ -0,0 +1,119 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package routing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestTable(t *testing.T) *Table {
+	destinations := map[string]Destination{
+		"store-ops": {URL: "http://ops.example.com"},
+		"it":        {URL: "http://it.example.com", AuthType: "oauth2", AuthEndpoint: "http://it.example.com/token", ClientID: "it", ClientSecret: "secret"},
+	}
+	routes := []Route{
+		{Name: "gateways", Match: Match{AlertNumbers: []int{320, 321, 322}}, Destinations: []string{"it"}},
+		{Name: "urgent", Match: Match{NotificationTypes: []string{"Alert"}, Severities: []string{"critical", "urgent"}, Facilities: []string{"front"}}, Destinations: []string{"store-ops", "it"}},
+		{Name: "sensor", Match: Match{DeviceIDs: []string{"Sensor1"}}, Destinations: []string{"store-ops"}},
+	}
+	table, err := NewTable(destinations, routes)
+	if err != nil {
+		t.Fatalf("Unable to create routing table %s", err)
+	}
+	return table
+}
+
+func TestResolve(t *testing.T) {
+	table := newTestTable(t)
+
+	tests := []struct {
+		name       string
+		attributes Attributes
+		expected   []string
+	}{
+		{"no match", Attributes{NotificationType: "Alert", Severity: "info", AlertNumber: 22, Facilities: []string{"front"}}, nil},
+		{"alert number", Attributes{NotificationType: "Alert", Severity: "info", AlertNumber: 320}, []string{"it"}},
+		{"severity and facility", Attributes{NotificationType: "Alert", Severity: "Critical", AlertNumber: 22, Facilities: []string{"back", "front"}}, []string{"store-ops", "it"}},
+		{"other facility", Attributes{NotificationType: "Alert", Severity: "critical", AlertNumber: 22, Facilities: []string{"back"}}, nil},
+		{"heartbeat", Attributes{NotificationType: "Heartbeat", Severity: "critical", Facilities: []string{"front"}}, nil},
+		{"fan out without duplicates", Attributes{NotificationType: "Alert", Severity: "urgent", AlertNumber: 322, Facilities: []string{"front"}, DeviceID: "Sensor1"}, []string{"it", "store-ops"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolved := table.Resolve(test.attributes)
+			if len(resolved) != len(test.expected) {
+				t.Fatalf("Expected destinations %v, got %v", test.expected, resolved)
+			}
+			for i, destination := range resolved {
+				if destination.Name != test.expected[i] {
+					t.Errorf("Expected destinations %v, got %v", test.expected, resolved)
+				}
+			}
+		})
+	}
+
+	if destination, found := table.Destination("it"); !found || destination.URL != "http://it.example.com" || destination.AuthType != "oauth2" {
+		t.Errorf("Unexpected destination %+v", destination)
+	}
+}
+
+func TestNewTableErrors(t *testing.T) {
+	if _, err := NewTable(map[string]Destination{"it": {}}, nil); err == nil {
+		t.Error("Expected error for destination without url")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "http://it.example.com", Mode: "sms"}}, nil); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "smtp://mail.example.com", Mode: ModeEmail, Email: Email{To: []string{"it@example.com"}}}}, nil); err == nil {
+		t.Error("Expected error for email without from address")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "http://it.example.com", AuthType: "kerberos"}}, nil); err == nil {
+		t.Error("Expected error for unknown authType")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "http://it.example.com", AuthType: "bearer"}}, nil); err == nil {
+		t.Error("Expected error for bearer auth without token")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "http://it.example.com", AuthType: "oauth2", ClientID: "it"}}, nil); err == nil {
+		t.Error("Expected error for oauth2 auth without auth endpoint and client secret")
+	}
+	if _, err := NewTable(map[string]Destination{"it": {URL: "http://it.example.com", TLS: TLS{CertFile: "cert.pem"}}}, nil); err == nil {
+		t.Error("Expected error for tls cert without key")
+	}
+	if _, err := NewTable(nil, []Route{{Name: "empty"}}); err == nil {
+		t.Error("Expected error for route without destinations")
+	}
+	if _, err := NewTable(nil, []Route{{Destinations: []string{"unknown"}}}); err == nil || err.Error() != "route #1 sends to unknown destination unknown" {
+		t.Errorf("Expected error for unknown destination, got %v", err)
+	}
+}
+
+func TestEmailAddresses(t *testing.T) {
+	email := Email{
+		From: "alerts@example.com",
+		To:   []string{"ops@example.com"},
+		Recipients: []Recipients{
+			{Match: Match{Facilities: []string{"front"}}, To: []string{"front@example.com", "ops@example.com"}},
+			{Match: Match{Severities: []string{"critical"}}, To: []string{"Ops@example.com", "manager@example.com"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		attributes Attributes
+		expected   []string
+	}{
+		{"no match", Attributes{Severity: "info", Facilities: []string{"back"}}, []string{"ops@example.com"}},
+		{"facility", Attributes{Severity: "info", Facilities: []string{"back", "front"}}, []string{"front@example.com", "ops@example.com"}},
+		{"facility and severity", Attributes{Severity: "critical", Facilities: []string{"front"}}, []string{"front@example.com", "ops@example.com", "manager@example.com"}},
+	}
+	for _, test := range tests {
+		if addresses := email.Addresses(test.attributes); !reflect.DeepEqual(addresses, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, addresses)
+		}
+	}
+}
@@ -3,6 +3,7 @@ module github.com/intel/rsp-sw-toolkit-im-suite-alert-service
 go 1.12
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/edgexfoundry/app-functions-sdk-go v0.0.0-20190709232209-37e756b47e0b
 	github.com/edgexfoundry/go-mod-core-contracts v0.1.5
 	github.com/go-stack/stack v1.8.0 // indirect
@@ -12,4 +13,5 @@ require (
 	github.com/pborman/uuid v1.2.0
 	github.com/pkg/errors v0.8.1
 	github.com/sirupsen/logrus v1.4.0
+	go.etcd.io/bbolt v1.3.5
 )
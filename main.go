@@ -18,9 +18,12 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/edgexfoundry/app-functions-sdk-go/appcontext"
@@ -28,18 +31,26 @@ import (
 	edgexModels "github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/asn"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/catalog"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/delivery"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/health"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/history"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/idempotency"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/prometheus"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routes"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/utils"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	reporter "github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics-influxdb"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
 )
 
-var gateway = models.GetInstanceGateway()
+var gateways = models.GetInstanceGatewayRegistry()
 
 const (
 	serviceKey = "alert-service"
@@ -53,6 +64,30 @@ const (
 // only Readings with these names are received.
 var readingFilter = []string{heartbeat, deviceAlert, asnData}
 
+// pipelineRunning is set while the EdgeX functions pipeline is running, for the readiness check
+var pipelineRunning int32
+
+// shuttingDown is set once a shutdown signal is received, after which EdgeX events are no longer processed
+var shuttingDown int32
+
+const (
+	// skuMappingCheckTimeout is how long the readiness check waits for the SKU mapping service to answer
+	skuMappingCheckTimeout = 5 * time.Second
+	// maxCloudConnectorFailures is the number of deliveries in a row that can fail before the service is not ready,
+	// as the delivery queue retries the occasional failed delivery
+	maxCloudConnectorFailures = 5
+)
+
+const (
+	// configSection is the section of the configuration the service reads its settings from first,
+	// named after the repository the service is built from
+	configSection = "rsp-sw-toolkit-im-suite-alert-service"
+	// secretConfigFile is the configuration file the service is deployed with
+	secretConfigFile = "/run/secrets/configuration.json"
+	// localConfigFile is the configuration file of the source tree, read when the service is run from it
+	localConfigFile = "app/config/configuration.json"
+)
+
 type reading struct {
 	Topic  string                 `json:"topic"`
 	Params map[string]interface{} `json:"params"`
@@ -74,41 +109,52 @@ func NewSkuMapping(url string) *SkuMapping {
 	}
 }
 
-func monitorHeartbeat(watchdogSeconds int, notificationChan chan alert.Notification) {
+// monitorHeartbeat checks the gateway heartbeats every watchdog interval until stop is closed.
+// A reloaded watchdogSeconds takes effect from the next check.
+func monitorHeartbeat(notificationChan chan alert.Notification, stop <-chan struct{}) {
 
 	for {
-		<-time.After(time.Duration(watchdogSeconds) * time.Second)
+		watchdogSeconds := config.Current().WatchdogSeconds
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Duration(watchdogSeconds) * time.Second):
+			checkGatewayHeartbeats(watchdogSeconds, notificationChan)
+		}
+	}
+}
+
+// checkGatewayHeartbeats counts a missed heartbeat against every registered gateway that has not
+// reported within the watchdog interval, deregistering it once the maximum is reached
+func checkGatewayHeartbeats(watchdogSeconds int, notificationChan chan alert.Notification) {
+	for _, gateway := range gateways.GetGateways() {
 		// we only care about Gateways that are currently registered and who have missed heartbeat
 		if gateway.GetRegistrationStatus() == models.Registered && time.Since(gateway.GetLastHeartbeatSeen()) > time.Duration(watchdogSeconds)*time.Second {
 			if gateway.UpdateMissedHeartBeats() {
-				if gateway.GetMissedHeartBeats() >= config.AppConfig.MaxMissedHeartbeats {
+				if gateway.GetMissedHeartBeats() >= config.Current().MaxMissedHeartbeats {
 					// Since we have missed the maximum amount of heartbeats, set this gateway to deregistered and send alert
 					if gateway.DeregisterGateway() {
 						gatewayDeregistered, gatewayID := models.GatewayDeregisteredAlert(gateway.GetLastHeartbeat())
-						log.Debug("Gateway Deregistered")
-						go func() {
-							notificationChan <- alert.Notification{
-								NotificationType:    alert.AlertType,
-								NotificationMessage: "Gateway Deregistered Alert",
-								Data:                gatewayDeregistered,
-								GatewayID:           gatewayID,
-								Endpoint:            config.AppConfig.AlertDestination,
-							}
-						}()
+						log.Debugf("Gateway %s Deregistered", gatewayID)
+						alert.Send(notificationChan, alert.Notification{
+							NotificationType:    alert.AlertType,
+							NotificationMessage: "Gateway Deregistered Alert",
+							Data:                gatewayDeregistered,
+							GatewayID:           gatewayID,
+							Endpoint:            config.Current().AlertDestination,
+						})
 					}
 				} else {
 					// send missed heartbeat alert
 					missedHeartbeat, gatewayID := models.GatewayMissedHeartbeatAlert(gateway.GetLastHeartbeat())
-					log.Debug("Missed heartbeat")
-					go func() {
-						notificationChan <- alert.Notification{
-							NotificationType:    alert.AlertType,
-							NotificationMessage: "Missed HeartBeat Alert",
-							Data:                missedHeartbeat,
-							GatewayID:           gatewayID,
-							Endpoint:            config.AppConfig.AlertDestination,
-						}
-					}()
+					log.Debugf("Gateway %s missed heartbeat", gatewayID)
+					alert.Send(notificationChan, alert.Notification{
+						NotificationType:    alert.AlertType,
+						NotificationMessage: "Missed HeartBeat Alert",
+						Data:                missedHeartbeat,
+						GatewayID:           gatewayID,
+						Endpoint:            config.Current().AlertDestination,
+					})
 				}
 			}
 		}
@@ -116,6 +162,7 @@ func monitorHeartbeat(watchdogSeconds int, notificationChan chan alert.Notificat
 }
 
 func updateGatewayStatus(hb models.Heartbeat, notificationChan chan alert.Notification) {
+	gateway := gateways.GetOrAddGateway(hb.DeviceID)
 	lastHeartbeatSeen := time.Now()
 	lastHeartbeat := hb
 	missedHeartBeats := 0
@@ -123,16 +170,15 @@ func updateGatewayStatus(hb models.Heartbeat, notificationChan chan alert.Notifi
 		if gateway.GetRegistrationStatus() == models.Pending || gateway.GetRegistrationStatus() == models.Deregistered {
 			if gateway.RegisterGateway() {
 				gatewayRegistered, gatewayID := models.GatewayRegisteredAlert(gateway.GetLastHeartbeat())
-				log.Debug("Gateway Registered")
-				go func() {
-					notificationChan <- alert.Notification{
-						NotificationType:    alert.AlertType,
-						NotificationMessage: "Gateway Registered Alert",
-						Data:                gatewayRegistered,
-						GatewayID:           gatewayID,
-						Endpoint:            config.AppConfig.AlertDestination,
-					}
-				}()
+				log.Debugf("Gateway %s Registered", gatewayID)
+				alert.ResolveGatewayDeregistered(gatewayID)
+				alert.Send(notificationChan, alert.Notification{
+					NotificationType:    alert.AlertType,
+					NotificationMessage: "Gateway Registered Alert",
+					Data:                gatewayRegistered,
+					GatewayID:           gatewayID,
+					Endpoint:            config.Current().AlertDestination,
+				})
 			}
 
 		}
@@ -161,15 +207,13 @@ func processHeartbeat(jsonBytes *[]byte, notificationChan chan alert.Notificatio
 	updateGatewayStatus(heartbeatEvent, notificationChan)
 
 	// Forward the heartbeat to the notification channel
-	go func() {
-		notificationChan <- alert.Notification{
-			NotificationMessage: "Process Heartbeat",
-			NotificationType:    models.HeartbeatType,
-			Data:                heartbeatEvent,
-			GatewayID:           heartbeatEvent.DeviceID,
-			Endpoint:            config.AppConfig.HeartbeatDestination,
-		}
-	}()
+	alert.Send(notificationChan, alert.Notification{
+		NotificationMessage: "Process Heartbeat",
+		NotificationType:    models.HeartbeatType,
+		Data:                heartbeatEvent,
+		GatewayID:           heartbeatEvent.DeviceID,
+		Endpoint:            config.Current().HeartbeatDestination,
+	})
 
 	log.Debug("Processed heartbeat")
 	mSuccess.Update(1)
@@ -199,8 +243,7 @@ func (skuMapping SkuMapping) processShippingNotice(jsonBytes *[]byte, notificati
 
 	var whitelistedProductIDs []string
 	var stringBytes bytes.Buffer
-	if len(oDataQuery) > config.AppConfig.BatchSizeMax {
-		var batchSize = config.AppConfig.BatchSizeMax
+	if batchSize := config.Current().BatchSizeMax; len(oDataQuery) > batchSize {
 		var start = 0
 		for start < len(oDataQuery) {
 			stringBytes.WriteString(strings.Join(oDataQuery[start:start+batchSize], " or "))
@@ -260,7 +303,7 @@ func (skuMapping SkuMapping) processShippingNotice(jsonBytes *[]byte, notificati
 		}
 
 		log.Errorf("Received asn with tags not whitelisted. %s", notWhitelisted)
-		if config.AppConfig.SendNotWhitelistedAlert {
+		if config.Current().SendNotWhitelistedAlert {
 			if processErr := alert.ProcessAlert(&alertBytes, notificationChan); processErr != nil {
 				log.WithFields(log.Fields{
 					"Method": "processShippingNotice",
@@ -375,6 +418,49 @@ func MakeGetCallToSkuMapping(stringBytes string, skuUrl string) ([]string, error
 	return productIDs, nil
 }
 
+// configFile returns the configuration file the service reads its settings from: the file in the runtimeConfigPath
+// environment variable, or else the file the service is deployed with, or else the file of the source tree
+func configFile() string {
+	if path, ok := os.LookupEnv("runtimeConfigPath"); ok {
+		return path
+	}
+	for _, path := range []string{secretConfigFile, localConfigFile} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// checkConfigRequested reports whether the service was started with --check-config. The flag is looked up
+// by hand, the EdgeX SDK parses the command line flags itself when it is initialized.
+func checkConfigRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--check-config" || arg == "-check-config" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfig prints every problem of the configuration, or that it is valid, and returns the exit code
+func checkConfig(err error) int {
+	if err == nil {
+		fmt.Println("Configuration is valid")
+		return 0
+	}
+	problems, ok := err.(config.Problems)
+	if !ok {
+		fmt.Println(err.Error())
+		return 1
+	}
+	fmt.Printf("Configuration is not valid, %d problems:\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  %s %s\n", problem.Setting, problem.Message)
+	}
+	return 1
+}
+
 func main() {
 
 	log.SetFormatter(&log.TextFormatter{
@@ -383,7 +469,11 @@ func main() {
 	})
 
 	// Load config variables
-	if err := config.InitConfig(); err != nil {
+	err := config.InitConfig(configSection, configFile())
+	if checkConfigRequested(os.Args[1:]) {
+		os.Exit(checkConfig(err))
+	}
+	if err != nil {
 		log.WithFields(log.Fields{
 			"Method": "config.InitConfig",
 			"Action": "Load config",
@@ -400,14 +490,55 @@ func main() {
 		"Action": "Start",
 	}).Info("Starting application...")
 
+	// Open the database used to persist alerts and queued notifications
+	db := initDatabase()
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.WithFields(log.Fields{
+				"Method": "main",
+				"Action": "close database",
+				"Error":  err.Error(),
+			}).Error("Error closing database")
+		}
+	}()
+
+	initRouting()
+	initCatalog()
+	config.SetReloadHandler(applyConfig)
+
 	// Initialize channel with set value in config
 	notificationChan := make(chan alert.Notification, config.AppConfig.NotificationChanSize)
+	// alerts sent through the API go through the same notifier
+	alert.SetDefaultChannel(notificationChan)
+	registerMetricsCollectors(notificationChan)
+	registerHealthChecks(notificationChan)
+
+	// Closing stop ends the watchdog, the deduplicator, the notifier and the delivery worker on shutdown
+	stop := make(chan struct{})
+	if config.AppConfig.DedupWindowSeconds > 0 {
+		deduplicator := alert.NewDeduplicator(time.Duration(config.AppConfig.DedupWindowSeconds) * time.Second)
+		alert.SetDefaultDeduplicator(deduplicator)
+		go deduplicator.Run(notificationChan, stop)
+	}
 	receiveZmqEvents(notificationChan)
-	go monitorHeartbeat(config.AppConfig.WatchdogSeconds, notificationChan)
-	go alert.NotifyChannel(notificationChan)
+	go monitorHeartbeat(notificationChan, stop)
+	go config.WatchFile(stop)
+	notifierDone := make(chan struct{})
+	go func() {
+		alert.NotifyChannelUntil(notificationChan, stop)
+		close(notifierDone)
+	}()
+	workerDone := make(chan struct{})
+	go func() {
+		alert.NewDeliveryWorker(delivery.DefaultQueue()).Run(stop)
+		close(workerDone)
+	}()
 
 	// Start Webserver
 	router := routes.NewRouter()
+	if len(config.AppConfig.APIKeys) == 0 && config.AppConfig.JWTSecret == "" {
+		log.Warn("No apiKeys or jwtSecret configured, the HTTP API is open to every caller")
+	}
 
 	// Create a new server and set timeout values.
 	server := http.Server{
@@ -429,15 +560,21 @@ func main() {
 		wg.Done()
 	}()
 
-	// Listen for an interrupt signal from the OS.
+	// Listen for an interrupt or terminate signal from the OS.
 	osSignals := make(chan os.Signal, 1)
-	signal.Notify(osSignals, os.Interrupt)
+	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
 
-	// Wait for a signal to shutdown.
-	<-osSignals
+	// Wait for a signal to shutdown, then stop processing EdgeX events.
+	received := <-osSignals
+	atomic.StoreInt32(&shuttingDown, 1)
+	log.WithFields(log.Fields{
+		"Method": "main",
+		"Action": "shutdown",
+		"Signal": received.String(),
+	}).Info("Shutting down")
 
-	// Create a context to attempt a graceful 5 second shutdown.
-	const timeout = 5 * time.Second
+	// Create a context to attempt a graceful shutdown within the configured time.
+	timeout := time.Duration(config.Current().ShutdownTimeoutSeconds) * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -463,9 +600,54 @@ func main() {
 
 	// Wait for the listener to report it is closed.
 	wg.Wait()
+
+	// With nothing left to receive notifications from, flush the ones still in the channel.
+	flushed, dropped := drainNotifications(ctx, notificationChan, stop, notifierDone, workerDone)
+	drainLog := log.WithFields(log.Fields{
+		"Method":  "main",
+		"Action":  "shutdown",
+		"Flushed": flushed,
+		"Dropped": dropped,
+	})
+	if dropped > 0 {
+		drainLog.Warnf("Notification channel not drained within %s", timeout)
+	} else {
+		drainLog.Info("Drained notification channel")
+	}
+
 	log.WithField("Method", "main").Info("Completed.")
 }
 
+// drainNotifications closes stop and, once the notifier has returned, queues the notifications left in the channel,
+// or sends them when there is no delivery queue, until the context is done. It then waits for the delivery worker
+// to finish its current delivery, so the database is not closed under it, and returns the flushed and dropped counts.
+func drainNotifications(ctx context.Context, notificationChan chan alert.Notification, stop chan struct{},
+	notifierDone <-chan struct{}, workerDone <-chan struct{}) (int, int) {
+	close(stop)
+
+	select {
+	case <-notifierDone:
+	case <-ctx.Done():
+		return 0, len(notificationChan) + alert.WaitingSends()
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now()
+	}
+	flushed, dropped := alert.Drain(notificationChan, deadline)
+
+	select {
+	case <-workerDone:
+	case <-ctx.Done():
+		log.WithFields(log.Fields{
+			"Method": "drainNotifications",
+			"Action": "shutdown",
+		}).Warn("Delivery worker did not stop in time")
+	}
+	return flushed, dropped
+}
+
 func initMetrics() {
 	// setup metrics reporting
 	if config.AppConfig.TelemetryEndpoint != "" {
@@ -481,6 +663,235 @@ func initMetrics() {
 	}
 }
 
+// registerMetricsCollectors adds the notification channel and delivery queue depths and the status of every gateway
+// to the Prometheus metrics
+func registerMetricsCollectors(notificationChan chan alert.Notification) {
+	prometheus.RegisterCollector(func() []prometheus.Sample {
+		samples := []prometheus.Sample{
+			{Name: "NotificationChannel.Depth", Help: "Notifications waiting in the notification channel", Value: float64(len(notificationChan))},
+			{Name: "NotificationChannel.Size", Help: "Capacity of the notification channel", Value: float64(cap(notificationChan))},
+		}
+		if queue := delivery.DefaultQueue(); queue != nil {
+			samples = append(samples, prometheus.Sample{Name: "Delivery.Queue.Depth", Help: "Notifications waiting in the delivery queue", Value: float64(queue.Depth())})
+		}
+		return samples
+	})
+
+	prometheus.RegisterCollector(func() []prometheus.Sample {
+		var samples []prometheus.Sample
+		for _, gateway := range gateways.GetGateways() {
+			info := gateway.GetGatewayInfo()
+			for _, status := range []models.Status{models.Pending, models.Registered, models.Deregistered} {
+				value := 0.0
+				if info.RegistrationStatus == status.String() {
+					value = 1
+				}
+				samples = append(samples, prometheus.Sample{
+					Name:   "Gateway.Status",
+					Help:   "Registration status of each gateway, 1 for its current status",
+					Labels: map[string]string{"gateway": info.DeviceID, "status": status.String()},
+					Value:  value,
+				})
+			}
+			samples = append(samples, prometheus.Sample{
+				Name:   "Gateway.Missed-Heartbeats",
+				Help:   "Heartbeats each gateway has missed in a row",
+				Labels: map[string]string{"gateway": info.DeviceID},
+				Value:  float64(info.MissedHeartBeats),
+			})
+		}
+		return samples
+	})
+}
+
+// registerHealthChecks adds the checks of the EdgeX pipeline, the notification channel, the cloud connector
+// and the SKU mapping service to the readiness report
+func registerHealthChecks(notificationChan chan alert.Notification) {
+	health.RegisterCheck("edgexPipeline", func() health.Result {
+		if atomic.LoadInt32(&pipelineRunning) == 0 {
+			return health.Down(errors.New("EdgeX functions pipeline is not running"), nil)
+		}
+		return health.Up(nil)
+	})
+
+	health.RegisterCheck("notificationChannel", func() health.Result {
+		detail := map[string]int{"depth": len(notificationChan), "size": cap(notificationChan)}
+		if len(notificationChan) >= cap(notificationChan) {
+			return health.Down(errors.New("notification channel is full"), detail)
+		}
+		return health.Up(detail)
+	})
+
+	health.RegisterCheck("cloudConnector", func() health.Result {
+		last, found := alert.LastCloudConnectorDelivery()
+		if !found {
+			return health.Up("no deliveries yet")
+		}
+		if last.ConsecutiveFailures >= maxCloudConnectorFailures {
+			return health.Down(errors.Errorf("last %d deliveries failed: %s", last.ConsecutiveFailures, last.Error), last)
+		}
+		return health.Up(last)
+	})
+
+	registerSkuMappingCheck(config.AppConfig.SendNotWhitelistedAlert)
+}
+
+// registerSkuMappingCheck adds the SKU mapping service to the readiness checks while it is used to send not whitelisted
+// alerts, and removes it otherwise
+func registerSkuMappingCheck(sendNotWhitelistedAlert bool) {
+	if !sendNotWhitelistedAlert {
+		health.UnregisterCheck("skuMapping")
+		return
+	}
+	health.RegisterCheck("skuMapping", func() health.Result {
+		skuMappingURL := config.Current().MappingSkuURL
+		detail := map[string]interface{}{"url": skuMappingURL}
+		client := &http.Client{Timeout: skuMappingCheckTimeout}
+		response, err := client.Get(skuMappingURL)
+		if err != nil {
+			return health.Down(errors.Wrap(err, "SKU mapping service is unreachable"), detail)
+		}
+		_ = response.Body.Close()
+		detail["statusCode"] = response.StatusCode
+		return health.Up(detail)
+	})
+}
+
+// initRouting loads the routing table from the configuration, if there is one
+func initRouting() {
+	table, err := newRoutingTable(config.AppConfig)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initRouting",
+			"Action": "Create routing table",
+		}).Fatal(err.Error())
+	}
+	if table == nil {
+		return
+	}
+	routing.SetDefaultTable(table)
+	log.Infof("Routing notifications with %d routes to %d destinations", len(config.AppConfig.Routes), len(config.AppConfig.Destinations))
+}
+
+// initCatalog adds the alert types of the configuration to the alert catalog
+func initCatalog() {
+	alertCatalog, err := catalog.New(config.AppConfig.AlertTypes)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initCatalog",
+			"Action": "Create alert catalog",
+		}).Fatal(err.Error())
+	}
+	catalog.SetDefault(alertCatalog)
+}
+
+// newRoutingTable creates the routing table of the configuration, or returns nil when it has no destinations and routes
+func newRoutingTable(settings config.Variables) (*routing.Table, error) {
+	if len(settings.Destinations) == 0 && len(settings.Routes) == 0 {
+		return nil, nil
+	}
+	return routing.NewTable(settings.Destinations, settings.Routes)
+}
+
+// applyConfig applies a reloaded configuration to the routing table, the delivery clients, the alert catalog and the
+// logging level. The watchdog reads its settings as it runs. Nothing is applied when the routing table or the alert
+// catalog of the configuration is not valid.
+func applyConfig(previous config.Variables, next config.Variables) error {
+	var alertCatalog *catalog.Catalog
+	if !reflect.DeepEqual(previous.AlertTypes, next.AlertTypes) {
+		var err error
+		if alertCatalog, err = catalog.New(next.AlertTypes); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(previous.Destinations, next.Destinations) || !reflect.DeepEqual(previous.Routes, next.Routes) {
+		table, err := newRoutingTable(next)
+		if err != nil {
+			return err
+		}
+		routing.SetDefaultTable(table)
+		log.Infof("Routing notifications with %d routes to %d destinations", len(next.Routes), len(next.Destinations))
+
+		// the clients keep the tls settings and connections of the destinations they were created for
+		alert.ResetWebhookClients()
+		alert.ResetMQTTClients()
+	}
+	if alertCatalog != nil {
+		catalog.SetDefault(alertCatalog)
+		log.Infof("Alert catalog has %d alert types", len(alertCatalog.Types()))
+	}
+	if previous.LoggingLevel != next.LoggingLevel {
+		setLoggingLevel(next.LoggingLevel)
+	}
+	if previous.SendNotWhitelistedAlert != next.SendNotWhitelistedAlert {
+		registerSkuMappingCheck(next.SendNotWhitelistedAlert)
+	}
+	if historyStore := history.DefaultStore(); historyStore != nil && historyRetention(previous) != historyRetention(next) {
+		historyStore.SetRetention(historyRetention(next))
+	}
+	return nil
+}
+
+// historyRetention is the retention of the alert history set in the settings
+func historyRetention(settings config.Variables) history.Retention {
+	return history.Retention{
+		MaxAge:     time.Duration(settings.AlertHistoryMaxAgeDays) * 24 * time.Hour,
+		MaxRecords: settings.AlertHistoryMaxRecords,
+	}
+}
+
+func initDatabase() *bolt.DB {
+	db, err := bolt.Open(config.AppConfig.DatabasePath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initDatabase",
+			"Action": "Open database " + config.AppConfig.DatabasePath,
+		}).Fatal(err.Error())
+	}
+
+	historyStore, err := history.NewStore(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initDatabase",
+			"Action": "Create alert history store",
+		}).Fatal(err.Error())
+	}
+	historyStore.SetRetention(historyRetention(config.AppConfig))
+	history.SetDefaultStore(historyStore)
+
+	queue, err := delivery.NewQueue(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initDatabase",
+			"Action": "Create delivery queue",
+		}).Fatal(err.Error())
+	}
+	if depth := queue.Depth(); depth > 0 {
+		log.Infof("Resuming delivery of %d queued notifications", depth)
+	}
+	delivery.SetDefaultQueue(queue)
+
+	deadLetters, err := delivery.NewDeadLetters(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initDatabase",
+			"Action": "Create dead letter store",
+		}).Fatal(err.Error())
+	}
+	delivery.SetDefaultDeadLetters(deadLetters)
+
+	idempotencyStore, err := idempotency.NewStore(db)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "initDatabase",
+			"Action": "Create idempotency key store",
+		}).Fatal(err.Error())
+	}
+	idempotency.SetDefaultStore(idempotencyStore)
+
+	return db
+}
+
 func errorHandler(message string, err error, errorGauge *metrics.Gauge) {
 	if err != nil {
 		(*errorGauge).Update(1)
@@ -513,7 +924,9 @@ func receiveZmqEvents(notificationChan chan alert.Notification) {
 			os.Exit(-1)
 		}
 
+		atomic.StoreInt32(&pipelineRunning, 1)
 		err = edgexSdk.MakeItRun()
+		atomic.StoreInt32(&pipelineRunning, 0)
 		if err != nil {
 			edgexSdk.LoggingClient.Error("MakeItRun returned error: ", err.Error())
 			os.Exit(-1)
@@ -526,6 +939,11 @@ func (chann notificationChannel) processEvents(edgexcontext *appcontext.Context,
 
 	mRRSProcessShippingNoticeError := metrics.GetOrRegisterGauge("Alert.ProcessShippingNoticeError", nil)
 
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		log.Debug("Shutting down, ignoring EdgeX event")
+		return false, nil
+	}
+
 	if len(params) < 1 {
 		return false, nil
 	}
@@ -545,7 +963,8 @@ func (chann notificationChannel) processEvents(edgexcontext *appcontext.Context,
 			errorHandler("error decoding shipping notice data", err, &mRRSProcessShippingNoticeError)
 			return false, nil
 		}
-		skuMapping := NewSkuMapping(config.AppConfig.MappingSkuURL + config.AppConfig.MappingSkuEndpoint)
+		settings := config.Current()
+		skuMapping := NewSkuMapping(settings.MappingSkuURL + settings.MappingSkuEndpoint)
 		if err := skuMapping.processShippingNotice(&data, chann.channel); err != nil {
 			errorHandler("error processing shipping notice data", err, &mRRSProcessShippingNoticeError)
 			return false, nil
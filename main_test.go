@@ -7,23 +7,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	edgex "github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/alert"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/health"
 	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/models"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/prometheus"
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/app/routing"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	log "github.com/sirupsen/logrus"
 )
 
 func TestMain(m *testing.M) {
-	if err := config.InitConfig(); err != nil {
+	if err := config.InitConfig(configSection, localConfigFile); err != nil {
 		log.WithFields(log.Fields{
 			"Method": "config.InitConfig",
 			"Action": "Load config",
@@ -43,20 +50,39 @@ func TestProcessHeartbeat(t *testing.T) {
 	go alert.NotifyChannel(notificationChan)
 }
 
+// changeConfig changes the current configuration, returning the function that restores it
+func changeConfig(change func(settings *config.Variables)) func() {
+	previous := config.Current()
+	settings := previous
+	change(&settings)
+	config.Set(settings)
+	return func() {
+		config.Set(previous)
+	}
+}
+
 func TestGatewayStatus(t *testing.T) {
 	notificationChan := make(chan alert.Notification, config.AppConfig.NotificationChanSize)
-	watchdogSeconds := 1
+	defer changeConfig(func(settings *config.Variables) {
+		settings.WatchdogSeconds = 1
+	})()
 	//Starting gateway status check in separate goroutine
-	go monitorHeartbeat(watchdogSeconds, notificationChan)
+	stop := make(chan struct{})
+	defer close(stop)
+	go monitorHeartbeat(notificationChan, stop)
 	missedHeartBeats := config.AppConfig.MaxMissedHeartbeats
 
 	// check for gateway registered alert
-	inputData := mockGenerateHeartbeat()
+	inputData := mockGenerateHeartbeatParams("rrpgw")
 	heartBeatError := processHeartbeat(&inputData, notificationChan)
 	if heartBeatError != nil {
 		t.Errorf("Error processing heartbeat %s", heartBeatError)
 	}
-	if gateway.RegistrationStatus != models.Registered {
+	gateway, ok := gateways.GetGateway("rrpgw")
+	if !ok {
+		t.Fatal("Gateway was not added to the registry")
+	}
+	if gateway.GetRegistrationStatus() != models.Registered {
 		t.Error("Failed to register gateway")
 	}
 
@@ -68,20 +94,237 @@ func TestGatewayStatus(t *testing.T) {
 		}
 		time.Sleep(2 * time.Second)
 	}
-	// looping through notification channel to make sure we get Gateway deregistered alert before checking for error conditions
-	for noti := range notificationChan {
-		if noti.NotificationMessage == "Gateway Deregistered Alert" {
-			break
-		}
-	}
-	if gateway.MissedHeartBeats != missedHeartBeats {
+	// waiting on the notification channel to make sure we get Gateway deregistered alert before checking for error conditions
+	awaitNotification(t, notificationChan, func(noti alert.Notification) bool {
+		return noti.NotificationMessage == "Gateway Deregistered Alert" && noti.GatewayID == "rrpgw"
+	})
+	if gateway.GetMissedHeartBeats() != missedHeartBeats {
 		t.Error("Failed to register missed heartbeats")
 	}
-	if gateway.RegistrationStatus != models.Deregistered {
+	if gateway.GetRegistrationStatus() != models.Deregistered {
 		t.Error("Failed to deregister gateway")
 	}
 }
 
+func TestMonitorHeartbeatStops(t *testing.T) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		monitorHeartbeat(make(chan alert.Notification), stop)
+		close(stopped)
+	}()
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the heartbeat watchdog to return once stopped")
+	}
+}
+
+func TestDrainNotifications(t *testing.T) {
+	notificationChan := make(chan alert.Notification, 10)
+	for i := 0; i < 3; i++ {
+		// without an endpoint the notifications are recorded as not sent, with nothing to deliver
+		notificationChan <- alert.Notification{NotificationType: alert.AlertType, NotificationMessage: "Process Alert", Data: models.Alert{AlertNumber: i}}
+	}
+
+	// the notifier has not returned by the deadline, so nothing can be flushed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stop := make(chan struct{})
+	if flushed, dropped := drainNotifications(ctx, notificationChan, stop, make(chan struct{}), make(chan struct{})); flushed != 0 || dropped != 3 {
+		t.Errorf("Expected every notification to be dropped, got %d flushed and %d dropped", flushed, dropped)
+	}
+	select {
+	case <-stop:
+	default:
+		t.Error("Expected stop to be closed")
+	}
+
+	done := make(chan struct{})
+	close(done)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if flushed, dropped := drainNotifications(ctx, notificationChan, make(chan struct{}), done, done); flushed != 3 || dropped != 0 {
+		t.Errorf("Expected every notification to be flushed, got %d flushed and %d dropped", flushed, dropped)
+	}
+}
+
+func TestMetricsCollectors(t *testing.T) {
+	notificationChan := make(chan alert.Notification, 10)
+	notificationChan <- alert.Notification{}
+	inputData := mockGenerateHeartbeatParams("metricsgw")
+	if err := processHeartbeat(&inputData, make(chan alert.Notification, 10)); err != nil {
+		t.Fatalf("Error processing heartbeat %s", err)
+	}
+
+	registerMetricsCollectors(notificationChan)
+	var exposition bytes.Buffer
+	if err := prometheus.Write(&exposition, metrics.NewRegistry()); err != nil {
+		t.Fatalf("Error writing metrics %s", err)
+	}
+
+	for _, expected := range []string{
+		"\nalert_service_notification_channel_depth 1\n",
+		"\nalert_service_notification_channel_size 10\n",
+		"\nalert_service_gateway_status{gateway=\"metricsgw\",status=\"registered\"} 1\n",
+		"\nalert_service_gateway_status{gateway=\"metricsgw\",status=\"pending\"} 0\n",
+		"\nalert_service_gateway_missed_heartbeats{gateway=\"metricsgw\"} 0\n",
+	} {
+		if !strings.Contains(exposition.String(), expected) {
+			t.Errorf("Expected metrics to contain %q, got\n%s", expected, exposition.String())
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer routing.SetDefaultTable(nil)
+	previous := config.Variables{LoggingLevel: "info"}
+
+	next := previous
+	next.Destinations = map[string]routing.Destination{"ops": {URL: "http://ops.example.com"}}
+	next.Routes = []routing.Route{{Name: "critical", Match: routing.Match{Severities: []string{"critical"}}, Destinations: []string{"ops"}}}
+	if err := applyConfig(previous, next); err != nil {
+		t.Fatalf("Unable to apply configuration %s", err)
+	}
+	if _, found := routing.DefaultTable().Destination("ops"); !found {
+		t.Fatal("Expected the reloaded routing table to be used")
+	}
+
+	// an invalid routing table leaves the current one in place
+	invalid := next
+	invalid.Routes = []routing.Route{{Name: "critical", Destinations: []string{"unknown"}}}
+	if err := applyConfig(next, invalid); err == nil {
+		t.Fatal("Expected an error for a route to an unknown destination")
+	}
+	if _, found := routing.DefaultTable().Destination("ops"); !found {
+		t.Error("Expected the routing table to be kept")
+	}
+
+	if err := applyConfig(next, previous); err != nil {
+		t.Fatalf("Unable to apply configuration %s", err)
+	}
+	if routing.DefaultTable() != nil {
+		t.Error("Expected routing to be turned off without destinations and routes")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	if !checkConfigRequested([]string{"-r", "--check-config"}) || checkConfigRequested([]string{"-r"}) {
+		t.Error("Expected --check-config to be found among the arguments")
+	}
+	if code := checkConfig(nil); code != 0 {
+		t.Errorf("Expected exit code 0 for a valid configuration, got %d", code)
+	}
+	problems := config.Problems{{Setting: "port", Message: "is required"}}
+	if code := checkConfig(problems); code != 1 {
+		t.Errorf("Expected exit code 1 for an invalid configuration, got %d", code)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	defer changeConfig(func(settings *config.Variables) {
+		settings.MappingSkuURL = server.URL
+	})()
+
+	notificationChan := make(chan alert.Notification, 1)
+	changeConfig(func(settings *config.Variables) {
+		settings.SendNotWhitelistedAlert = false
+	})
+	registerHealthChecks(notificationChan)
+	if _, found := health.Ready().Checks["skuMapping"]; found {
+		t.Error("Expected no SKU mapping check while not whitelisted alerts are not sent")
+	}
+
+	changeConfig(func(settings *config.Variables) {
+		settings.SendNotWhitelistedAlert = true
+	})
+	registerHealthChecks(notificationChan)
+
+	report := health.Ready()
+	if report.Status != health.StatusDown || report.Checks["edgexPipeline"].Status != health.StatusDown {
+		t.Errorf("Expected not ready without the EdgeX pipeline, got %+v", report)
+	}
+	if report.Checks["notificationChannel"].Status != health.StatusUp || report.Checks["skuMapping"].Status != health.StatusUp {
+		t.Errorf("Expected the notification channel and SKU mapping checks to pass, got %+v", report)
+	}
+
+	notificationChan <- alert.Notification{}
+	server.Close()
+	report = health.Ready()
+	if report.Checks["notificationChannel"].Status != health.StatusDown {
+		t.Errorf("Expected the full notification channel check to fail, got %+v", report.Checks["notificationChannel"])
+	}
+	if report.Checks["skuMapping"].Status != health.StatusDown {
+		t.Errorf("Expected the unreachable SKU mapping check to fail, got %+v", report.Checks["skuMapping"])
+	}
+}
+
+func TestMultipleGatewayStatus(t *testing.T) {
+	notificationChan := make(chan alert.Notification, config.AppConfig.NotificationChanSize)
+	watchdogSeconds := 60
+
+	for _, deviceID := range []string{"rrpgw-a", "rrpgw-b"} {
+		inputData := mockGenerateHeartbeatParams(deviceID)
+		if heartBeatError := processHeartbeat(&inputData, notificationChan); heartBeatError != nil {
+			t.Fatalf("Error processing heartbeat %s", heartBeatError)
+		}
+	}
+
+	gatewayA, okA := gateways.GetGateway("rrpgw-a")
+	gatewayB, okB := gateways.GetGateway("rrpgw-b")
+	if !okA || !okB {
+		t.Fatal("Expected both gateways to be added to the registry")
+	}
+	if gatewayA.GetRegistrationStatus() != models.Registered || gatewayB.GetRegistrationStatus() != models.Registered {
+		t.Fatal("Expected both gateways to be registered")
+	}
+
+	// only gateway a goes quiet
+	staleTime := time.Now().Add(-2 * time.Duration(watchdogSeconds) * time.Second)
+	gatewayA.UpdateGatewayStatus(staleTime, 0, gatewayA.GetLastHeartbeat())
+	checkGatewayHeartbeats(watchdogSeconds, notificationChan)
+
+	if gatewayA.GetMissedHeartBeats() != 1 {
+		t.Errorf("Expected gateway a to have 1 missed heartbeat, got %d", gatewayA.GetMissedHeartBeats())
+	}
+	if gatewayB.GetMissedHeartBeats() != 0 {
+		t.Errorf("Expected gateway b to have no missed heartbeats, got %d", gatewayB.GetMissedHeartBeats())
+	}
+	if gatewayB.GetRegistrationStatus() != models.Registered {
+		t.Error("Gateway b should not be affected by gateway a missing heartbeats")
+	}
+
+	noti := awaitNotification(t, notificationChan, func(noti alert.Notification) bool {
+		return noti.NotificationMessage == "Missed HeartBeat Alert"
+	})
+	if noti.GatewayID != "rrpgw-a" {
+		t.Errorf("Expected missed heartbeat alert for rrpgw-a, got %s", noti.GatewayID)
+	}
+}
+
+// awaitNotification receives from notificationChan until match accepts a notification,
+// failing the test instead of hanging when none arrives in time
+func awaitNotification(t *testing.T, notificationChan chan alert.Notification, match func(alert.Notification) bool) alert.Notification {
+	t.Helper()
+	timeout := time.After(30 * time.Second)
+	for {
+		select {
+		case noti := <-notificationChan:
+			if match(noti) {
+				return noti
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the expected notification")
+			return alert.Notification{}
+		}
+	}
+}
+
 func TestHeartbeatAlert(t *testing.T) {
 	input := mockGenerateHeartbeat()
 	heartbeat, err := generateHeartbeatModel(input)
@@ -278,7 +521,9 @@ func TestProcessShippingNoticeGTINMaxs(t *testing.T) {
 	defer testServer.Close()
 
 	skuMapping := NewSkuMapping(testServer.URL + "/skus")
-	config.AppConfig.BatchSizeMax = 1
+	changeConfig(func(settings *config.Variables) {
+		settings.BatchSizeMax = 1
+	})
 	inputData := mockGenerateShippingNoticeGTINs()
 	shippingError := skuMapping.processShippingNotice(&inputData, notificationChan)
 	if shippingError != nil {
@@ -295,7 +540,9 @@ func TestProcessShippingNoticeGTINMaxsBadRequest(t *testing.T) {
 	defer testServer.Close()
 
 	skuMapping := NewSkuMapping(testServer.URL + "/skus")
-	config.AppConfig.BatchSizeMax = 1
+	changeConfig(func(settings *config.Variables) {
+		settings.BatchSizeMax = 1
+	})
 	inputData := mockGenerateShippingNoticeGTINs()
 	notificationChan := make(chan alert.Notification, config.AppConfig.NotificationChanSize)
 	shippingError := skuMapping.processShippingNotice(&inputData, notificationChan)
@@ -366,6 +613,25 @@ func mockGenerateHeartbeat() []byte {
 	return heartbeat
 }
 
+// heartbeat as it is received in the params of a controller_heartbeat reading
+func mockGenerateHeartbeatParams(deviceID string) []byte {
+	heartbeat := []byte(`{
+		"device_id": "` + deviceID + `",
+		"facilities": [
+			"facility1",
+			"facility2"
+		],
+		"facility_groups_cfg": "auto-0802233641",
+		"mesh_id": null,
+		"mesh_node_id": null,
+		"personality_groups_cfg": null,
+		"schedule_cfg": "UNKNOWN",
+		"schedule_groups_cfg": null,
+		"sent_on": 1503700192960
+	}`)
+	return heartbeat
+}
+
 func mockGenerateEmptyShippingNoticeWRINs() []byte {
 	shippingNotice := []byte(`[]`)
 	return shippingNotice
@@ -0,0 +1,187 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Role is the access a caller has to the API
+type Role string
+
+const (
+	// RolePublic routes need no credentials
+	RolePublic Role = ""
+	// RoleReadOnly callers can read alerts, gateways, dead letters and metrics
+	RoleReadOnly Role = "read-only"
+	// RoleAdmin callers can also send alerts and change the state of the service
+	RoleAdmin Role = "admin"
+
+	// APIKeyHeader is the header callers send their API key in
+	APIKeyHeader = "X-API-Key"
+)
+
+// rank orders the roles, a role is allowed on the routes that require its rank or lower
+var rank = map[Role]int{
+	RolePublic:   0,
+	RoleReadOnly: 1,
+	RoleAdmin:    2,
+}
+
+// ValidRole reports whether callers can be given the role
+func ValidRole(role Role) bool {
+	return role == RoleReadOnly || role == RoleAdmin
+}
+
+// APIKey is a key a caller authenticates with, and the role it gives
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role Role   `json:"role"`
+}
+
+// Credentials are what callers can authenticate with
+type Credentials struct {
+	APIKeys []APIKey
+	// JWTSecret verifies HS256 JSON web tokens sent as bearer tokens, whose role claim gives the role
+	JWTSecret []byte
+}
+
+// enabled reports whether callers have to authenticate at all
+func (credentials Credentials) enabled() bool {
+	return len(credentials.APIKeys) > 0 || len(credentials.JWTSecret) > 0
+}
+
+// Auth middleware lets the request through when the caller authenticates with an API key in the X-API-Key
+// header or a JSON web token in the Authorization header whose role allows the required role. It answers
+// 401 without valid credentials and 403 when the role is not enough. The credentials are read on every
+// request, so they can be reloaded, and every request is let through while there are none.
+func Auth(credentials func() Credentials, required Role) web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+			if required == RolePublic {
+				return next(ctx, writer, request)
+			}
+			current := credentials()
+			if !current.enabled() {
+				return next(ctx, writer, request)
+			}
+
+			principal, role, err := authenticate(current, request)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Method":     request.Method,
+					"RequestURI": request.RequestURI,
+					"Error":      err.Error(),
+				}).Debug("Authentication failed")
+				return errors.Wrap(web.ErrNotAuthorized, "valid API key or token required")
+			}
+			if rank[role] < rank[required] {
+				return errors.Wrapf(web.ErrForbidden, "%s role required", required)
+			}
+
+			ctx.Value(web.KeyValues).(*web.ContextValues).Principal = principal
+			return next(ctx, writer, request)
+		})
+	}
+}
+
+// authenticate returns the name and role of the API key or token of the request
+func authenticate(credentials Credentials, request *http.Request) (string, Role, error) {
+	if key := request.Header.Get(APIKeyHeader); key != "" {
+		for _, apiKey := range credentials.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey.Key)) == 1 {
+				return apiKey.Name, apiKey.Role, nil
+			}
+		}
+		return "", "", errors.New("unknown API key")
+	}
+
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) > len("Bearer ") && strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		if len(credentials.JWTSecret) == 0 {
+			return "", "", errors.New("tokens are not accepted")
+		}
+		claims, err := verifyJWT(authorization[len("Bearer "):], credentials.JWTSecret, time.Now())
+		if err != nil {
+			return "", "", err
+		}
+		return claims.Subject, claims.Role, nil
+	}
+	return "", "", errors.New("no credentials")
+}
+
+// claims are the claims of a JSON web token used by the service
+type claims struct {
+	Subject   string `json:"sub"`
+	Role      Role   `json:"role"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// verifyJWT checks the HS256 signature and the expiry of the token and returns its claims
+func verifyJWT(token string, secret []byte, now time.Time) (claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims{}, errors.New("token is not a JSON web token")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return claims{}, errors.Wrap(err, "unable to read token header")
+	}
+	if header.Algorithm != "HS256" {
+		return claims{}, errors.Errorf("token algorithm %s is not HS256", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims{}, errors.Wrap(err, "unable to read token signature")
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims{}, errors.New("token signature is invalid")
+	}
+
+	var tokenClaims claims
+	if err := decodeJWTPart(parts[1], &tokenClaims); err != nil {
+		return claims{}, errors.Wrap(err, "unable to read token claims")
+	}
+	if tokenClaims.ExpiresAt == 0 || now.Unix() >= tokenClaims.ExpiresAt {
+		return claims{}, errors.New("token has expired or has no expiry")
+	}
+	if tokenClaims.NotBefore != 0 && now.Unix() < tokenClaims.NotBefore {
+		return claims{}, errors.New("token is not valid yet")
+	}
+	if !ValidRole(tokenClaims.Role) {
+		return claims{}, errors.Errorf("token role %q is not read-only or admin", tokenClaims.Role)
+	}
+	return tokenClaims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
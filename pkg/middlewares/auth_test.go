@@ -0,0 +1,103 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newToken(t *testing.T, algorithm string, secret []byte, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Unable to marshal token %s", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": algorithm, "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuth(t *testing.T) {
+	credentials := Credentials{
+		APIKeys: []APIKey{
+			{Name: "dashboard", Key: "read-key", Role: RoleReadOnly},
+			{Name: "operator", Key: "admin-key", Role: RoleAdmin},
+		},
+		JWTSecret: testSecret,
+	}
+	var principal string
+	handler := func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		principal = ctx.Value(web.KeyValues).(*web.ContextValues).Principal
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+	expiry := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name      string
+		required  Role
+		header    string
+		value     string
+		status    int
+		principal string
+	}{
+		{"public", RolePublic, "", "", http.StatusOK, ""},
+		{"no credentials", RoleReadOnly, "", "", http.StatusUnauthorized, ""},
+		{"unknown key", RoleReadOnly, APIKeyHeader, "guess", http.StatusUnauthorized, ""},
+		{"read-only key", RoleReadOnly, APIKeyHeader, "read-key", http.StatusOK, "dashboard"},
+		{"read-only key on admin route", RoleAdmin, APIKeyHeader, "read-key", http.StatusForbidden, ""},
+		{"admin key", RoleAdmin, APIKeyHeader, "admin-key", http.StatusOK, "operator"},
+		{"admin token", RoleAdmin, "Authorization", "Bearer " + newToken(t, "HS256", testSecret,
+			map[string]interface{}{"sub": "ci", "role": "admin", "exp": expiry}), http.StatusOK, "ci"},
+		{"read-only token on admin route", RoleAdmin, "Authorization", "Bearer " + newToken(t, "HS256", testSecret,
+			map[string]interface{}{"sub": "ci", "role": "read-only", "exp": expiry}), http.StatusForbidden, ""},
+		{"expired token", RoleReadOnly, "Authorization", "Bearer " + newToken(t, "HS256", testSecret,
+			map[string]interface{}{"sub": "ci", "role": "admin", "exp": time.Now().Add(-time.Minute).Unix()}), http.StatusUnauthorized, ""},
+		{"token without expiry", RoleReadOnly, "Authorization", "Bearer " + newToken(t, "HS256", testSecret,
+			map[string]interface{}{"sub": "ci", "role": "admin"}), http.StatusUnauthorized, ""},
+		{"token with other secret", RoleReadOnly, "Authorization", "Bearer " + newToken(t, "HS256", []byte("other"),
+			map[string]interface{}{"sub": "ci", "role": "admin", "exp": expiry}), http.StatusUnauthorized, ""},
+		{"token with other algorithm", RoleReadOnly, "Authorization", "Bearer " + newToken(t, "none", testSecret,
+			map[string]interface{}{"sub": "ci", "role": "admin", "exp": expiry}), http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal = ""
+			request := httptest.NewRequest(http.MethodGet, "/alerts", nil)
+			if test.header != "" {
+				request.Header.Set(test.header, test.value)
+			}
+			recorder := httptest.NewRecorder()
+			Auth(func() Credentials { return credentials }, test.required)(handler).ServeHTTP(recorder, request)
+			if recorder.Code != test.status || principal != test.principal {
+				t.Errorf("Expected status %d for %q, got %d for %q", test.status, test.principal, recorder.Code, principal)
+			}
+		})
+	}
+
+	// without credentials the API is open
+	recorder := httptest.NewRecorder()
+	Auth(func() Credentials { return Credentials{} }, RoleAdmin)(handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected every request to be let through without credentials, got %d", recorder.Code)
+	}
+}
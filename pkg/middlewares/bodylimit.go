@@ -0,0 +1,58 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// LimitBody middleware caps the request body at limit bytes before any other middleware or the handler reads it.
+// Requests declaring a longer body are answered with 413 straight away, and reading past the limit returns an
+// error whose cause is web.ErrTooLarge, which is answered with 413 as well.
+func LimitBody(limit int64) func(web.Handler) web.Handler {
+	return func(next web.Handler) web.Handler {
+		return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+			if request.ContentLength > limit {
+				return errors.Wrapf(web.ErrTooLarge, "request body must be at most %d bytes", limit)
+			}
+			if request.Body != nil {
+				request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(writer, request.Body, limit), limit: limit}
+			}
+			return next(ctx, writer, request)
+		})
+	}
+}
+
+// limitedBody reports the error of http.MaxBytesReader as web.ErrTooLarge once the limit is reached
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (body *limitedBody) Read(data []byte) (int, error) {
+	n, err := body.ReadCloser.Read(data)
+	body.read += int64(n)
+	if err != nil && err != io.EOF && body.read >= body.limit {
+		return n, errors.Wrapf(web.ErrTooLarge, "request body must be at most %d bytes", body.limit)
+	}
+	return n, err
+}
+
+// readError returns the error reading a request body, keeping web.ErrTooLarge as its cause
+// and making any other error a validation error
+func readError(err error) error {
+	if errors.Cause(err) == web.ErrTooLarge {
+		return err
+	}
+	return errors.Wrap(web.ErrValidation, err.Error())
+}
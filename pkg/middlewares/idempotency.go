@@ -0,0 +1,201 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// IdempotencyKeyHeader is the header callers send the key identifying a request and its retries in
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed to the retries of a request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotentResponse is the response to a request sent with an idempotency key, replayed to its retries
+type IdempotentResponse struct {
+	// RequestHash is the SHA-256 hash of the request body, which retries have to match
+	RequestHash string `json:"request_hash"`
+	StatusCode  int    `json:"status_code"`
+	Body        []byte `json:"body"`
+}
+
+// IdempotencyStore keeps the responses to requests sent with an idempotency key
+type IdempotencyStore interface {
+	// Lookup returns the response saved for the key, if it has not expired
+	Lookup(key string) (IdempotentResponse, bool, error)
+	// Save keeps the response for the key for ttl
+	Save(key string, response IdempotentResponse, ttl time.Duration) error
+}
+
+// Idempotency makes sure a request sent again with the same idempotency key is only handled once
+type Idempotency struct {
+	store func() IdempotencyStore
+	ttl   func() time.Duration
+
+	mutex    sync.Mutex
+	inFlight map[string]bool
+}
+
+// NewIdempotency creates an idempotency middleware saving responses in the store it returns, for the ttl it returns.
+// Both are read on every request, so they can be reloaded, and the Idempotency-Key header is ignored while either
+// is not set.
+func NewIdempotency(store func() IdempotencyStore, ttl func() time.Duration) *Idempotency {
+	return &Idempotency{
+		store:    store,
+		ttl:      ttl,
+		inFlight: make(map[string]bool),
+	}
+}
+
+// Idempotent middleware saves the response to a request sent with an Idempotency-Key header and replays it to
+// the retries of the request with the same key and body. Reusing a key with a different body, or while the first
+// request is still being handled, is answered with 409. Keys are kept per caller and route. Errors returned by
+// the handler are not saved, so the request can be retried.
+func (idempotency *Idempotency) Idempotent(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		key := request.Header.Get(IdempotencyKeyHeader)
+		store, ttl := idempotency.store(), idempotency.ttl()
+		if key == "" || store == nil || ttl <= 0 {
+			return next(ctx, writer, request)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return errors.Wrapf(web.ErrInvalidInput, "%s cannot be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)
+		}
+
+		// the body is read whole to hash it, LimitBody keeps it to the size the route allows
+		body, err := ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return readError(err)
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+
+		scopedKey := idempotencyScope(ctx, request) + "|" + key
+		saved, found, err := store.Lookup(scopedKey)
+		if err != nil {
+			return err
+		}
+		if found {
+			return replay(writer, request, key, saved, requestHash)
+		}
+
+		if !idempotency.begin(scopedKey) {
+			return errors.Wrapf(web.ErrConflict, "a request with %s %s is in progress", IdempotencyKeyHeader, key)
+		}
+		defer idempotency.end(scopedKey)
+
+		// a request with the same key may have finished between the lookup and begin
+		saved, found, err = store.Lookup(scopedKey)
+		if err != nil {
+			return err
+		}
+		if found {
+			return replay(writer, request, key, saved, requestHash)
+		}
+
+		recorder := &recordingWriter{ResponseWriter: writer}
+		if err := next(ctx, recorder, request); err != nil {
+			return err
+		}
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+		response := IdempotentResponse{RequestHash: requestHash, StatusCode: recorder.statusCode, Body: recorder.body.Bytes()}
+		if err := store.Save(scopedKey, response, ttl); err != nil {
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"Error":      err.Error(),
+			}).Error("unable to save idempotent response")
+		}
+		return nil
+	})
+}
+
+// replay writes the saved response to a request sent again with its idempotency key,
+// or answers 409 when the key was used with a different request
+func replay(writer http.ResponseWriter, request *http.Request, key string, saved IdempotentResponse, requestHash string) error {
+	if saved.RequestHash != requestHash {
+		return errors.Wrapf(web.ErrConflict, "%s %s was used with a different request", IdempotencyKeyHeader, key)
+	}
+	metrics.GetOrRegisterCounter("HTTP.Idempotency.Replayed", nil).Inc(1)
+	log.WithFields(log.Fields{
+		"Method":     request.Method,
+		"RequestURI": request.RequestURI,
+		"Key":        key,
+	}).Debug("Replaying idempotent response")
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set(IdempotentReplayedHeader, "true")
+	writer.WriteHeader(saved.StatusCode)
+	_, _ = writer.Write(saved.Body)
+	return nil
+}
+
+// begin marks the key as being handled, returning false if it already is
+func (idempotency *Idempotency) begin(key string) bool {
+	idempotency.mutex.Lock()
+	defer idempotency.mutex.Unlock()
+	if idempotency.inFlight[key] {
+		return false
+	}
+	idempotency.inFlight[key] = true
+	return true
+}
+
+func (idempotency *Idempotency) end(key string) {
+	idempotency.mutex.Lock()
+	defer idempotency.mutex.Unlock()
+	delete(idempotency.inFlight, key)
+}
+
+// idempotencyScope keeps the keys of different callers and routes apart
+func idempotencyScope(ctx context.Context, request *http.Request) string {
+	caller := "ip:" + clientIP(request)
+	if values, ok := ctx.Value(web.KeyValues).(*web.ContextValues); ok && values.Principal != "" {
+		caller = "principal:" + values.Principal
+	}
+	return caller + "|" + request.Method + " " + request.URL.Path
+}
+
+// recordingWriter keeps a copy of the response written by the handler
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (writer *recordingWriter) WriteHeader(statusCode int) {
+	writer.statusCode = statusCode
+	writer.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (writer *recordingWriter) Write(data []byte) (int, error) {
+	if writer.statusCode == 0 {
+		writer.statusCode = http.StatusOK
+	}
+	writer.body.Write(data)
+	return writer.ResponseWriter.Write(data)
+}
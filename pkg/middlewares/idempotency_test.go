@@ -0,0 +1,197 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+// memoryStore keeps idempotent responses in memory, without expiry
+type memoryStore map[string]IdempotentResponse
+
+func (store memoryStore) Lookup(key string) (IdempotentResponse, bool, error) {
+	response, found := store[key]
+	return response, found, nil
+}
+
+func (store memoryStore) Save(key string, response IdempotentResponse, ttl time.Duration) error {
+	store[key] = response
+	return nil
+}
+
+// lateStore finds no response on the first lookup, as if the request with the same key finished right after it
+type lateStore struct {
+	memoryStore
+	lookups int
+}
+
+func (store *lateStore) Lookup(key string) (IdempotentResponse, bool, error) {
+	store.lookups++
+	if store.lookups == 1 {
+		return IdempotentResponse{}, false, nil
+	}
+	return store.memoryStore.Lookup(key)
+}
+
+func TestIdempotent(t *testing.T) {
+	store := memoryStore{}
+	idempotency := NewIdempotency(func() IdempotencyStore { return store }, func() time.Duration { return time.Hour })
+	var handled int
+	failing := false
+	handler := idempotency.Idempotent(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		if failing {
+			return errors.Wrap(web.ErrServiceUnavailable, "busy")
+		}
+		handled++
+		web.Respond(ctx, writer, map[string]int{"handled": handled}, http.StatusAccepted)
+		return nil
+	})
+
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send("retry-1", `{"application":"inventory"}`)
+	if first.Code != http.StatusAccepted || handled != 1 {
+		t.Fatalf("Expected the first request to be handled, got %d %d", first.Code, handled)
+	}
+	retry := send("retry-1", `{"application":"inventory"}`)
+	if retry.Code != http.StatusAccepted || handled != 1 || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the original response to be replayed, got %d %s after %d requests", retry.Code, retry.Body.String(), handled)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("Expected the replayed response to be marked")
+	}
+	if recorder := send("retry-1", `{"application":"mapping"}`); recorder.Code != http.StatusConflict || handled != 1 {
+		t.Errorf("Expected a conflict reusing the key with another body, got %d", recorder.Code)
+	}
+
+	// requests without a key and failed requests are not saved
+	send("", `{"application":"inventory"}`)
+	send("", `{"application":"inventory"}`)
+	if handled != 3 {
+		t.Errorf("Expected requests without a key to be handled every time, got %d", handled)
+	}
+	failing = true
+	if recorder := send("retry-2", `{"application":"inventory"}`); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the error of the handler, got %d", recorder.Code)
+	}
+	failing = false
+	if recorder := send("retry-2", `{"application":"inventory"}`); recorder.Code != http.StatusAccepted || handled != 4 {
+		t.Errorf("Expected a failed request to be handled again, got %d %d", recorder.Code, handled)
+	}
+
+	if recorder := send(strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected keys that are too long to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestIdempotentReplayNotRateLimited(t *testing.T) {
+	store := memoryStore{}
+	idempotency := NewIdempotency(func() IdempotencyStore { return store }, func() time.Duration { return time.Hour })
+	limiter := NewRateLimiter(func() RateLimit { return RateLimit{PerSecond: 1, Burst: 1} })
+	handled := 0
+	handler := idempotency.Idempotent(limiter.Limit(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		handled++
+		writer.WriteHeader(http.StatusAccepted)
+		return nil
+	}))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(`{}`))
+		request.Header.Set(IdempotencyKeyHeader, key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 3; i++ {
+		if recorder := send("retry-1"); recorder.Code != http.StatusAccepted || handled != 1 {
+			t.Fatalf("Expected the retries to be replayed without being rate limited, got %d %d", recorder.Code, handled)
+		}
+	}
+	if recorder := send("retry-2"); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a new request to be rate limited, got %d", recorder.Code)
+	}
+}
+
+func TestIdempotentInFlight(t *testing.T) {
+	idempotency := NewIdempotency(func() IdempotencyStore { return memoryStore{} }, func() time.Duration { return time.Hour })
+	if !idempotency.begin("key") {
+		t.Fatal("Expected the key to be free")
+	}
+	if idempotency.begin("key") {
+		t.Error("Expected the key to be taken while in flight")
+	}
+	idempotency.end("key")
+	if !idempotency.begin("key") {
+		t.Error("Expected the key to be free again")
+	}
+}
+
+func TestIdempotentFinishedBeforeBegin(t *testing.T) {
+	body := `{"application":"inventory"}`
+	request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(body))
+	request.Header.Set(IdempotencyKeyHeader, "retry-1")
+	hash := sha256.Sum256([]byte(body))
+	store := &lateStore{memoryStore: memoryStore{}}
+	store.memoryStore[idempotencyScope(context.Background(), request)+"|retry-1"] = IdempotentResponse{
+		RequestHash: hex.EncodeToString(hash[:]),
+		StatusCode:  http.StatusAccepted,
+		Body:        []byte(`{"handled":1}`),
+	}
+
+	idempotency := NewIdempotency(func() IdempotencyStore { return store }, func() time.Duration { return time.Hour })
+	handled := false
+	handler := idempotency.Idempotent(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		handled = true
+		return nil
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if handled || recorder.Code != http.StatusAccepted || recorder.Body.String() != `{"handled":1}` {
+		t.Errorf("Expected the response saved in the meantime to be replayed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestIdempotentTooLarge(t *testing.T) {
+	idempotency := NewIdempotency(func() IdempotencyStore { return memoryStore{} }, func() time.Duration { return time.Hour })
+	handled := false
+	handler := LimitBody(16)(idempotency.Idempotent(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		handled = true
+		return nil
+	}))
+
+	batch := `[{"application":"inventory"},{"application":"inventory"}]`
+	for _, body := range []io.Reader{strings.NewReader(batch), ioutil.NopCloser(strings.NewReader(batch))} {
+		request := httptest.NewRequest(http.MethodPost, "/alert/alertmessages", body)
+		request.Header.Set(IdempotencyKeyHeader, "retry-1")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if handled || recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected a body over the limit to be answered with 413, got %d (content length %d)", recorder.Code, request.ContentLength)
+		}
+	}
+}
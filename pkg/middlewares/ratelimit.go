@@ -0,0 +1,222 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RateLimitByIP limits each client address separately
+	RateLimitByIP = "ip"
+	// RateLimitByAPIKey limits each API key or token subject separately, and callers without one by address
+	RateLimitByAPIKey = "apiKey"
+	// RateLimitByApplication limits each application field of the request body separately,
+	// and requests without one by address
+	RateLimitByApplication = "application"
+)
+
+const (
+	// sweepInterval is how often buckets that have filled up again are forgotten
+	sweepInterval = time.Minute
+	// maxApplicationBody is the most of a request body read to find its application,
+	// requests with a larger body are limited by address
+	maxApplicationBody = 64 << 10
+)
+
+// RateLimit is how many requests a caller can send
+type RateLimit struct {
+	// PerSecond is the rate the bucket of a caller refills at, 0 turns the limit off
+	PerSecond float64
+	// Burst is the size of the bucket, the requests a caller can send at once
+	Burst int
+	// Key is what callers are told apart by, RateLimitByIP, RateLimitByAPIKey or RateLimitByApplication
+	Key string
+}
+
+// RateLimiter keeps a token bucket for each caller
+type RateLimiter struct {
+	limit func() RateLimit
+	now   func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a rate limiter with the limit it returns, which is read on every request so it can be reloaded
+func NewRateLimiter(limit func() RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of the caller, or returns how long until there is one
+func (limiter *RateLimiter) Allow(key string, limit RateLimit) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	limiter.sweep(now, limit.PerSecond, burst)
+
+	current, found := limiter.buckets[key]
+	if !found {
+		current = &bucket{tokens: burst, updated: now}
+		limiter.buckets[key] = current
+	}
+	current.tokens = math.Min(burst, current.tokens+now.Sub(current.updated).Seconds()*limit.PerSecond)
+	current.updated = now
+
+	if current.tokens >= 1 {
+		current.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - current.tokens) / limit.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep forgets the buckets that have filled up again, as a new bucket is full
+func (limiter *RateLimiter) sweep(now time.Time, perSecond float64, burst float64) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+	for key, current := range limiter.buckets {
+		if current.tokens+now.Sub(current.updated).Seconds()*perSecond >= burst {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// Limit middleware answers 429 with a Retry-After header when the caller has used up its bucket,
+// counting the rejected requests in the HTTP.RateLimit.Rejected metric
+func (limiter *RateLimiter) Limit(next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		limit := limiter.limit()
+		if limit.PerSecond <= 0 {
+			return next(ctx, writer, request)
+		}
+
+		key := rateLimitKey(ctx, request, limit.Key)
+		if allowed, wait := limiter.Allow(key, limit); !allowed {
+			metrics.GetOrRegisterCounter("HTTP.RateLimit.Rejected", nil).Inc(1)
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"Key":        key,
+			}).Debug("Rate limit exceeded")
+
+			RetryAfter(writer, wait)
+			return errors.Wrapf(web.ErrTooManyRequests, "rate limit of %g requests per second exceeded", limit.PerSecond)
+		}
+		return next(ctx, writer, request)
+	})
+}
+
+// AllowItem takes a token from the bucket of the caller for one item of a request carrying several, such as
+// an alert message of a batch, or returns how long until there is one. Items are charged to their own
+// application when callers are told apart by application. It always allows items while the limit is off.
+func (limiter *RateLimiter) AllowItem(ctx context.Context, request *http.Request, application string) (bool, time.Duration) {
+	limit := limiter.limit()
+	if limit.PerSecond <= 0 {
+		return true, 0
+	}
+
+	key := callerKey(ctx, request, limit.Key, func() string { return application })
+	allowed, wait := limiter.Allow(key, limit)
+	if !allowed {
+		metrics.GetOrRegisterCounter("HTTP.RateLimit.Rejected", nil).Inc(1)
+	}
+	return allowed, wait
+}
+
+// rateLimitKey returns what the caller of the request is told apart by, falling back to its address
+func rateLimitKey(ctx context.Context, request *http.Request, key string) string {
+	return callerKey(ctx, request, key, func() string { return bodyApplication(request) })
+}
+
+// callerKey returns what the caller of the request is told apart by, reading the application only when
+// callers are told apart by application, and falling back to the address of the request
+func callerKey(ctx context.Context, request *http.Request, key string, application func() string) string {
+	switch key {
+	case RateLimitByAPIKey:
+		if values, ok := ctx.Value(web.KeyValues).(*web.ContextValues); ok && values.Principal != "" {
+			return "principal:" + values.Principal
+		}
+	case RateLimitByApplication:
+		if application := application(); application != "" {
+			return "application:" + application
+		}
+	}
+	return "ip:" + clientIP(request)
+}
+
+// RetryAfter sets the Retry-After header of the response to the wait, in whole seconds
+func RetryAfter(writer http.ResponseWriter, wait time.Duration) {
+	writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// bodyApplication reads the application field of a JSON request body of at most maxApplicationBody bytes,
+// leaving the body to be read again
+func bodyApplication(request *http.Request) string {
+	if request.Body == nil {
+		return ""
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maxApplicationBody+1))
+	request.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), request.Body), Closer: request.Body}
+	if err != nil || len(body) > maxApplicationBody {
+		return ""
+	}
+	var fields struct {
+		Application string `json:"application"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	return fields.Application
+}
+
+// prefixedBody is a request body whose start was already read, put back in front of the rest
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// clientIP returns the address the request came from, without its port
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,130 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-alert-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	limiter := NewRateLimiter(nil)
+	limiter.now = func() time.Time { return now }
+	limit := RateLimit{PerSecond: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("a", limit); !allowed {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	allowed, wait := limiter.Allow("a", limit)
+	if allowed || wait != 500*time.Millisecond {
+		t.Errorf("Expected the request over the burst to wait 500ms, got %v %s", allowed, wait)
+	}
+	if allowed, _ := limiter.Allow("b", limit); !allowed {
+		t.Error("Expected other callers to have their own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _ := limiter.Allow("a", limit); !allowed {
+		t.Error("Expected a token once the bucket has refilled")
+	}
+
+	// full buckets are forgotten
+	now = now.Add(sweepInterval)
+	limiter.Allow("c", limit)
+	if _, found := limiter.buckets["a"]; found {
+		t.Error("Expected the refilled bucket to be forgotten")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := RateLimit{PerSecond: 1, Burst: 1, Key: RateLimitByApplication}
+	limiter := NewRateLimiter(func() RateLimit { return limit })
+	var body string
+	handler := limiter.Limit(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		data, _ := ioutil.ReadAll(request.Body)
+		body = string(data)
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	})
+	rejected := metrics.GetOrRegisterCounter("HTTP.RateLimit.Rejected", nil)
+	rejectedBefore := rejected.Count()
+
+	send := func(application string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(`{"application":"`+application+`"}`))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := send("inventory"); recorder.Code != http.StatusOK || body != `{"application":"inventory"}` {
+		t.Fatalf("Expected the first request to reach the handler with its body, got %d %s", recorder.Code, body)
+	}
+	recorder := send("inventory")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After 1, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	if rejected.Count() != rejectedBefore+1 {
+		t.Errorf("Expected the rejected request to be counted, got %d", rejected.Count()-rejectedBefore)
+	}
+	if recorder := send("mapping"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected another application to have its own limit, got %d", recorder.Code)
+	}
+
+	limit.PerSecond = 0
+	if recorder := send("inventory"); recorder.Code != http.StatusOK {
+		t.Errorf("Expected no limit once it is turned off, got %d", recorder.Code)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(`{"value":{}}`))
+	request.RemoteAddr = "10.0.0.5:43210"
+	values := &web.ContextValues{Principal: "operator"}
+	ctx := context.WithValue(context.Background(), web.KeyValues, values)
+
+	if key := rateLimitKey(ctx, request, RateLimitByAPIKey); key != "principal:operator" {
+		t.Errorf("Expected the principal to be the key, got %s", key)
+	}
+	if key := rateLimitKey(ctx, request, RateLimitByApplication); key != "ip:10.0.0.5" {
+		t.Errorf("Expected the address without an application, got %s", key)
+	}
+	values.Principal = ""
+	if key := rateLimitKey(ctx, request, RateLimitByAPIKey); key != "ip:10.0.0.5" {
+		t.Errorf("Expected the address without a principal, got %s", key)
+	}
+}
+
+func TestBodyApplication(t *testing.T) {
+	body := `{"application":"inventory","value":{}}`
+	request := httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(body))
+	if application := bodyApplication(request); application != "inventory" {
+		t.Errorf("Expected the application of the body, got %q", application)
+	}
+	if read, err := ioutil.ReadAll(request.Body); err != nil || string(read) != body {
+		t.Errorf("Expected the body to be read again, got %q %v", read, err)
+	}
+
+	large := `{"application":"inventory","value":"` + strings.Repeat("a", maxApplicationBody) + `"}`
+	request = httptest.NewRequest(http.MethodPost, "/alert/alertmessage", strings.NewReader(large))
+	if application := bodyApplication(request); application != "" {
+		t.Errorf("Expected no application for a body over %d bytes, got %q", maxApplicationBody, application)
+	}
+	if read, err := ioutil.ReadAll(request.Body); err != nil || string(read) != large {
+		t.Errorf("Expected the whole large body to be read again, got %d bytes %v", len(read), err)
+	}
+}
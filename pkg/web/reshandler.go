@@ -25,6 +25,9 @@ var (
 	// ErrNotAuthorized occurs when the call is not authorized.
 	ErrNotAuthorized = errors.New("Not authorized")
 
+	// ErrForbidden occurs when the caller is authenticated but its role does not allow the call.
+	ErrForbidden = errors.New("Forbidden")
+
 	// ErrDBNotConfigured occurs when the DB is not initialized.
 	ErrDBNotConfigured = errors.New("DB not initialized")
 
@@ -39,6 +42,18 @@ var (
 
 	// ErrInvalidInput occurs when the input data is invalid
 	ErrInvalidInput = errors.New("Invalid input data")
+
+	// ErrConflict occurs when the request conflicts with the current state of an entity
+	ErrConflict = errors.New("Conflict with current state")
+
+	// ErrTooManyRequests occurs when the caller has sent more requests than its rate limit allows
+	ErrTooManyRequests = errors.New("Too many requests")
+
+	// ErrServiceUnavailable occurs when the service cannot take the request right now
+	ErrServiceUnavailable = errors.New("Service unavailable")
+
+	// ErrTooLarge occurs when the request body is larger than the route allows
+	ErrTooLarge = errors.New("Request body too large")
 )
 
 // Error handles all error responses for the API.
@@ -62,9 +77,33 @@ func Error(ctx context.Context, writer http.ResponseWriter, err error) {
 		RespondError(ctx, writer, err, http.StatusUnauthorized)
 		return
 
+	case ErrForbidden:
+		RespondError(ctx, writer, err, http.StatusForbidden)
+		return
+
 	case ErrInvalidInput:
 		RespondError(ctx, writer, err, http.StatusBadRequest)
 		return
+
+	case ErrDBNotConfigured:
+		RespondError(ctx, writer, err, http.StatusServiceUnavailable)
+		return
+
+	case ErrConflict:
+		RespondError(ctx, writer, err, http.StatusConflict)
+		return
+
+	case ErrTooManyRequests:
+		RespondError(ctx, writer, err, http.StatusTooManyRequests)
+		return
+
+	case ErrServiceUnavailable:
+		RespondError(ctx, writer, err, http.StatusServiceUnavailable)
+		return
+
+	case ErrTooLarge:
+		RespondError(ctx, writer, err, http.StatusRequestEntityTooLarge)
+		return
 	}
 
 	// Handler server error
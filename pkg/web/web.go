@@ -24,6 +24,8 @@ type ContextValues struct {
 	TraceID    string
 	Method     string
 	RequestURI string
+	// Principal is the name of the API key or the subject of the token the caller authenticated with
+	Principal string
 }
 
 // Handler is a type that handles a http request